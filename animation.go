@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//AnimationFormats lists the formats an animation can be written in, as given to -format.
+var AnimationFormats = []string{"gif", "apng", "png", "y4m"}
+
+//AnimationWriter writes the frames of an animation one by one. Close finishes the file.
+//Both return the first error met when writing, after which the animation is incomplete.
+type AnimationWriter interface {
+	AddFrame(img image.Image) error
+	Close() error
+}
+
+//GIFWriter writes an animated GIF, filename + ".gif". Frames are kept until Close, as they share one palette.
+type GIFWriter struct {
+	filename string
+	delay    int
+	frames   []image.Image
+}
+
+//APNGWriter writes an animated PNG, filename + ".png", with true colors. Frames are compressed as they come and written on Close.
+type APNGWriter struct {
+	filename      string
+	fps           int
+	width, height int
+
+	//zlib-compressed image data of each frame
+	frames [][]byte
+}
+
+//PNGSequenceWriter writes each frame as a numbered PNG in the folder filename.
+type PNGSequenceWriter struct {
+	folder string
+	count  int
+}
+
+//Y4MWriter writes raw YUV 4:4:4 video, filename + ".y4m", that video encoders such as ffmpeg can read.
+//The file is created with the first frame, so that an animation without frames writes no file.
+type Y4MWriter struct {
+	filename      string
+	file          *os.File
+	writer        *bufio.Writer
+	fps           int
+	width, height int
+}
+
+//NewAnimationWriter returns a writer of the given format for an animation shown at fps frames per second, in the run directory.
+func NewAnimationWriter(format, filename string, fps int) (AnimationWriter, error) {
+
+	if format == "gif" {
+		//frames shorter than a hundredth of a second are played by many viewers at their own speed
+		delay := 100 / fps
+		if delay < 1 {
+			delay = 1
+		}
+		return &GIFWriter{filename: GetOutputPath(filename), delay: delay}, nil
+	} else if format == "apng" {
+		return &APNGWriter{filename: GetOutputPath(filename), fps: fps}, nil
+	} else if format == "png" {
+		folder := GetNewFolderDir(filename)
+		err := MakeDirIfNotExist(folder)
+		if err != nil {
+			return nil, err
+		}
+		RefreshDirectoryOf(folder, ".png")
+		return &PNGSequenceWriter{folder: folder}, nil
+	} else if format == "y4m" {
+		return &Y4MWriter{filename: GetOutputPath(filename + ".y4m"), fps: fps}, nil
+	}
+
+	panic("Animation format has to be one of " + strings.Join(AnimationFormats, ", "))
+}
+
+//WriteAnimation writes the frames in every format of options, keeping every options.stride-th frame and the last one.
+//The first error met is returned.
+func WriteAnimation(imglist []image.Image, filename string, options Options) error {
+
+	frames := make([]image.Image, 0)
+	for i := range imglist {
+		if i%options.stride == 0 || i == len(imglist)-1 {
+			frames = append(frames, imglist[i])
+		}
+	}
+
+	for _, format := range options.formats {
+		writer, err := NewAnimationWriter(format, filename, options.fps)
+		if err != nil {
+			return err
+		}
+
+		for _, frame := range frames {
+			err = writer.AddFrame(frame)
+			if err != nil {
+				writer.Close()
+				return err
+			}
+		}
+
+		err = writer.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//AddFrame adds a frame to the GIF.
+func (w *GIFWriter) AddFrame(img image.Image) error {
+	w.frames = append(w.frames, img)
+	return nil
+}
+
+//Close writes the GIF.
+func (w *GIFWriter) Close() error {
+
+	delays := make([]int, len(w.frames))
+	for i := range delays {
+		delays[i] = w.delay
+	}
+
+	return ImagesToGIFWithDelays(w.frames, w.filename, delays)
+}
+
+//FormatFrameSize returns the size of a frame as width x height.
+func FormatFrameSize(width, height int) string {
+	return strconv.Itoa(width) + "x" + strconv.Itoa(height)
+}
+
+//AddFrame compresses a frame of the APNG. Every frame must have the size of the first.
+func (w *APNGWriter) AddFrame(img image.Image) error {
+
+	bounds := img.Bounds()
+
+	if len(w.frames) == 0 {
+		w.width = bounds.Dx()
+		w.height = bounds.Dy()
+	} else if bounds.Dx() != w.width || bounds.Dy() != w.height {
+		return errors.New("frames of " + w.filename + ".png have to be " + FormatFrameSize(w.width, w.height) + " like the first, not " + FormatFrameSize(bounds.Dx(), bounds.Dy()))
+	}
+
+	//8-bit RGBA rows, each behind its filter type: 1 stores differences from the pixel on the left
+	var data bytes.Buffer
+	compressor := zlib.NewWriter(&data)
+
+	row := make([]byte, 1+4*w.width)
+	row[0] = 1
+
+	for y := 0; y < w.height; y++ {
+		var left [4]byte
+		for x := 0; x < w.width; x++ {
+			col := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			pixel := [4]byte{col.R, col.G, col.B, col.A}
+			for c := 0; c < 4; c++ {
+				row[1+4*x+c] = pixel[c] - left[c]
+			}
+			left = pixel
+		}
+		compressor.Write(row)
+	}
+	compressor.Close()
+
+	w.frames = append(w.frames, data.Bytes())
+
+	return nil
+}
+
+//Close writes the APNG: the first frame is the default image, shown by viewers without animation support.
+func (w *APNGWriter) Close() error {
+
+	if len(w.frames) == 0 {
+		return nil
+	}
+
+	file, err := CreateOutputFile(w.filename + ".png")
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteChunks(file)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + w.filename + ".png: " + err.Error())
+	}
+
+	return nil
+}
+
+//WriteChunks writes the signature and chunks of the APNG to file, returning the first error met.
+func (w *APNGWriter) WriteChunks(file *os.File) error {
+
+	writer := bufio.NewWriter(file)
+
+	_, err := writer.Write([]byte("\x89PNG\r\n\x1a\n"))
+	if err != nil {
+		return err
+	}
+
+	//width, height, bit depth 8, color type 6 (RGBA), default compression, filtering and no interlace
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(w.width))
+	binary.BigEndian.PutUint32(header[4:], uint32(w.height))
+	header[8] = 8
+	header[9] = 6
+	err = WritePNGChunk(writer, "IHDR", header)
+	if err != nil {
+		return err
+	}
+
+	//number of frames, played forever
+	control := make([]byte, 8)
+	binary.BigEndian.PutUint32(control[0:], uint32(len(w.frames)))
+	err = WritePNGChunk(writer, "acTL", control)
+	if err != nil {
+		return err
+	}
+
+	sequence := uint32(0)
+
+	for f, data := range w.frames {
+
+		//frame control: full-size frame at 0,0 shown for 1/fps seconds, replacing the previous one
+		frameControl := make([]byte, 26)
+		binary.BigEndian.PutUint32(frameControl[0:], sequence)
+		binary.BigEndian.PutUint32(frameControl[4:], uint32(w.width))
+		binary.BigEndian.PutUint32(frameControl[8:], uint32(w.height))
+		binary.BigEndian.PutUint16(frameControl[20:], 1)
+		binary.BigEndian.PutUint16(frameControl[22:], uint16(w.fps))
+		err = WritePNGChunk(writer, "fcTL", frameControl)
+		if err != nil {
+			return err
+		}
+		sequence++
+
+		if f == 0 {
+			err = WritePNGChunk(writer, "IDAT", data)
+		} else {
+			frameData := make([]byte, 4+len(data))
+			binary.BigEndian.PutUint32(frameData, sequence)
+			copy(frameData[4:], data)
+			err = WritePNGChunk(writer, "fdAT", frameData)
+			sequence++
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WritePNGChunk(writer, "IEND", nil)
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+//WritePNGChunk writes one chunk of a PNG file: its length, type, data and checksum, returning the first error met.
+func WritePNGChunk(writer *bufio.Writer, chunkType string, data []byte) error {
+
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+
+	checksum := crc32.NewIEEE()
+	checksum.Write([]byte(chunkType))
+	checksum.Write(data)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, checksum.Sum32())
+
+	for _, part := range [][]byte{length, []byte(chunkType), data, crc} {
+		_, err := writer.Write(part)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//AddFrame writes the next PNG of the sequence.
+func (w *PNGSequenceWriter) AddFrame(img image.Image) error {
+	err := SavePNG(img, fmt.Sprintf("%s/frame_%05d.png", w.folder, w.count))
+	w.count++
+	return err
+}
+
+//Close does nothing, as every frame is written when added.
+func (w *PNGSequenceWriter) Close() error {
+	return nil
+}
+
+//AddFrame writes a frame of the video, after creating the file and writing the stream header if it is the first.
+//Every frame must have the size of the first.
+func (w *Y4MWriter) AddFrame(img image.Image) error {
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	if w.file == nil {
+		file, err := CreateOutputFile(w.filename)
+		if err != nil {
+			return err
+		}
+		w.file = file
+		w.writer = bufio.NewWriter(file)
+		w.width = width
+		w.height = height
+
+		//the colors are full-range YCbCr, as JPEG uses, rather than the limited range of broadcast video
+		_, err = fmt.Fprintf(w.writer, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444 XCOLORRANGE=FULL\n", width, height, w.fps)
+		if err != nil {
+			return err
+		}
+	} else if width != w.width || height != w.height {
+		return errors.New("frames of " + w.filename + " have to be " + FormatFrameSize(w.width, w.height) + " like the first, not " + FormatFrameSize(width, height))
+	}
+
+	//planes of luma and the two chroma components
+	planes := make([][]byte, 3)
+	for p := range planes {
+		planes[p] = make([]byte, width*height)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			col := color.RGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			luma, cb, cr := color.RGBToYCbCr(col.R, col.G, col.B)
+			planes[0][y*width+x] = luma
+			planes[1][y*width+x] = cb
+			planes[2][y*width+x] = cr
+		}
+	}
+
+	_, err := w.writer.WriteString("FRAME\n")
+	if err != nil {
+		return err
+	}
+	for _, plane := range planes {
+		_, err = w.writer.Write(plane)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Close finishes the video file, if a frame was written.
+func (w *Y4MWriter) Close() error {
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.writer.Flush()
+	if errClose := w.file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + w.filename + ": " + err.Error())
+	}
+
+	return nil
+}
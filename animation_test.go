@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//PNGChunk is a chunk read back from a PNG file.
+type PNGChunk struct {
+	chunkType string
+	data      []byte
+}
+
+//UseTestOutputDir makes a temporary directory the run directory, returning it and a function restoring the previous one.
+func UseTestOutputDir(t *testing.T) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "animation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := OutputDir
+	OutputDir = dir
+
+	return dir, func() {
+		OutputDir = previous
+		os.RemoveAll(dir)
+	}
+}
+
+//GetTestFrames returns n frames of width by height pixels, each of its own pattern of colors.
+func GetTestFrames(n, width, height int) []image.Image {
+
+	frames := make([]image.Image, n)
+	for f := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.SetRGBA(x, y, color.RGBA{uint8(40 * f), uint8(30*x + y), uint8(200 - 20*y), 255})
+			}
+		}
+		frames[f] = img
+	}
+
+	return frames
+}
+
+//CheckSameImage fails t unless the pixels of read are those of written.
+func CheckSameImage(t *testing.T, name string, read, written image.Image) {
+
+	bounds := written.Bounds()
+	if read.Bounds().Dx() != bounds.Dx() || read.Bounds().Dy() != bounds.Dy() {
+		t.Fatalf("%s is %v, written as %v", name, read.Bounds(), bounds)
+	}
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			readColor := color.RGBAModel.Convert(read.At(read.Bounds().Min.X+x, read.Bounds().Min.Y+y))
+			writtenColor := color.RGBAModel.Convert(written.At(bounds.Min.X+x, bounds.Min.Y+y))
+			if readColor != writtenColor {
+				t.Fatalf("%s pixel %d %d read as %v, written as %v", name, x, y, readColor, writtenColor)
+			}
+		}
+	}
+}
+
+//ReadPNGChunks returns the chunks of a PNG file, failing t if the signature or a checksum is wrong.
+func ReadPNGChunks(t *testing.T, data []byte) []PNGChunk {
+
+	if bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) == false {
+		t.Fatal("no PNG signature")
+	}
+	data = data[8:]
+
+	chunks := make([]PNGChunk, 0)
+
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatal("truncated chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data))
+		if len(data) < 12+length {
+			t.Fatal("truncated chunk")
+		}
+
+		chunk := PNGChunk{string(data[4:8]), data[8 : 8+length]}
+		if crc32.ChecksumIEEE(data[4:8+length]) != binary.BigEndian.Uint32(data[8+length:]) {
+			t.Fatalf("checksum of chunk %s does not match", chunk.chunkType)
+		}
+		chunks = append(chunks, chunk)
+
+		data = data[12+length:]
+	}
+
+	return chunks
+}
+
+//TestAPNGWriter checks the chunks of an APNG, its default image and that each of its frames holds the frame written.
+func TestAPNGWriter(t *testing.T) {
+
+	dir, restore := UseTestOutputDir(t)
+	defer restore()
+
+	frames := GetTestFrames(3, 5, 4)
+
+	err := WriteAnimation(frames, "growth", Options{formats: []string{"apng"}, stride: 1, fps: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "growth.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//viewers without animation support show the first frame
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	CheckSameImage(t, "default image", img, frames[0])
+
+	chunks := ReadPNGChunks(t, data)
+
+	types := ""
+	for _, chunk := range chunks {
+		types += chunk.chunkType + " "
+	}
+	if types != "IHDR acTL fcTL IDAT fcTL fdAT fcTL fdAT IEND " {
+		t.Fatalf("chunks %s", types)
+	}
+
+	if binary.BigEndian.Uint32(chunks[1].data) != 3 {
+		t.Fatalf("acTL of %d frames", binary.BigEndian.Uint32(chunks[1].data))
+	}
+
+	//sequence numbers run on over the fcTL and fdAT chunks
+	sequence := uint32(0)
+	f := 0
+	for _, chunk := range chunks {
+		if chunk.chunkType != "fcTL" && chunk.chunkType != "fdAT" {
+			continue
+		}
+		if binary.BigEndian.Uint32(chunk.data) != sequence {
+			t.Fatalf("%s has sequence number %d, expected %d", chunk.chunkType, binary.BigEndian.Uint32(chunk.data), sequence)
+		}
+		sequence++
+
+		//a frame is read as a PNG of its own, its data taking the place of the IDAT
+		if chunk.chunkType == "fdAT" {
+			f++
+
+			var frame bytes.Buffer
+			frame.WriteString("\x89PNG\r\n\x1a\n")
+			for _, part := range []PNGChunk{chunks[0], {"IDAT", chunk.data[4:]}, {"IEND", nil}} {
+				binary.Write(&frame, binary.BigEndian, uint32(len(part.data)))
+				frame.WriteString(part.chunkType)
+				frame.Write(part.data)
+				binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(part.chunkType), part.data...)))
+			}
+
+			img, err := png.Decode(&frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			CheckSameImage(t, "frame", img, frames[f])
+		}
+	}
+}
+
+//TestY4MWriter checks the header and planes of a Y4M video.
+func TestY4MWriter(t *testing.T) {
+
+	dir, restore := UseTestOutputDir(t)
+	defer restore()
+
+	white := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := range white.Pix {
+		white.Pix[i] = 255
+	}
+	black := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 255
+	}
+
+	err := WriteAnimation([]image.Image{white, black}, "growth", Options{formats: []string{"y4m"}, stride: 1, fps: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "growth.y4m"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected bytes.Buffer
+	expected.WriteString("YUV4MPEG2 W3 H2 F12:1 Ip A1:1 C444 XCOLORRANGE=FULL\n")
+	for _, luma := range []byte{255, 0} {
+		expected.WriteString("FRAME\n")
+		expected.Write(bytes.Repeat([]byte{luma}, 6))
+		expected.Write(bytes.Repeat([]byte{128}, 12))
+	}
+
+	if bytes.Equal(data, expected.Bytes()) == false {
+		t.Fatalf("video %q, expected %q", data, expected.Bytes())
+	}
+}
+
+//TestWriteAnimationFrameSize checks that APNGs and videos refuse a frame of another size than the first.
+func TestWriteAnimationFrameSize(t *testing.T) {
+
+	_, restore := UseTestOutputDir(t)
+	defer restore()
+
+	frames := append(GetTestFrames(2, 5, 4), GetTestFrames(1, 3, 2)...)
+
+	for _, format := range []string{"apng", "y4m"} {
+		err := WriteAnimation(frames, "growth", Options{formats: []string{format}, stride: 1, fps: 10})
+		if err == nil {
+			t.Errorf("%s: frames of two sizes written without error", format)
+		} else if strings.Contains(err.Error(), "have to be 5x4 like the first, not 3x2") == false {
+			t.Errorf("%s: error %q", format, err.Error())
+		}
+	}
+}
+
+//TestWriteAnimationEmpty checks that animations without frames write no files.
+func TestWriteAnimationEmpty(t *testing.T) {
+
+	dir, restore := UseTestOutputDir(t)
+	defer restore()
+
+	err := WriteAnimation(nil, "growth", Options{formats: []string{"gif", "apng", "y4m"}, stride: 1, fps: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("%d files written", len(files))
+	}
+}
+
+//TestWriteAnimationStride checks that every stride-th frame and the last are kept.
+func TestWriteAnimationStride(t *testing.T) {
+
+	dir, restore := UseTestOutputDir(t)
+	defer restore()
+
+	for _, test := range []struct{ frames, kept int }{{5, 3}, {6, 4}, {1, 1}} {
+		err := WriteAnimation(GetTestFrames(test.frames, 2, 2), "growth", Options{formats: []string{"png"}, stride: 2, fps: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(dir, "growth"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != test.kept {
+			t.Fatalf("%d frames of %d kept with a stride of 2, expected %d", len(files), test.frames, test.kept)
+		}
+	}
+}
+
+//TestGIFWriterDelay checks that the delay of GIF frames is never below a hundredth of a second.
+func TestGIFWriterDelay(t *testing.T) {
+
+	for _, test := range []struct{ fps, delay int }{{10, 10}, {30, 3}, {100, 1}, {200, 1}} {
+		writer, err := NewAnimationWriter("gif", "growth", test.fps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if writer.(*GIFWriter).delay != test.delay {
+			t.Errorf("delay %d at %d frames per second, expected %d", writer.(*GIFWriter).delay, test.fps, test.delay)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+//Canvas is an image with a current path and the colors to stroke and fill it with.
+//Paths are built with MoveTo and LineTo, and drawn with Stroke or Fill, which start a new path.
+type Canvas struct {
+	img           *image.RGBA
+	width, height int
+
+	strokeColor, fillColor color.Color
+	lineWidth              float64
+
+	//subpaths of the current path, each a list of points
+	path [][]Point2D
+}
+
+//Point2D is a point on a canvas, in pixels.
+type Point2D struct {
+	x, y float64
+}
+
+//CreateNewCanvas returns a white canvas of the given size, with black stroke and fill colors and lines one pixel wide.
+func CreateNewCanvas(w, h int) Canvas {
+
+	var c Canvas
+
+	c.img = image.NewRGBA(image.Rect(0, 0, w, h))
+	c.width = w
+	c.height = h
+	c.strokeColor = MakeColor(0, 0, 0)
+	c.fillColor = MakeColor(0, 0, 0)
+	c.lineWidth = 1.0
+
+	draw.Draw(c.img, c.img.Bounds(), &image.Uniform{MakeColor(255, 255, 255)}, image.Point{}, draw.Src)
+
+	return c
+}
+
+//MakeColor returns the opaque color with the given red, green and blue components.
+func MakeColor(r, g, b uint8) color.Color {
+	return color.RGBA{r, g, b, 255}
+}
+
+//SetStrokeColor sets the color of the lines drawn by Stroke.
+func (c *Canvas) SetStrokeColor(col color.Color) {
+	c.strokeColor = col
+}
+
+//SetFillColor sets the color used by Fill and ClearRect.
+func (c *Canvas) SetFillColor(col color.Color) {
+	c.fillColor = col
+}
+
+//SetLineWidth sets the width of the lines drawn by Stroke, in pixels.
+func (c *Canvas) SetLineWidth(w float64) {
+	c.lineWidth = w
+}
+
+//MoveTo starts a new subpath at x,y.
+func (c *Canvas) MoveTo(x, y float64) {
+	c.path = append(c.path, []Point2D{{x, y}})
+}
+
+//LineTo adds a line from the last point of the path to x,y. Without a current point it acts as MoveTo.
+func (c *Canvas) LineTo(x, y float64) {
+
+	if len(c.path) == 0 {
+		c.MoveTo(x, y)
+		return
+	}
+
+	last := len(c.path) - 1
+	c.path[last] = append(c.path[last], Point2D{x, y})
+}
+
+//Stroke draws the lines of the current path with the stroke color and line width, then clears the path.
+func (c *Canvas) Stroke() {
+
+	for _, subpath := range c.path {
+		for p := 1; p < len(subpath); p++ {
+			c.DrawLine(subpath[p-1], subpath[p])
+		}
+	}
+
+	c.path = nil
+}
+
+//DrawLine draws a straight line between two points with the stroke color, as a square brush of the line width moved along it.
+func (c *Canvas) DrawLine(from, to Point2D) {
+
+	steps := int(math.Ceil(math.Max(math.Abs(to.x-from.x), math.Abs(to.y-from.y))))
+	if steps == 0 {
+		steps = 1
+	}
+
+	half := c.lineWidth / 2
+
+	for s := 0; s <= steps; s++ {
+		t := float64(s) / float64(steps)
+		x := from.x + t*(to.x-from.x)
+		y := from.y + t*(to.y-from.y)
+
+		c.FillRectFloat(x-half, y-half, x+half, y+half, c.strokeColor)
+	}
+}
+
+//Fill fills the inside of the current path (closing each subpath, with the even-odd rule) with the fill color, then clears the path.
+func (c *Canvas) Fill() {
+
+	if len(c.path) == 0 {
+		return
+	}
+
+	//only the rows the path spans
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, subpath := range c.path {
+		for _, point := range subpath {
+			minY = math.Min(minY, point.y)
+			maxY = math.Max(maxY, point.y)
+		}
+	}
+
+	for py := int(math.Max(0, math.Floor(minY))); py < c.height && float64(py) <= maxY; py++ {
+
+		y := float64(py) + 0.5
+
+		//crossings of the scanline with the edges of the path
+		crossings := make([]float64, 0)
+
+		for _, subpath := range c.path {
+			for p := range subpath {
+				a := subpath[p]
+				b := subpath[(p+1)%len(subpath)]
+
+				if (a.y <= y && b.y > y) || (b.y <= y && a.y > y) {
+					crossings = append(crossings, a.x+(y-a.y)*(b.x-a.x)/(b.y-a.y))
+				}
+			}
+		}
+
+		sort.Float64s(crossings)
+
+		for k := 0; k+1 < len(crossings); k += 2 {
+			x1 := int(math.Ceil(crossings[k] - 0.5))
+			x2 := int(math.Ceil(crossings[k+1] - 0.5))
+			c.FillRect(x1, py, x2, py+1, c.fillColor)
+		}
+	}
+
+	c.path = nil
+}
+
+//ClearRect paints the pixels x1 <= x < x2, y1 <= y < y2 with the fill color.
+func (c *Canvas) ClearRect(x1, y1, x2, y2 int) {
+	c.FillRect(x1, y1, x2, y2, c.fillColor)
+}
+
+//FillRect paints the pixels x1 <= x < x2, y1 <= y < y2 with a color.
+func (c *Canvas) FillRect(x1, y1, x2, y2 int, col color.Color) {
+	draw.Draw(c.img, image.Rect(x1, y1, x2, y2), &image.Uniform{col}, image.Point{}, draw.Src)
+}
+
+//FillRectFloat paints the pixels whose centers lie in the rectangle from x1,y1 to x2,y2, and at least the pixel holding its center.
+func (c *Canvas) FillRectFloat(x1, y1, x2, y2 float64, col color.Color) {
+
+	px1 := int(math.Ceil(x1 - 0.5))
+	py1 := int(math.Ceil(y1 - 0.5))
+	px2 := int(math.Ceil(x2 - 0.5))
+	py2 := int(math.Ceil(y2 - 0.5))
+
+	if px2 <= px1 {
+		px1 = int(math.Floor((x1 + x2) / 2))
+		px2 = px1 + 1
+	}
+	if py2 <= py1 {
+		py1 = int(math.Floor((y1 + y2) / 2))
+		py2 = py1 + 1
+	}
+
+	c.FillRect(px1, py1, px2, py2, col)
+}
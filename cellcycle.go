@@ -0,0 +1,199 @@
+package main
+
+//CyclePhases lists the phases of the cell cycle in the order proliferative cells go through them. Quiescent cells are in "G0".
+var CyclePhases = []string{"G1", "S", "G2", "M"}
+
+//CycleConfig holds the settings of the cell cycle.
+//When enabled, proliferative cells only divide after completing M phase, and necrotic cells are cleared after NecroticLifetime.
+type CycleConfig struct {
+
+	//Enabled turns the cell cycle on
+	Enabled bool `json:"enabled"`
+
+	//Durations of each phase in generations, keyed by "G1", "S", "G2" and "M". A duration of 0 skips the phase.
+	Durations map[string]int `json:"durations"`
+
+	//NecroticLifetime is the number of generations after which necrotic cells ("N" and "wN") decay back to healthy tissue.
+	//0 keeps them forever.
+	NecroticLifetime int `json:"necroticLifetime"`
+}
+
+//DefaultCycleConfig returns a disabled cell cycle of five generations, G1 being the longest phase.
+func DefaultCycleConfig() CycleConfig {
+
+	var cycleConfig CycleConfig
+
+	cycleConfig.Enabled = false
+	cycleConfig.Durations = map[string]int{"G1": 2, "S": 1, "G2": 1, "M": 1}
+	cycleConfig.NecroticLifetime = 0
+
+	return cycleConfig
+}
+
+//GetNextPhase returns the phase that follows phase in CyclePhases (M is followed by G1).
+func GetNextPhase(phase string) string {
+
+	for i := range CyclePhases {
+		if CyclePhases[i] == phase {
+			return CyclePhases[(i+1)%len(CyclePhases)]
+		}
+	}
+
+	return "G1"
+}
+
+//SeedCellCycle2D spreads the living cancer cells of the matrix over the cycle at random, so that they do not divide in lockstep.
+//Quiescent cells start in G0.
+func SeedCellCycle2D(matrix Matrix2D, cycleConfig CycleConfig) Matrix2D {
+
+	cycleLength := 0
+	for _, phase := range CyclePhases {
+		cycleLength += cycleConfig.Durations[phase]
+	}
+
+	for i := range matrix {
+		for j := range matrix[i] {
+
+			if matrix[i][j].state == "C" {
+				matrix[i][j].phase = "G1"
+				matrix[i][j].phaseAge = 0
+
+				if cycleLength > 0 {
+					position := RNG.Intn(cycleLength)
+					for _, phase := range CyclePhases {
+						if position < cycleConfig.Durations[phase] {
+							matrix[i][j].phase = phase
+							matrix[i][j].phaseAge = position
+							break
+						}
+						position -= cycleConfig.Durations[phase]
+					}
+				}
+			} else if matrix[i][j].state == "Q" {
+				matrix[i][j].phase = "G0"
+			}
+		}
+	}
+
+	return matrix
+}
+
+//AdvanceCellCycle2D ages a cell by one generation given its state in the previous generation, prevCell, and its new state in newCell.
+//Proliferative cells move through G1, S and G2 and stop at the end of M, where they divide in PushAllCells2D.
+//Quiescent cells enter G0 and re-enter G1 when they become proliferative again. Necrotic cells decay after the necrotic lifetime.
+func AdvanceCellCycle2D(prevCell, newCell Cell2D, cycleConfig CycleConfig) Cell2D {
+
+	if newCell.state == "h" {
+		return newCell
+	}
+
+	newCell.age++
+
+	if newCell.state == "C" {
+
+		if newCell.phase == "" || newCell.phase == "G0" {
+			newCell.phase = "G1"
+			newCell.phaseAge = 0
+		} else {
+			newCell.phaseAge++
+		}
+
+		//skipping over completed (or zero-length) phases. M is left to PushAllCells2D.
+		for newCell.phase != "M" && newCell.phaseAge >= cycleConfig.Durations[newCell.phase] {
+			newCell.phaseAge -= cycleConfig.Durations[newCell.phase]
+			newCell.phase = GetNextPhase(newCell.phase)
+		}
+
+	} else if newCell.state == "Q" {
+
+		if newCell.phase == "G0" {
+			newCell.phaseAge++
+		} else {
+			newCell.phase = "G0"
+			newCell.phaseAge = 0
+		}
+
+	} else if newCell.state == "N" || newCell.state == "wN" {
+
+		//phaseAge counts the generations since necrosis
+		if prevCell.state != "N" && prevCell.state != "wN" {
+			newCell.phase = ""
+			newCell.phaseAge = 0
+		} else {
+			newCell.phaseAge++
+		}
+
+		if cycleConfig.NecroticLifetime > 0 && newCell.phaseAge >= cycleConfig.NecroticLifetime {
+			newCell = ClearCell2D(newCell, "h")
+		}
+	}
+
+	return newCell
+}
+
+//DividesNow2D returns true if a proliferative cell divides in this generation.
+//Without the cell cycle every proliferative cell divides; with it, only cells that have completed M phase do.
+func DividesNow2D(currCell Cell2D, cycleConfig CycleConfig) bool {
+
+	if cycleConfig.Enabled == false {
+		return true
+	}
+
+	return currCell.phase == "M" && currCell.phaseAge >= cycleConfig.Durations["M"]-1
+}
+
+//MoveCell2D copies the cell carried by src (its state, clone, age and cycle phase) into dst. The site properties of dst
+//(location, ECM and chemical fields) are kept.
+func MoveCell2D(dst *Cell2D, src Cell2D) {
+
+	dst.state = src.state
+	dst.clone = src.clone
+	dst.age = src.age
+	dst.phase = src.phase
+	dst.phaseAge = src.phaseAge
+}
+
+//ClearCell2D returns the site with a new cell of the given state at age zero, with no clone and no cycle phase.
+func ClearCell2D(currCell Cell2D, state string) Cell2D {
+
+	currCell.state = state
+	currCell.clone = 0
+	currCell.age = 0
+	currCell.phase = ""
+	currCell.phaseAge = 0
+
+	return currCell
+}
+
+//DivideCell2D places a daughter of the cancer cell at i,j on the site toX,toY. The daughter inherits the clone of its mother,
+//and both restart the cycle in G1.
+func DivideCell2D(pushedMatrix Matrix2D, i, j, toX, toY int, cycleConfig CycleConfig) {
+
+	pushedMatrix[toX][toY] = ClearCell2D(pushedMatrix[toX][toY], "C")
+	pushedMatrix[toX][toY].clone = pushedMatrix[i][j].clone
+
+	if cycleConfig.Enabled == true {
+		pushedMatrix[toX][toY].phase = "G1"
+
+		pushedMatrix[i][j].phase = "G1"
+		pushedMatrix[i][j].phaseAge = 0
+	}
+}
+
+//GetPhaseCounts2D counts the cells of a matrix in each cycle phase. Necrotic cells are counted under "N".
+func GetPhaseCounts2D(matrix Matrix2D) map[string]int {
+
+	counts := make(map[string]int)
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			if matrix[i][j].state == "C" || matrix[i][j].state == "Q" {
+				counts[matrix[i][j].phase]++
+			} else if matrix[i][j].state == "N" {
+				counts["N"]++
+			}
+		}
+	}
+
+	return counts
+}
@@ -2,10 +2,10 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
+	"log"
+	"math"
 	"os"
 	"strconv"
-	"time"
 )
 
 //Read the readme.pdf for operation
@@ -28,6 +28,23 @@ type Cell2D struct {
 
 	//Probability of N, A, C, Q
 	pNecrosis, pProliferation, pQuiescent float64
+
+	//Extracellular matrix density at this site, in [0,1]
+	ecm float64
+
+	//Concentrations of the chemical fields at this site, in the order of Config.Chemicals
+	chemicals []float64
+
+	//Age of the cell in generations, its cell cycle phase ("G1", "S", "G2", "M", "G0") and the generations spent in that phase.
+	//For necrotic cells phaseAge counts the generations since necrosis.
+	age, phaseAge int
+	phase         string
+
+	//Mechanical pressure at this site, the fraction of occupied sites around it
+	pressure float64
+
+	//Clone (lineage) of the cell: cells of one seed and all their progeny share a clone
+	clone int
 }
 
 //Matrix2D is a 2 dimensional slice of Cells.
@@ -51,9 +68,6 @@ type OrderedPair struct {
 //Noah Chang--------------------------------------------------------------------
 func main() {
 
-	//seeding PRNG
-	rand.Seed(time.Now().UTC().UnixNano())
-
 	//2D Cellular automata
 	if os.Args[1] == "2D" {
 
@@ -64,15 +78,24 @@ func main() {
 
 		//numGens - can be very high number
 		numGens, _ := strconv.Atoi(os.Args[2])
-		//Kcc = 3.0 recommended, per literature
-		KccINT, _ := strconv.Atoi(os.Args[3])
-		Kcc := float64(KccINT)
-		//Knn = 3.0 recommended, per literature
-		KnnINT, _ := strconv.Atoi(os.Args[4])
-		Knn := float64(KnnINT)
-		//Knc = 1.0 recommended, per literature ; similar cells have stronger adhesion
-		KncINT, _ := strconv.Atoi(os.Args[5])
-		Knc := float64(KncINT)
+		//Kcc = 3.0, Knn = 3.0 and Knc = 1.0 recommended, per literature ; similar cells have stronger adhesion
+		Kcc, Knn, Knc := ParseCouplingConstants(os.Args[3:6])
+
+		//optional flags follow the positional arguments
+		optionsStart := 7
+		if os.Args[6] == "yes" {
+			optionsStart = 8
+		}
+		options := ParseOptions(os.Args[optionsStart:])
+		config := ReadConfig(options.configFile)
+
+		//seeding PRNG
+		fmt.Println("Random seed " + strconv.FormatInt(SeedRandom(options.seed), 10))
+
+		err := SetupRunDirectory(options.outputDir, options.overwrite)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		fmt.Println("***************************")
 
@@ -88,18 +111,13 @@ func main() {
 
 			fmt.Println("Playing automata....")
 
-			timepoints := Generate2DMatrices(numGens, x, y, Kcc, Knn, Knc)
-
-			// produce animated GIF corresponding to automaton
-
-			imglist := DrawMatrices(timepoints, cellWidth, x, y)
-
-			outputFile := "growth"
-
-			ImagesToGIF(imglist, outputFile)
-
-			//Outputting CSV files for R input
-			OutputFile2DinCSV(timepoints)
+			timepoints, err := Generate2DMatrices(numGens, x, y, Kcc, Knn, Knc, config)
+			if err == nil {
+				err = OutputGrowth2D(timepoints, 0, cellWidth, config, options)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
 
 		}
 
@@ -107,21 +125,63 @@ func main() {
 		if os.Args[6] == "yes" {
 			fmt.Println("Playing automata with metastasis....")
 
+			if config.Checkpoint.Every > 0 {
+				fmt.Println("Checkpoints are not written for runs with metastasis, which cannot be resumed")
+			}
+
 			seedType := os.Args[7]
 
-			timepoints, metaSlice := Generate2DMatricesMetastasis(numGens, x, y, Kcc, Knn, Knc, seedType)
+			timepoints, results, err := Generate2DMatricesMetastasis(numGens, x, y, Kcc, Knn, Knc, seedType, config)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			imglist := DrawMatrices(timepoints, cellWidth, x, y, config.Palette)
 
-			imglist := DrawMatrices(timepoints, cellWidth, x, y)
+			if config.Overlay.Enabled == true {
+				imglist = OverlayFrames2D(imglist, timepoints, cellWidth, config.Overlay, config.Palette)
+			}
 
 			outputFile := "growth"
 
-			ImagesToGIF(imglist, outputFile)
+			err = WriteAnimation(imglist, outputFile, options)
 
 			//Outputting CSV files for R input
-			OutputFile2DinCSV(timepoints)
+			if err == nil {
+				err = OutputFile2DinCSV(timepoints, 0)
+			}
 
 			//Outputting a CSV file for counting the number of cells metastasized
-			OutputFileMetastasisInCSV(metaSlice)
+			if err == nil {
+				err = OutputFileMetastasisInCSV(results.metaSlice, GetOrganNames(config.Metastasis))
+			}
+
+			//Outputting the log of every intravasation event and the summary of the run
+			if err == nil {
+				err = OutputEventLog(results, GetOrganNames(config.Metastasis))
+			}
+
+			//Outputting the tumour burden of the primary and secondary sites
+			if err == nil && config.Metastasis.Secondary.Enabled == true {
+				err = OutputFileBurdenInCSV(timepoints, results.sites)
+			}
+
+			//Outputting the circulating tumour cells
+			if err == nil && config.Metastasis.Circulation.Enabled == true {
+				err = OutputFileCirculationInCSV(results.ctcCounts)
+			}
+
+			if err == nil && config.Cycle.Enabled == true {
+				err = OutputFileCyclePhasesInCSV(timepoints, 0)
+			}
+
+			if err == nil && config.SVG.Enabled == true {
+				err = OutputSVG2D(timepoints, 0, config.SVG, config.Palette)
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
 
 			//Code used to draw "set" metaBoard---------------------------------------
 			// metaBoard := GenerateMetastasisBoard2D(timepoints[0])
@@ -134,6 +194,11 @@ func main() {
 			// ImagesToGIF(imgSlice, "metaBoard")
 			//------------------------------------------------------------------------
 		}
+
+		err = WriteManifest()
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	//3D Cellular Automata
@@ -141,40 +206,270 @@ func main() {
 
 		//numGens lower than 33 recommended
 		numGens, _ := strconv.Atoi(os.Args[2])
-		//Kcc = 3.0 recommended, per literature
-		KccINT, _ := strconv.Atoi(os.Args[3])
-		Kcc := float64(KccINT)
-		//Knn = 3.0 recommended, per literature
-		KnnINT, _ := strconv.Atoi(os.Args[4])
-		Knn := float64(KnnINT)
-		//Knc = 1.0 recommended, per literature
-		KncINT, _ := strconv.Atoi(os.Args[5])
-		Knc := float64(KncINT)
-		//Running...
-		timepoints := GenerateMatrices(Initialize3DMatrix(100, 100, 100), numGens, Kcc, Knn, Knc)
-		//Generating CSV for R input
-		OutputFile3DinCSV(timepoints)
+		//Kcc = 3.0, Knn = 3.0 and Knc = 1.0 recommended, per literature
+		Kcc, Knn, Knc := ParseCouplingConstants(os.Args[3:6])
+		//metastasis is optional in 3D: "yes" followed by the vessel seed type, or "no"
+		metastasis := len(os.Args) > 6 && os.Args[6] == "yes"
+		//optional flags follow the positional arguments
+		optionsStart := 6
+		if metastasis == true {
+			optionsStart = 8
+		} else if len(os.Args) > 6 && os.Args[6] == "no" {
+			optionsStart = 7
+		}
+		options := ParseOptions(os.Args[optionsStart:])
+		config := ReadConfig(options.configFile)
+
+		fmt.Println("Random seed " + strconv.FormatInt(SeedRandom(options.seed), 10))
+
+		err := SetupRunDirectory(options.outputDir, options.overwrite)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var timepoints []Matrix
+
+		if metastasis == false {
+			//Running...
+			timepoints, err = GenerateMatrices(Initialize3DMatrix(100, 100, 100), numGens, Kcc, Knn, Knc, config)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			fmt.Println("Playing 3D automata with metastasis....")
+
+			if config.Checkpoint.Every > 0 {
+				fmt.Println("Checkpoints are not written for runs with metastasis, which cannot be resumed")
+			}
+
+			seedType := os.Args[7]
+
+			var results MetastasisResults
+			timepoints, results, err = GenerateMatricesMetastasis(Initialize3DMatrix(100, 100, 100), numGens, Kcc, Knn, Knc, seedType, config)
+
+			//Outputting CSV files of the cells metastasized, the log of every intravasation event and the summary of the run
+			if err == nil {
+				err = OutputFileMetastasisInCSV(results.metaSlice, GetOrganNames(config.Metastasis))
+			}
+			if err == nil {
+				err = OutputEventLog(results, GetOrganNames(config.Metastasis))
+			}
+
+			//Outputting the circulating tumour cells
+			if err == nil && config.Metastasis.Circulation.Enabled == true {
+				err = OutputFileCirculationInCSV(results.ctcCounts)
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		err = OutputGrowth3D(timepoints, 0, config, options)
+		if err == nil {
+			err = WriteManifest()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//Live viewer: the simulation runs in a local web server that streams every generation to the browser
+	if os.Args[1] == "live" {
+
+		fmt.Println("Live viewer of the automata in " + os.Args[2])
+
+		//dimension, "2D" or "3D"
+		dimension := os.Args[2]
+		numGens, _ := strconv.Atoi(os.Args[3])
+		Kcc, Knn, Knc := ParseCouplingConstants(os.Args[4:7])
+
+		options := ParseOptions(os.Args[7:])
+		config := ReadConfig(options.configFile)
+
+		SeedRandom(options.seed)
+
+		server := NewLiveServer(dimension, numGens, Kcc, Knn, Knc, config)
+		server.Serve(options.addr, options.fps)
+	}
+
+	//Terminal view: the simulation is drawn in the terminal after every generation, for runs over SSH
+	if os.Args[1] == "tui" {
+
+		//dimension, "2D" or "3D"
+		dimension := os.Args[2]
+		numGens, _ := strconv.Atoi(os.Args[3])
+		Kcc, Knn, Knc := ParseCouplingConstants(os.Args[4:7])
+
+		options := ParseOptions(os.Args[7:])
+		config := ReadConfig(options.configFile)
+
+		SeedRandom(options.seed)
+
+		view := NewTerminalView(dimension, numGens, Kcc, Knn, Knc, config)
+		view.Run(options.fps)
+	}
+
+	//Resuming a run from a checkpoint snapshot for numGens more generations, drawing the same random numbers as the run that wrote it
+	if os.Args[1] == "resume" {
+
+		snapshot := ReadSnapshot(os.Args[2])
+		numGens, _ := strconv.Atoi(os.Args[3])
+
+		options := ParseOptions(os.Args[4:])
+
+		//the settings of the snapshot, unless a config file replaces them (for other outputs or checkpoints)
+		config := snapshot.config
+		if options.configFile != "" {
+			fmt.Println("Resuming with the settings of " + options.configFile + " instead of those of the snapshot")
+			config = ReadConfig(options.configFile)
+		}
+
+		//a new seed branches the run off from the snapshot
+		if options.seed != 0 {
+			SeedRandom(options.seed)
+		} else {
+			RestoreRandom(snapshot.seed, snapshot.randomState)
+		}
+
+		fmt.Println("Resuming the " + strconv.Itoa(snapshot.dimension) + "D automata at generation " + strconv.Itoa(snapshot.generation))
+
+		err := SetupRunDirectory(options.outputDir, options.overwrite)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		//the frames are labelled with the generations of the whole run
+		config.Overlay.firstGeneration = snapshot.generation
+
+		if snapshot.dimension == 2 {
+			var timepoints []Matrix2D
+			timepoints, err = ContinueMatrices2D(snapshot.matrix2D, snapshot.generation, numGens, snapshot.Kcc, snapshot.Knn, snapshot.Knc, config)
+			if err == nil {
+				err = OutputGrowth2D(timepoints, snapshot.generation, 1, config, options)
+			}
+		} else {
+			var timepoints []Matrix
+			timepoints, err = ContinueMatrices(snapshot.matrix3D, snapshot.generation, numGens, snapshot.Kcc, snapshot.Knn, snapshot.Knc, config)
+			if err == nil {
+				err = OutputGrowth3D(timepoints, snapshot.generation, config, options)
+			}
+		}
+
+		if err == nil {
+			err = WriteManifest()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	//2D Gif generation after R ggplot2
 	if os.Args[1] == "gif2D" {
 		fmt.Println("2D GIF generation")
+		options := ParseOptions(os.Args[2:])
+
+		//the plots are read from, and the animation written to, the run directory given with -out, or else the latest run
+		err := OpenRunDirectory(options.outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		dir := GetNewFolderDir("outputcsv2D")
 		imglist := ReadPNGs(dir)
-		ImagesToGIF(imglist, "ggplot")
+		err = WriteAnimation(imglist, "ggplot", options)
+		if err == nil {
+			err = WriteManifest()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	//3D Gif generation after R plot3D
 	if os.Args[1] == "gif3D" {
 		fmt.Println("3D GIF generation")
+		options := ParseOptions(os.Args[2:])
+
+		//the plots are read from, and the animation written to, the run directory given with -out, or else the latest run
+		err := OpenRunDirectory(options.outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		dir := GetNewFolderDir("outputcsv3D")
 		imglist := ReadPNGs(dir)
-		ImagesToGIF(imglist, "ggplot3D")
+		err = WriteAnimation(imglist, "ggplot3D", options)
+		if err == nil {
+			err = WriteManifest()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
 //------------------------------------------------------------------------------
 
+//ParseCouplingConstants reads Kcc, Knn and Knc from the command line, the same way in every mode, and stops the program
+//if one is not a number.
+func ParseCouplingConstants(args []string) (float64, float64, float64) {
+
+	K := make([]float64, 3)
+
+	for i := range K {
+		value, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			log.Fatal("Coupling constant " + args[i] + " is not a number")
+		}
+		K[i] = value
+	}
+
+	return K[0], K[1], K[2]
+}
+
+//OutputGrowth2D writes the animation, CSV files and drawings of a 2D run without metastasis whose first matrix is of generation
+//firstGeneration, returning the first error of the animation and CSV files.
+func OutputGrowth2D(timepoints []Matrix2D, firstGeneration, cellWidth int, config Config, options Options) error {
+
+	// produce animated GIF corresponding to automaton
+
+	imglist := DrawMatrices(timepoints, cellWidth, GetNumRows2D(timepoints[0]), GetNumCols2D(timepoints[0]), config.Palette)
+
+	if config.Overlay.Enabled == true {
+		imglist = OverlayFrames2D(imglist, timepoints, cellWidth, config.Overlay, config.Palette)
+	}
+
+	outputFile := "growth"
+
+	err := WriteAnimation(imglist, outputFile, options)
+	if err != nil {
+		return err
+	}
+
+	//Outputting CSV files for R input
+	err = OutputFile2DinCSV(timepoints, firstGeneration)
+	if err != nil {
+		return err
+	}
+
+	if config.Cycle.Enabled == true {
+		err = OutputFileCyclePhasesInCSV(timepoints, firstGeneration)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.SVG.Enabled == true {
+		err = OutputSVG2D(timepoints, firstGeneration, config.SVG, config.Palette)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 //GetCentralCell2D takes in a matrix board and returns the cell at the middle of the board (2D).
 func GetCentralCell2D(currMatrix Matrix2D) Cell2D { //gets cell at center of matrix. Will be used for seeding.
 
@@ -189,63 +484,100 @@ func GetCentralCell2D(currMatrix Matrix2D) Cell2D { //gets cell at center of mat
 }
 
 // Generate2DMatrices is the main function of this model, this function generates numGens number of matrices for plotting according to the Lattice Gas Cellular
-// Automata model. X,y are board dimensions, and Ks are coupling constants.
-func Generate2DMatrices(numGens int, x, y int, Kcc, Knn, Knc float64) []Matrix2D {
+// Automata model. X,y are board dimensions, Ks are coupling constants, and config holds the optional model settings.
+func Generate2DMatrices(numGens int, x, y int, Kcc, Knn, Knc float64, config Config) ([]Matrix2D, error) {
+
+	//first matrix will be initialized and seeded...
+	return ContinueMatrices2D(InitialMatrix2D(x, y, config), 0, numGens, Kcc, Knn, Knc, config)
+}
+
+//ContinueMatrices2D runs numGens generations on from first, the matrix of generation start, writing the exports and checkpoints asked for in config.
+//It returns numGens+1 matrices, the first being first, or the first error met when writing the exports and checkpoints.
+func ContinueMatrices2D(first Matrix2D, start, numGens int, Kcc, Knn, Knc float64, config Config) ([]Matrix2D, error) {
 
 	//creating slice of number of desired matrices
 	matrices := make([]Matrix2D, numGens+1)
 
-	//first matrix will be initialized...
-	matrices[0] = Initialize2DMatrix(x, y)
+	matrices[0] = first
+	err := ExportGeneration(first, nil, start, start, Kcc, Knn, Knc, config)
+	if err != nil {
+		return nil, err
+	}
 
-	//seeding with cancerous cells at center.
-	centerCell := GetCentralCell2D(matrices[0])
+	//Updating generations of matrices
+	for m := 1; m <= numGens; m++ {
+		fmt.Println("Updating " + strconv.Itoa(start+m) + "th generation...")
+		matrices[m] = Update2DMatrix(matrices[m-1], Kcc, Knn, Knc, config)
 
-	cellNhd := GetCurrentNeighborhood2D(matrices[0], centerCell.location.x, centerCell.location.y, x, y)
+		err = ExportGeneration(matrices[m], nil, start+m, start, Kcc, Knn, Knc, config)
+		if err == nil {
+			err = WriteCheckpoint(matrices[m], nil, start+m, Kcc, Knn, Knc, config)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	for n := range cellNhd.neighbors { //of all neighbors to given cell...
+	return matrices, nil
+}
 
-		matrices[0][cellNhd.neighbors[n].location.x][cellNhd.neighbors[n].location.y].state = "C"
+//InitialMatrix2D returns the first matrix of a simulation: a x by y board seeded with the central diamond of cancerous cells
+//(or the seeds given in config), with its microenvironment and cell cycle set up.
+func InitialMatrix2D(x, y int, config Config) Matrix2D {
 
-		i := cellNhd.neighbors[n].location.x
-		j := cellNhd.neighbors[n].location.y
+	matrix := Initialize2DMatrix(x, y)
 
-		//...get the neighborhood of that cell
-		neighborNhd := GetCurrentNeighborhood2D(matrices[0], i, j, x, y)
+	if len(config.Seeds) == 0 {
+		matrix = SeedCentralDiamond2D(matrix)
+	} else {
+		matrix = SeedInitialConditions2D(matrix, config.Seeds)
+	}
 
-		//meta step: ranging over neighborhood of that original cell's neighbors.
-		for m := range neighborNhd.neighbors {
-			matrices[0][neighborNhd.neighbors[m].location.x][neighborNhd.neighbors[m].location.y].state = "C"
+	//laying down the extracellular matrix and chemical fields
+	matrix = SeedMicroenvironment2D(matrix, config)
 
-		}
+	if config.Cycle.Enabled == true {
+		matrix = SeedCellCycle2D(matrix, config.Cycle)
 	}
 
-	matrices[0][centerCell.location.x][centerCell.location.y].state = "C"
+	return matrix
+}
+
+//SeedMicroenvironment2D sets the initial ECM density, chemical fields and pressure of a matrix as given in config.
+func SeedMicroenvironment2D(matrix Matrix2D, config Config) Matrix2D {
 
-	//Updating generations of matrices
-	for m := 1; m <= numGens; m++ {
-		fmt.Println("Updating " + strconv.Itoa(m) + "th generation...")
-		matrices[m] = Update2DMatrix(matrices[m-1], Kcc, Knn, Knc)
+	if config.ECM.Enabled == true {
+		matrix = SeedECM2D(matrix, config.ECM)
+	}
 
+	if len(config.Chemicals) > 0 {
+		matrix = SeedChemicals2D(matrix, config.Chemicals)
 	}
 
-	return matrices
+	if config.Mechanics.Enabled == true {
+		matrix = UpdatePressure2D(matrix, config.Mechanics.PressureRadius)
+	}
+
+	return matrix
 }
 
 // Update2DMatrix takes in one matrix and coupling constants and returns a matrix of updated:
 // 1) states (i.e., cancer cells can either stay proliferative, turn quiescent (and vice versa), or die) per lattice-gas/Boltzmann probability model.
 // 2) velocities based on rules for necrotic of cancerous neighbors
-func Update2DMatrix(currMatrix Matrix2D, Kcc, Knn, Knc float64) Matrix2D { //returns updated matrix (doesn't edit old one since we want to plot all!)
+// 3) extracellular matrix density, degraded by cancer cells (if enabled in config)
+// 4) chemical fields, secreted and taken up by cells, decaying and diffusing (if any are listed in config)
+// 5) mechanical pressure from crowding (if enabled in config)
+func Update2DMatrix(currMatrix Matrix2D, Kcc, Knn, Knc float64, config Config) Matrix2D { //returns updated matrix (doesn't edit old one since we want to plot all!)
 
 	x := GetNumRows2D(currMatrix)
 
 	y := GetNumCols2D(currMatrix)
 
 	//updating cell states based upon probabilities calculated using prior matrix. This will update each cell such that cells are currently cancerous.
-	statesMatrix := UpdateMatrixStates2D(currMatrix, x, y, Kcc, Knn, Knc) //
+	statesMatrix := UpdateMatrixStates2D(currMatrix, x, y, Kcc, Knn, Knc, config) //
 
 	// updating cell velocities (transport step) based on rules for necrotic and cancerous cells in neighborhood.
-	velocitiesMatrix := UpdateMatrixVelocities2D(statesMatrix, x, y) //, freshMatrix
+	velocitiesMatrix := UpdateMatrixVelocities2D(statesMatrix, x, y, config) //, freshMatrix
 
 	//now that states and velocities at each cell are reflected in freshMatrix, it's time to proliferate cells if applicable.
 	readyMatrix := Initialize2DMatrix(x, y)
@@ -253,13 +585,27 @@ func Update2DMatrix(currMatrix Matrix2D, Kcc, Knn, Knc float64) Matrix2D { //ret
 	readyMatrix = velocitiesMatrix
 
 	//and push the cells according to the pushing rules
-	pushedMatrix := PushAllCells2D(readyMatrix, x, y)
+	pushedMatrix := PushAllCells2D(readyMatrix, x, y, config)
+
+	//cancer cells secrete MMPs that break down the ECM around them
+	if config.ECM.Enabled == true {
+		pushedMatrix = DegradeECM2D(pushedMatrix, config.ECM)
+	}
+
+	if len(config.Chemicals) > 0 {
+		pushedMatrix = UpdateChemicals2D(currMatrix, pushedMatrix, config.Chemicals)
+	}
+
+	if config.Mechanics.Enabled == true {
+		pushedMatrix = UpdatePressure2D(pushedMatrix, config.Mechanics.PressureRadius)
+	}
 
 	return pushedMatrix
 }
 
-//UpdateMatrixStates2D updates the states of the cells using UpdateOneCellState2D subroutine
-func UpdateMatrixStates2D(currMatrix Matrix2D, x, y int, Kcc, Knn, Knc float64) Matrix2D {
+//UpdateMatrixStates2D updates the states of the cells using UpdateOneCellState2D subroutine, and ages them through the cell cycle if enabled.
+//Every site starts as a copy of currMatrix, so the margin outside the field keeps its ECM, chemicals and pressure.
+func UpdateMatrixStates2D(currMatrix Matrix2D, x, y int, Kcc, Knn, Knc float64, config Config) Matrix2D {
 
 	statesMatrix := Initialize2DMatrix(x, y)
 
@@ -267,8 +613,9 @@ func UpdateMatrixStates2D(currMatrix Matrix2D, x, y int, Kcc, Knn, Knc float64)
 
 		for j := range currMatrix[i] {
 
+			statesMatrix[i][j] = currMatrix[i][j]
+
 			if InField2D(i, j, x, y) == true {
-				statesMatrix[i][j] = currMatrix[i][j]
 
 				//if cell is a living cancer cell, we update to C (will propagate/proliferate), or Q (quiescent; still alive, but will not progagate), or N (cell dies.)
 				if currMatrix[i][j].state == "C" || currMatrix[i][j].state == "Q" {
@@ -276,6 +623,17 @@ func UpdateMatrixStates2D(currMatrix Matrix2D, x, y int, Kcc, Knn, Knc float64)
 					// updating cell states in new matrix based on current states (of prev matrix)
 					statesMatrix[i][j] = UpdateOneCellState2D(currMatrix, i, j, Kcc, Knn, Knc)
 				}
+
+				//crowded cells stop proliferating
+				if config.Mechanics.Enabled == true {
+					statesMatrix[i][j] = ApplyContactInhibition2D(currMatrix[i][j], statesMatrix[i][j], config.Mechanics)
+				}
+
+				if config.Cycle.Enabled == true {
+					statesMatrix[i][j] = AdvanceCellCycle2D(currMatrix[i][j], statesMatrix[i][j], config.Cycle)
+				}
+			} else {
+				statesMatrix[i][j] = ClearMarginCell2D(currMatrix[i][j])
 			}
 		}
 	}
@@ -283,6 +641,20 @@ func UpdateMatrixStates2D(currMatrix Matrix2D, x, y int, Kcc, Knn, Knc float64)
 	return statesMatrix
 }
 
+//ClearMarginCell2D empties a site outside the field of its cell, since cells pushed there are lost as in the original model.
+//The ECM, chemicals and pressure of the site are kept.
+func ClearMarginCell2D(currCell Cell2D) Cell2D {
+
+	marginCell := ClearCell2D(currCell, "h")
+
+	marginCell.velocityDirection = OrderedPair{}
+	marginCell.pNecrosis = 0
+	marginCell.pProliferation = 0
+	marginCell.pQuiescent = 0
+
+	return marginCell
+}
+
 //UpdateOneCellState2D updates cell states based on previous probabilities and adds current probabilities to Cell2D struct
 func UpdateOneCellState2D(currMatrix Matrix2D, i, j int, Kcc, Knn, Knc float64) Cell2D {
 
@@ -348,7 +720,7 @@ func GetMaxP(allP []float64) float64 {
 }
 
 //UpdateMatrixVelocities2D updates the Matrix2D by utilizing subroutine that updates one cell
-func UpdateMatrixVelocities2D(statesMatrix Matrix2D, x, y int) Matrix2D {
+func UpdateMatrixVelocities2D(statesMatrix Matrix2D, x, y int, config Config) Matrix2D {
 
 	velocitiesMatrix := Initialize2DMatrix(x, y)
 
@@ -359,9 +731,11 @@ func UpdateMatrixVelocities2D(statesMatrix Matrix2D, x, y int) Matrix2D {
 
 		for j := range statesMatrix[i] {
 
+			velocitiesMatrix[i][j] = statesMatrix[i][j]
+
 			if InField2D(i, j, numRows, numCols) == true {
 
-				velocitiesMatrix[i][j] = UpdateOneCellVelocity2D(statesMatrix, i, j) // updating cell states
+				velocitiesMatrix[i][j] = UpdateOneCellVelocity2D(statesMatrix, i, j, config) // updating cell states
 			}
 		}
 	}
@@ -370,7 +744,7 @@ func UpdateMatrixVelocities2D(statesMatrix Matrix2D, x, y int) Matrix2D {
 }
 
 //UpdateOneCellVelocity2D updates the velocity direction of a cell
-func UpdateOneCellVelocity2D(statesMatrix Matrix2D, i, j int) Cell2D {
+func UpdateOneCellVelocity2D(statesMatrix Matrix2D, i, j int, config Config) Cell2D {
 	//should indicate direction. magnitude assumed to be 1 for now.
 
 	currCell := statesMatrix[i][j]
@@ -383,18 +757,23 @@ func UpdateOneCellVelocity2D(statesMatrix Matrix2D, i, j int) Cell2D {
 		//if PROLIFERATIVE cancerous cell (C), then velocity vector should point at the direction of least (C+Q) cells..
 		if currCell.state == "C" {
 
-			minCNeighborCoord := GetMinCNeighborDirection2D(statesMatrix, i, j)
+			minCNeighborCoord := GetMinCNeighborDirection2D(statesMatrix, i, j, config)
 
 			//set velocity vector to point to direction of neighbor least-dense with cancer cells.
 			currCell.velocityDirection = minCNeighborCoord
 
-		} else if currCell.state == "N" {
+		} else if currCell.state == "N" && HasTaxisRules(config, "N") == false {
 
 			maxNNeighborCoord := GetMaxNNeighborDirection2D(statesMatrix, i, j)
 
 			//set velocity vector to point to neighbor with most necrosis in its neighborhood.
 			currCell.velocityDirection = maxNNeighborCoord
 
+		} else if IsMigratory2D(currCell, config) == true {
+
+			//necrotic (and e.g. immune) cells with taxis rules follow the gradients of their chemical fields instead.
+			currCell.velocityDirection = GetMaxTaxisNeighborDirection2D(statesMatrix, i, j, config)
+
 		} else {
 			currCell.velocityDirection.x = currCell.location.x
 			currCell.velocityDirection.x = currCell.location.y
@@ -403,29 +782,24 @@ func UpdateOneCellVelocity2D(statesMatrix Matrix2D, i, j int) Cell2D {
 	return currCell
 }
 
+//IsMigratory2D returns true if the cell moves by chemotaxis, i.e. it has taxis rules and is neither cancerous nor healthy tissue.
+func IsMigratory2D(currCell Cell2D, config Config) bool {
+
+	if currCell.state == "C" || currCell.state == "Q" || currCell.state == "h" || currCell.state == "wN" {
+		return false
+	}
+
+	return HasTaxisRules(config, currCell.state)
+}
+
 //GetMaxNNeighborDirection2D retreives coordinates of cell neighbor to i,j with its neighborhood as most-dense in N.
 func GetMaxNNeighborDirection2D(currMatrix Matrix2D, i, j int) OrderedPair {
 
-	numRows := GetNumRows2D(currMatrix)
-	numCols := GetNumCols2D(currMatrix)
-
 	//ranging over all neighboring cells to see which neighbor is itself surrounded by fewest cancer cells.
 
 	//Noah Chang------------------------------------------------------------------
 	//Debugged here for handling the edges
-	neighborhoods := make([]Neighborhood2D, 0)
-	if InField2D(i+2, j, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i+2, j, numRows, numCols))
-	}
-	if InField2D(i-2, j, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i-2, j, numRows, numCols))
-	}
-	if InField2D(i, j+2, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i, j+2, numRows, numCols))
-	}
-	if InField2D(i, j-2, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i, j-2, numRows, numCols))
-	}
+	neighborhoods := GetSurroundingNeighborhoods2D(currMatrix, i, j)
 	//----------------------------------------------------------------------------
 
 	var maxNcoords OrderedPair
@@ -438,15 +812,15 @@ func GetMaxNNeighborDirection2D(currMatrix Matrix2D, i, j int) OrderedPair {
 
 		if currCountN > maxCountN { //if a new MINIMUM is found, set coordinates (this is where we WANT a cancerous cell to go).
 
-			maxNcoords.x = neighborhoods[i].neighbors[rand.Intn(len(neighborhoods))].location.x
-			maxNcoords.y = neighborhoods[i].neighbors[rand.Intn(len(neighborhoods))].location.y
+			maxNcoords.x = neighborhoods[i].neighbors[RNG.Intn(len(neighborhoods))].location.x
+			maxNcoords.y = neighborhoods[i].neighbors[RNG.Intn(len(neighborhoods))].location.y
 
 		} else if currCountN == maxCountN {
 
 			maxCountN = currCountN // TIEBREAKING: we take at random the maximum N count.
 
-			maxNcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.x
-			maxNcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.y
+			maxNcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.x
+			maxNcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.y
 
 		}
 	}
@@ -456,7 +830,12 @@ func GetMaxNNeighborDirection2D(currMatrix Matrix2D, i, j int) OrderedPair {
 }
 
 //GetMinCNeighborDirection2D returns coordinates of neighbor of cell with minimum cancer density by ranging over the neighborhoods OF the neighbors to the given cell at position i,j
-func GetMinCNeighborDirection2D(currMatrix Matrix2D, i, j int) OrderedPair {
+//If the ECM is enabled or cancer cells have taxis rules, the direction is chosen by GetMinCTaxisNeighborDirection2D instead.
+func GetMinCNeighborDirection2D(currMatrix Matrix2D, i, j int, config Config) OrderedPair {
+
+	if config.ECM.Enabled == true || HasTaxisRules(config, "C") == true {
+		return GetMinCTaxisNeighborDirection2D(currMatrix, i, j, config)
+	}
 
 	numRows := GetNumRows2D(currMatrix)
 	numCols := GetNumCols2D(currMatrix)
@@ -468,36 +847,24 @@ func GetMinCNeighborDirection2D(currMatrix Matrix2D, i, j int) OrderedPair {
 	minCountC := float64(numRows * numCols) // make a large number out of cubed dimensions of matrix
 
 	//Noah Chang------------------------------------------------------------------
-	neighborhoods := make([]Neighborhood2D, 0)
-	if InField2D(i+2, j, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i+2, j, numRows, numCols))
-	}
-	if InField2D(i-2, j, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i-2, j, numRows, numCols))
-	}
-	if InField2D(i, j+2, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i, j+2, numRows, numCols))
-	}
-	if InField2D(i, j-2, numRows, numCols) == true {
-		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i, j-2, numRows, numCols))
-	}
+	neighborhoods := GetSurroundingNeighborhoods2D(currMatrix, i, j)
 	//----------------------------------------------------------------------------
 
-	for i := range neighborhoods { //ranging over surrounding nhds.
+	for n := range neighborhoods { //ranging over surrounding nhds.
 
-		currCountC := GetNumCancerous2D(neighborhoods[i])
+		currCountC := GetNumCancerous2D(neighborhoods[n])
 
 		if currCountC < minCountC { //if a new MINIMUM is found, set coordinates (this is where we WANT a cancerous cell to go).
 
-			minCcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods))].location.x
-			minCcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods))].location.y
+			minCcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods))].location.x
+			minCcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods))].location.y
 
 		} else if currCountC == minCountC {
 
 			minCountC = currCountC // TIEBREAKING: we take at random the maximum N count.
 
-			minCcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.x
-			minCcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.y
+			minCcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[n].neighbors))].location.x
+			minCcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[n].neighbors))].location.y
 
 		}
 
@@ -507,8 +874,51 @@ func GetMinCNeighborDirection2D(currMatrix Matrix2D, i, j int) OrderedPair {
 
 }
 
+//GetMinCTaxisNeighborDirection2D returns coordinates of a neighbor of the surrounding neighborhood with the lowest cancer density,
+//offset by its ECM density weighted by the haptotaxis coefficient (if the ECM is enabled) and by the taxis rules for cancer cells.
+//Ties are broken uniformly at random.
+func GetMinCTaxisNeighborDirection2D(currMatrix Matrix2D, i, j int, config Config) OrderedPair {
+
+	neighborhoods := GetSurroundingNeighborhoods2D(currMatrix, i, j)
+
+	var minCcoords OrderedPair
+
+	minScore := math.Inf(1)
+
+	//number of neighborhoods tied at the current minimum
+	numTies := 0
+
+	for n := range neighborhoods {
+
+		currScore := GetNumCancerous2D(neighborhoods[n])
+
+		//haptotaxis: cells are drawn along (or away from) ECM density
+		if config.ECM.Enabled == true {
+			currScore -= config.ECM.Haptotaxis * GetMeanECM2D(neighborhoods[n])
+		}
+
+		//chemotaxis up the gradients of the chemical fields
+		currScore -= GetTaxisScore2D(currMatrix, i, j, neighborhoods[n], config)
+
+		if currScore < minScore {
+			minScore = currScore
+			numTies = 1
+			minCcoords = neighborhoods[n].neighbors[RNG.Intn(len(neighborhoods[n].neighbors))].location
+		} else if currScore == minScore {
+			numTies++
+			if RNG.Intn(numTies) == 0 {
+				minCcoords = neighborhoods[n].neighbors[RNG.Intn(len(neighborhoods[n].neighbors))].location
+			}
+		}
+	}
+
+	return minCcoords
+}
+
 //PushAllCells2D pushes a new cell to relevent coordinate given by the velocity neighborhood
-func PushAllCells2D(currMatrix Matrix2D, x, y int) Matrix2D {
+//A daughter cell can be blocked by dense ECM at its target (if the ECM is enabled in config).
+//With mechanics enabled, daughters instead push the living cells at their target toward a free site (see PushDivisions2D).
+func PushAllCells2D(currMatrix Matrix2D, x, y int, config Config) Matrix2D {
 
 	pushedMatrix := Initialize2DMatrix(x, y)
 
@@ -539,20 +949,33 @@ func PushAllCells2D(currMatrix Matrix2D, x, y int) Matrix2D {
 			if currCell.state == "C" {
 				//distributing cancer cells
 				//keep old cancer cell at original location and replace cell state at target.
+				//with the cell cycle enabled, only cells at the end of M phase divide.
 				pushedMatrix[i][j].state = "C"
-				pushedMatrix[toX][toY].state = "C" //cancer cell proliferates, but original cancer cell persists. Quiescent cells have no change.
+				if config.Mechanics.Enabled == false && DividesNow2D(currCell, config.Cycle) == true && ECMBlocks2D(pushedMatrix[toX][toY], config.ECM) == false {
+					DivideCell2D(pushedMatrix, i, j, toX, toY, config.Cycle) //cancer cell proliferates, but original cancer cell persists. Quiescent cells have no change.
+				}
 			}
 
 			if currCell.state == "N" {
 				//necrotic cells move toward necrotic cells. Cancer cells will move toward non-cancer cells (normal and necrotic)
 
-				pushedMatrix[i][j].state = "wN"    // blank since idea is that necrotic cell moved away from original position.
-				pushedMatrix[toX][toY].state = "N" // "move" cell to location of vector pointer
+				pushedMatrix[i][j] = ClearCell2D(pushedMatrix[i][j], "wN") // blank since idea is that necrotic cell moved away from original position.
+				MoveCell2D(&pushedMatrix[toX][toY], currCell)              // "move" cell to location of vector pointer
+			}
+
+			//other cells with taxis rules migrate without leaving a mark behind
+			if IsMigratory2D(currCell, config) == true && currCell.state != "N" {
+				pushedMatrix[i][j] = ClearCell2D(pushedMatrix[i][j], "h")
+				MoveCell2D(&pushedMatrix[toX][toY], currCell)
 			}
 
 		}
 	}
 
+	if config.Mechanics.Enabled == true {
+		pushedMatrix = PushDivisions2D(currMatrix, pushedMatrix, config)
+	}
+
 	return pushedMatrix
 
 }
@@ -612,6 +1035,32 @@ func Initialize2DMatrix(x, y int) Matrix2D {
 	return matrix
 }
 
+//GetSurroundingNeighborhoods2D returns the neighborhoods of the sites two steps away from i,j in each direction that are in the field.
+func GetSurroundingNeighborhoods2D(currMatrix Matrix2D, i, j int) []Neighborhood2D {
+
+	numRows := GetNumRows2D(currMatrix)
+	numCols := GetNumCols2D(currMatrix)
+
+	//Noah Chang------------------------------------------------------------------
+	//Debugged here for handling the edges
+	neighborhoods := make([]Neighborhood2D, 0)
+	if InField2D(i+2, j, numRows, numCols) == true {
+		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i+2, j, numRows, numCols))
+	}
+	if InField2D(i-2, j, numRows, numCols) == true {
+		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i-2, j, numRows, numCols))
+	}
+	if InField2D(i, j+2, numRows, numCols) == true {
+		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i, j+2, numRows, numCols))
+	}
+	if InField2D(i, j-2, numRows, numCols) == true {
+		neighborhoods = append(neighborhoods, GetCurrentNeighborhood2D(currMatrix, i, j-2, numRows, numCols))
+	}
+	//----------------------------------------------------------------------------
+
+	return neighborhoods
+}
+
 //GetCurrentNeighborhood2D returns slice of pointers to cells and 3D moore rulestring. x,y are current positions of center cell.
 func GetCurrentNeighborhood2D(currMatrix Matrix2D, x, y int, numRows, numCols int) Neighborhood2D {
 
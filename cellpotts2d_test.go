@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+//TestUpdateMatrixMargin2D checks that the sites outside the field keep their microenvironment from generation to
+//generation, while cells pushed there are lost.
+func TestUpdateMatrixMargin2D(t *testing.T) {
+
+	SeedRandom(5)
+	config := ReadConfig("")
+
+	currMatrix := InitialMatrix2D(15, 15, config)
+
+	currMatrix[1][2].ecm = 0.7
+	currMatrix[1][2].pressure = 0.25
+	currMatrix[1][2].chemicals = []float64{0.5}
+
+	currMatrix[2][1].state = "C"
+	currMatrix[2][1].clone = 3
+	currMatrix[2][1].velocityDirection = OrderedPair{2, 2}
+
+	statesMatrix := UpdateMatrixStates2D(currMatrix, 15, 15, 1, 1, 1, config)
+	velocitiesMatrix := UpdateMatrixVelocities2D(statesMatrix, 15, 15, config)
+
+	for _, matrix := range []Matrix2D{statesMatrix, velocitiesMatrix} {
+		site := matrix[1][2]
+		if site.ecm != 0.7 || site.pressure != 0.25 || reflect.DeepEqual(site.chemicals, []float64{0.5}) == false {
+			t.Fatalf("margin site of ECM %g, pressure %g and chemicals %v", site.ecm, site.pressure, site.chemicals)
+		}
+
+		cell := matrix[2][1]
+		if cell.state != "h" || cell.clone != 0 || cell.velocityDirection != (OrderedPair{}) {
+			t.Fatalf("cell of state %s, clone %d and velocity %v left in the margin", cell.state, cell.clone, cell.velocityDirection)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
 	"strconv"
 )
@@ -27,6 +26,9 @@ type Cell struct {
 
 	//Probability of N, A, C, Q
 	pNecrosis, pProliferation, pQuiescent float64
+
+	//Clone (lineage) of the cell
+	clone int
 }
 
 //Neighborhood is an object to organize the neighbors
@@ -47,23 +49,110 @@ type OrderedTrio struct {
 	x, y, z int
 }
 
-//GenerateMatrices is the 3D version of Generate2DMatrices
-func GenerateMatrices(initialMatrix Matrix, numGens int, Kcc, Knn, Knc float64) []Matrix {
-
-	matrices := make([]Matrix, numGens+1)
+//GenerateMatrices is the 3D version of Generate2DMatrices. The initial matrix is seeded with a central cancerous cell, or with the seeds given in config.
+func GenerateMatrices(initialMatrix Matrix, numGens int, Kcc, Knn, Knc float64, config Config) ([]Matrix, error) {
+	return ContinueMatrices(SeedMatrix3D(initialMatrix, config), 0, numGens, Kcc, Knn, Knc, config)
+}
 
-	matrices[0] = initialMatrix
+//ContinueMatrices is the 3D version of ContinueMatrices2D.
+func ContinueMatrices(first Matrix, start, numGens int, Kcc, Knn, Knc float64, config Config) ([]Matrix, error) {
 
-	centerCell := GetCentralCell(matrices[0])
+	matrices := make([]Matrix, numGens+1)
 
-	matrices[0][centerCell.location.x][centerCell.location.y][centerCell.location.z].state = "C"
+	matrices[0] = first
+	err := ExportGeneration(nil, first, start, start, Kcc, Knn, Knc, config)
+	if err != nil {
+		return nil, err
+	}
 
 	for m := 1; m <= numGens; m++ {
-		fmt.Println("3D Matrix Generation No." + strconv.Itoa(m))
+		fmt.Println("3D Matrix Generation No." + strconv.Itoa(start+m))
 		matrices[m] = UpdateMatrix(matrices[m-1], Kcc, Knn, Knc) //assumes moore neighborhood
+
+		err = ExportGeneration(nil, matrices[m], start+m, start, Kcc, Knn, Knc, config)
+		if err == nil {
+			err = WriteCheckpoint(nil, matrices[m], start+m, Kcc, Knn, Knc, config)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return matrices, nil
+}
+
+//OutputGrowth3D writes the CSV files, renders, slices, projections, VTK files and meshes of a 3D run whose first matrix is of generation firstGeneration.
+//The first error met is returned.
+func OutputGrowth3D(timepoints []Matrix, firstGeneration int, config Config, options Options) error {
+
+	//Generating CSV for R input
+	err := OutputFile3DinCSV(timepoints, firstGeneration, config.Render.Colors)
+	if err != nil {
+		return err
+	}
+
+	//Volumes for ParaView and VisIt
+	if config.VTK.Enabled == true {
+		err = OutputVTK3D(timepoints, firstGeneration, config.VTK)
+		if err != nil {
+			return err
+		}
+	}
+
+	//Surfaces of the tumour for physics and 3D printing
+	if config.Mesh.Enabled == true {
+		err = OutputMesh3D(timepoints, firstGeneration, config.Mesh)
+		if err != nil {
+			return err
+		}
 	}
 
-	return matrices
+	//Rendering the frames directly, without going through R
+	if config.Render.Enabled == true {
+		imglist := DrawMatrices3D(timepoints, config.Render)
+
+		//the scale bar is left out, as the size of a site in the frames depends on the camera
+		if config.Overlay.Enabled == true {
+			imglist = OverlayFrames(imglist, GetPopulations3D(timepoints, config.Overlay), GetRenderColors3D(config.Render), 0, config.Overlay)
+		}
+
+		err = WriteAnimation(imglist, "growth3D", options)
+		if err != nil {
+			return err
+		}
+
+		if config.Render.RotationFrames > 0 {
+			err = WriteAnimation(RenderRotation3D(timepoints[len(timepoints)-1], config.Render), "rotate3D", options)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	//Slices through the volume and projections, to see inside the tumour
+	if config.Slices.Enabled == true {
+		err = OutputSlices3D(timepoints, config.Slices, config.Overlay, config.Palette, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//SeedMatrix3D seeds a central cancerous cell, or the seeds given in config.
+func SeedMatrix3D(matrix Matrix, config Config) Matrix {
+
+	if len(config.Seeds) == 0 {
+		centerCell := GetCentralCell(matrix)
+
+		matrix[centerCell.location.x][centerCell.location.y][centerCell.location.z].state = "C"
+		matrix[centerCell.location.x][centerCell.location.y][centerCell.location.z].clone = 1
+	} else {
+		matrix = SeedInitialConditions3D(matrix, config.Seeds)
+	}
+
+	return matrix
 }
 
 //GetCentralCell is the 3D version of GetCentralCell2D
@@ -127,11 +216,13 @@ func PushAllCells(currMatrix Matrix) Matrix {
 				if currCell.state == "C" {
 					pushedMatrix[i][j][k].state = "C"
 					pushedMatrix[toX][toY][toZ].state = "C"
+					pushedMatrix[toX][toY][toZ].clone = currCell.clone
 				}
 
 				if currCell.state == "N" {
 					pushedMatrix[i][j][k].state = "h"
 					pushedMatrix[toX][toY][toZ].state = "N"
+					pushedMatrix[toX][toY][toZ].clone = currCell.clone
 				}
 
 			}
@@ -236,18 +327,18 @@ func GetMaxNNeighborDirection(currMatrix Matrix, i, j, k int) OrderedTrio {
 		//if a new MINIMUM is found, set coordinates (this is where we WANT a cancerous cell to go).
 		if currCountN > maxCountN {
 
-			maxNcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.x
-			maxNcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.y
-			maxNcoords.z = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.z
+			maxNcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.x
+			maxNcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.y
+			maxNcoords.z = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.z
 
 		} else if currCountN == maxCountN {
 
 			// TIEBREAKING: we take at random the maximum N count.
 			maxCountN = currCountN
 
-			maxNcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.x
-			maxNcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.y
-			maxNcoords.z = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.z
+			maxNcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.x
+			maxNcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.y
+			maxNcoords.z = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.z
 
 		}
 
@@ -298,17 +389,17 @@ func GetMinCNeighborDirection(currMatrix Matrix, i, j, k int) OrderedTrio {
 
 		if currCountC < minCountC {
 
-			minCcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.x
-			minCcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.y
-			minCcoords.z = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.z
+			minCcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.x
+			minCcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.y
+			minCcoords.z = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.z
 
 		} else if currCountC == minCountC {
 
 			minCountC = currCountC
 
-			minCcoords.x = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.x
-			minCcoords.y = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.y
-			minCcoords.z = neighborhoods[rand.Intn(len(neighborhoods))].neighbors[rand.Intn(len(neighborhoods[i].neighbors))].location.z
+			minCcoords.x = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.x
+			minCcoords.y = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.y
+			minCcoords.z = neighborhoods[RNG.Intn(len(neighborhoods))].neighbors[RNG.Intn(len(neighborhoods[i].neighbors))].location.z
 
 		}
 
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"math"
+)
+
+//ChemicalConfig describes one named chemical field (e.g. a chemokine or a necrotic signal).
+//Each site holds a concentration that is secreted, taken up, decays and diffuses every generation.
+type ChemicalConfig struct {
+
+	//Name is used by taxis rules to refer to the field
+	Name string `json:"name"`
+
+	//Initial is the concentration of every site at generation 0
+	Initial float64 `json:"initial"`
+
+	//Diffusion is the fraction of the difference to each von Neumann neighbor exchanged per generation
+	Diffusion float64 `json:"diffusion"`
+
+	//Decay is the fraction of the concentration lost per generation
+	Decay float64 `json:"decay"`
+
+	//Secretion is the amount added per generation by a site of the given state, e.g. {"N": 1.0}
+	Secretion map[string]float64 `json:"secretion"`
+
+	//Uptake is the fraction of the concentration consumed per generation by a site of the given state, e.g. {"C": 0.2}
+	Uptake map[string]float64 `json:"uptake"`
+}
+
+//TaxisConfig is a velocity rule: cells of State move up the gradient of Field with the given Sensitivity.
+//Negative sensitivities give chemorepulsion.
+type TaxisConfig struct {
+	State       string  `json:"state"`
+	Field       string  `json:"field"`
+	Sensitivity float64 `json:"sensitivity"`
+
+	//index of Field in Config.Chemicals, set by ReadConfig
+	fieldIndex int
+}
+
+//GetChemicalIndex returns the index of the named field in chemicals, which is also its index in Cell2D.chemicals.
+func GetChemicalIndex(chemicals []ChemicalConfig, name string) int {
+
+	for i := range chemicals {
+		if chemicals[i].Name == name {
+			return i
+		}
+	}
+
+	panic("Unknown chemical field " + name)
+}
+
+//GetChemical2D returns the concentration of the chemical field with the given index at a site.
+//Sites whose fields were never set (outside the field of the lattice) count as zero.
+func GetChemical2D(currCell Cell2D, index int) float64 {
+
+	if index >= len(currCell.chemicals) {
+		return 0.0
+	}
+
+	return currCell.chemicals[index]
+}
+
+//SeedChemicals2D sets every site of the matrix to the initial concentration of each chemical field.
+func SeedChemicals2D(matrix Matrix2D, chemicals []ChemicalConfig) Matrix2D {
+
+	for i := range matrix {
+		for j := range matrix[i] {
+
+			matrix[i][j].chemicals = make([]float64, len(chemicals))
+
+			for c := range chemicals {
+				matrix[i][j].chemicals[c] = chemicals[c].Initial
+			}
+		}
+	}
+
+	return matrix
+}
+
+//UpdateChemicals2D computes the chemical fields of newMatrix from those of the previous generation, prevMatrix.
+//Secretion and uptake follow the states of newMatrix. Diffusion uses an explicit scheme with no flux across the lattice boundary;
+//diffusion coefficients above 0.25 are split into several stable substeps.
+func UpdateChemicals2D(prevMatrix, newMatrix Matrix2D, chemicals []ChemicalConfig) Matrix2D {
+
+	numRows := GetNumRows2D(newMatrix)
+	numCols := GetNumCols2D(newMatrix)
+
+	//fresh slices, since cells of newMatrix still share theirs with prevMatrix
+	for i := range newMatrix {
+		for j := range newMatrix[i] {
+			newMatrix[i][j].chemicals = make([]float64, len(chemicals))
+		}
+	}
+
+	for c := range chemicals {
+
+		field := make([][]float64, numRows)
+
+		for i := range field {
+			field[i] = make([]float64, numCols)
+
+			for j := range field[i] {
+
+				conc := GetChemical2D(prevMatrix[i][j], c)
+				state := newMatrix[i][j].state
+
+				conc += chemicals[c].Secretion[state]
+				conc -= chemicals[c].Uptake[state] * conc
+				conc -= chemicals[c].Decay * conc
+
+				field[i][j] = math.Max(0.0, conc)
+			}
+		}
+
+		numSteps := int(math.Ceil(chemicals[c].Diffusion / 0.25))
+		for step := 0; step < numSteps; step++ {
+			field = DiffuseField2D(field, chemicals[c].Diffusion/float64(numSteps))
+		}
+
+		for i := range newMatrix {
+			for j := range newMatrix[i] {
+				newMatrix[i][j].chemicals[c] = field[i][j]
+			}
+		}
+	}
+
+	return newMatrix
+}
+
+//DiffuseField2D performs one explicit diffusion step with coefficient d (stable for d <= 0.25) on a scalar field.
+func DiffuseField2D(field [][]float64, d float64) [][]float64 {
+
+	numRows := len(field)
+	numCols := len(field[0])
+
+	diffused := make([][]float64, numRows)
+
+	for i := range field {
+		diffused[i] = make([]float64, numCols)
+
+		for j := range field[i] {
+
+			flux := 0.0
+
+			if i > 0 {
+				flux += field[i-1][j] - field[i][j]
+			}
+			if i < numRows-1 {
+				flux += field[i+1][j] - field[i][j]
+			}
+			if j > 0 {
+				flux += field[i][j-1] - field[i][j]
+			}
+			if j < numCols-1 {
+				flux += field[i][j+1] - field[i][j]
+			}
+
+			diffused[i][j] = field[i][j] + d*flux
+		}
+	}
+
+	return diffused
+}
+
+//GetMeanChemical2D returns the mean concentration of the chemical field with the given index over a neighborhood, center included.
+func GetMeanChemical2D(nhd Neighborhood2D, index int) float64 {
+
+	sum := GetChemical2D(*nhd.center, index)
+
+	for i := range nhd.neighbors {
+		sum += GetChemical2D(*nhd.neighbors[i], index)
+	}
+
+	return sum / float64(len(nhd.neighbors)+1)
+}
+
+//HasTaxisRules returns true if any taxis rule in config applies to cells of the given state.
+func HasTaxisRules(config Config, state string) bool {
+
+	for _, rule := range config.Taxis {
+		if rule.State == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+//GetTaxisScore2D sums, over the taxis rules for the state of the cell at i,j, the sensitivity times the gradient of
+//the rule's field from the cell's site toward the neighborhood nhd.
+func GetTaxisScore2D(currMatrix Matrix2D, i, j int, nhd Neighborhood2D, config Config) float64 {
+
+	score := 0.0
+
+	for _, rule := range config.Taxis {
+		if rule.State == currMatrix[i][j].state {
+
+			gradient := GetMeanChemical2D(nhd, rule.fieldIndex) - GetChemical2D(currMatrix[i][j], rule.fieldIndex)
+
+			score += rule.Sensitivity * gradient
+		}
+	}
+
+	return score
+}
+
+//GetMaxTaxisNeighborDirection2D returns coordinates of a neighbor of the neighborhood (two sites away from i,j)
+//with the highest taxis score, i.e. the direction cells at i,j follow up their chemical gradients.
+func GetMaxTaxisNeighborDirection2D(currMatrix Matrix2D, i, j int, config Config) OrderedPair {
+
+	neighborhoods := GetSurroundingNeighborhoods2D(currMatrix, i, j)
+
+	var maxCoords OrderedPair
+	maxCoords.x = i
+	maxCoords.y = j
+
+	maxScore := math.Inf(-1)
+
+	//number of neighborhoods tied at the current maximum
+	numTies := 0
+
+	for n := range neighborhoods {
+
+		currScore := GetTaxisScore2D(currMatrix, i, j, neighborhoods[n], config)
+
+		if currScore > maxScore {
+			maxScore = currScore
+			numTies = 1
+			maxCoords = neighborhoods[n].neighbors[RNG.Intn(len(neighborhoods[n].neighbors))].location
+		} else if currScore == maxScore {
+			numTies++
+			if RNG.Intn(numTies) == 0 {
+				maxCoords = neighborhoods[n].neighbors[RNG.Intn(len(neighborhoods[n].neighbors))].location
+			}
+		}
+	}
+
+	return maxCoords
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+)
+
+//CirculationConfig holds the settings of the circulation compartment. When enabled, the cells of each intravasation travel
+//through the blood stream for a few generations as a circulating tumour cell (CTC) or CTC cluster, and may die on the way,
+//instead of passing SurvivalCheck once and extravasating at once.
+type CirculationConfig struct {
+
+	//Enabled turns the circulation compartment on
+	Enabled bool `json:"enabled"`
+
+	//DeathRate is the chance that a single CTC dies (anoikis, immune attack) in one generation of transit.
+	//Clusters of n cells die with DeathRate / n^ClusterProtection, so larger clusters survive longer.
+	DeathRate         float64 `json:"deathRate"`
+	ClusterProtection float64 `json:"clusterProtection"`
+
+	//ShearDeath is the chance that each cell of a CTC or cluster is killed by shear stress in one generation of transit
+	ShearDeath float64 `json:"shearDeath"`
+
+	//The transit time of each CTC is drawn uniformly between MinTransit and MaxTransit generations
+	MinTransit int `json:"minTransit"`
+	MaxTransit int `json:"maxTransit"`
+
+	//Extravasation is the chance that CTCs reaching the end of their transit leave the vessel into an organ; the others die
+	Extravasation float64 `json:"extravasation"`
+
+	//Dormancy is the chance that extravasated cells become dormant instead of growing.
+	//Dormant cells reawaken with probability Reawakening per generation.
+	Dormancy    float64 `json:"dormancy"`
+	Reawakening float64 `json:"reawakening"`
+}
+
+//DefaultCirculationConfig returns a disabled circulation compartment in which clusters survive transit far more often than single cells.
+func DefaultCirculationConfig() CirculationConfig {
+
+	var circulationConfig CirculationConfig
+
+	circulationConfig.Enabled = false
+	circulationConfig.DeathRate = 0.8
+	circulationConfig.ClusterProtection = 1.0
+	circulationConfig.ShearDeath = 0.05
+	circulationConfig.MinTransit = 1
+	circulationConfig.MaxTransit = 3
+	circulationConfig.Extravasation = 0.2
+	circulationConfig.Dormancy = 0.5
+	circulationConfig.Reawakening = 0.02
+
+	return circulationConfig
+}
+
+//CTC is a circulating tumour cell, or a cluster of them if size is above one.
+type CTC struct {
+	clone int
+	size  int
+
+	//generation it entered the blood stream and generations of transit left
+	entered int
+	transit int
+
+	//index of its intravasation in the event log
+	event int
+}
+
+//DormantCells are extravasated cells waiting in an organ.
+type DormantCells struct {
+	organ string
+	clone int
+	size  int
+
+	//generation they extravasated at
+	since int
+
+	//index of their intravasation in the event log
+	event int
+}
+
+//CirculationCounts is one row of the CTC time series.
+type CirculationCounts struct {
+	generation int
+
+	//CTCs in the blood stream at the end of the generation: single cells, clusters, and the cells of both
+	singles, clusters, cells int
+
+	//cells killed in transit and at extravasation, cells that extravasated, and cells that reawakened, in this generation
+	died, extravasated, reawakened int
+
+	//dormant cells over all organs at the end of the generation
+	dormant int
+}
+
+//Circulation holds the CTCs in the blood stream and the dormant cells at the destination organs.
+type Circulation struct {
+	ctcs    []CTC
+	dormant []DormantCells
+}
+
+//UpdateCirculation advances the circulation compartment by one generation.
+//CTCs already in the blood stream may die (size-dependent death and shear stress), and those reaching the end of their transit
+//extravasate into an organ drawn from the tropism of their clone, where they are counted in metaCount and may become dormant.
+//Dormant cells may reawaken. Then the last numNew events of eventLog, the intravasations of this generation, enter the blood stream.
+//The fate of each intravasation is recorded in eventLog as it is decided.
+//It returns the compartment, the updated counts, the cells that settled and grow in an organ (as events with survived set),
+//and the counts of the generation.
+func UpdateCirculation(circulation Circulation, eventLog []MetastasisEvent, numNew int, metaCount []int, generation int, metaConfig MetastasisConfig, organNames []string) (Circulation, []int, []MetastasisEvent, CirculationCounts) {
+
+	circulationConfig := metaConfig.Circulation
+
+	//copying, so that the counts of the previous generation are kept
+	metaCount = append([]int(nil), metaCount...)
+
+	var counts CirculationCounts
+	counts.generation = generation
+
+	settled := make([]MetastasisEvent, 0)
+
+	ctcs := make([]CTC, 0)
+
+	for _, ctc := range circulation.ctcs {
+
+		sizeBefore := ctc.size
+
+		//anoikis and immune attack, less likely for larger clusters
+		if RNG.Float64() < circulationConfig.DeathRate/math.Pow(float64(ctc.size), circulationConfig.ClusterProtection) {
+			ctc.size = 0
+		}
+
+		//shear stress kills cells one by one
+		for c := ctc.size; c > 0; c-- {
+			if RNG.Float64() < circulationConfig.ShearDeath {
+				ctc.size--
+			}
+		}
+
+		counts.died += sizeBefore - ctc.size
+
+		if ctc.size == 0 {
+			eventLog[ctc.event].fate = "died"
+			continue
+		}
+
+		ctc.transit--
+
+		if ctc.transit > 0 {
+			ctcs = append(ctcs, ctc)
+			continue
+		}
+
+		//end of transit
+		if RNG.Float64() >= circulationConfig.Extravasation {
+			counts.died += ctc.size
+			eventLog[ctc.event].fate = "died"
+			continue
+		}
+
+		var organ string
+		metaCount, organ = Extravastate(metaCount, GetOrganTropism(metaConfig, ctc.clone), organNames)
+		counts.extravasated += ctc.size
+
+		eventLog[ctc.event].survived = true
+		eventLog[ctc.event].organ = organ
+		eventLog[ctc.event].arrival = generation
+		eventLog[ctc.event].fate = "extravasated"
+
+		if RNG.Float64() < circulationConfig.Dormancy {
+			circulation.dormant = append(circulation.dormant, DormantCells{organ, ctc.clone, ctc.size, generation, ctc.event})
+			eventLog[ctc.event].fate = "dormant"
+		} else {
+			settled = append(settled, MetastasisEvent{generation: generation, clone: ctc.clone, clusterSize: ctc.size, survived: true, organ: organ})
+		}
+	}
+
+	dormant := make([]DormantCells, 0)
+
+	for _, cells := range circulation.dormant {
+		//cells that just arrived wait at least one generation
+		if cells.since < generation && RNG.Float64() < circulationConfig.Reawakening {
+			counts.reawakened += cells.size
+			eventLog[cells.event].fate = "reawakened"
+			eventLog[cells.event].reawakened = generation
+
+			settled = append(settled, MetastasisEvent{generation: generation, clone: cells.clone, clusterSize: cells.size, survived: true, organ: cells.organ})
+		} else {
+			dormant = append(dormant, cells)
+			counts.dormant += cells.size
+		}
+	}
+
+	//newly intravasated cells start their transit
+	for e := len(eventLog) - numNew; e < len(eventLog); e++ {
+		transit := circulationConfig.MinTransit
+		if circulationConfig.MaxTransit > circulationConfig.MinTransit {
+			transit += RNG.Intn(circulationConfig.MaxTransit - circulationConfig.MinTransit + 1)
+		}
+		if transit < 1 {
+			transit = 1
+		}
+
+		ctcs = append(ctcs, CTC{eventLog[e].clone, eventLog[e].clusterSize, generation, transit, e})
+		eventLog[e].fate = "circulating"
+	}
+
+	for _, ctc := range ctcs {
+		if ctc.size == 1 {
+			counts.singles++
+		} else {
+			counts.clusters++
+		}
+		counts.cells += ctc.size
+	}
+
+	circulation.ctcs = ctcs
+	circulation.dormant = dormant
+
+	return circulation, metaCount, settled, counts
+}
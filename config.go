@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+//Config holds the model settings that do not fit on the command line. It is read from a JSON file given with -config.
+//Every section is disabled by default, so a run without a config file is the original model.
+type Config struct {
+
+	//Initial conditions: tumour seeds (the central diamond if empty)
+	Seeds []SeedConfig `json:"seeds"`
+
+	//Extracellular matrix density field
+	ECM ECMConfig `json:"ecm"`
+
+	//Named chemical fields and the taxis rules that make cells follow their gradients
+	Chemicals []ChemicalConfig `json:"chemicals"`
+	Taxis     []TaxisConfig    `json:"taxis"`
+
+	//Cell cycle phases, division timing and necrotic decay
+	Cycle CycleConfig `json:"cycle"`
+
+	//Pushing mechanics and contact inhibition
+	Mechanics MechanicsConfig `json:"mechanics"`
+
+	//Destinations of metastatic cells
+	Metastasis MetastasisConfig `json:"metastasis"`
+
+	//Rendering of the 3D lattice, and its slices and projections
+	Render RenderConfig `json:"render"`
+	Slices SliceConfig  `json:"slices"`
+
+	//Legends, labels, scale bars and population charts drawn into the frames of the animations
+	Overlay OverlayConfig `json:"overlay"`
+
+	//Colors of states, clones and fields in every drawing
+	Palette PaletteConfig `json:"palette"`
+
+	//Vector drawings of 2D runs
+	SVG SVGConfig `json:"svg"`
+
+	//Export of 3D runs for ParaView and VisIt
+	VTK VTKConfig `json:"vtk"`
+
+	//Surface meshes of 3D runs
+	Mesh MeshConfig `json:"mesh"`
+
+	//Long table of every generation, for R and Python
+	Tidy TidyConfig `json:"tidy"`
+
+	//Snapshots written during runs, to resume them later
+	Checkpoint CheckpointConfig `json:"checkpoint"`
+}
+
+//Options holds the optional flags that follow the positional command line arguments.
+type Options struct {
+
+	//JSON file with the model Config
+	configFile string
+
+	//Formats of the animations (see AnimationFormats), frame stride and frame rate
+	formats []string
+	stride  int
+	fps     int
+
+	//Address of the live viewer
+	addr string
+
+	//Seed of the random numbers, taken from the clock if 0
+	seed int64
+
+	//Run directory of the outputs (a new one under "runs" if empty), and whether a directory already holding files may be written over
+	outputDir string
+	overwrite bool
+}
+
+//ParseOptions parses the optional flags in args (everything after the positional arguments).
+func ParseOptions(args []string) Options {
+
+	var options Options
+
+	flags := flag.NewFlagSet("options", flag.ExitOnError)
+	flags.StringVar(&options.configFile, "config", "", "JSON file with model settings")
+	format := flags.String("format", "gif", "comma-separated animation formats: "+strings.Join(AnimationFormats, ", "))
+	flags.IntVar(&options.stride, "stride", 1, "keep every n-th frame of the animations")
+	flags.IntVar(&options.fps, "fps", 10, "frames per second of the animations, and generations per second of the live viewer")
+	flags.StringVar(&options.addr, "addr", "localhost:8080", "address of the live viewer")
+	flags.Int64Var(&options.seed, "seed", 0, "seed of the random numbers, taken from the clock if 0")
+	flags.StringVar(&options.outputDir, "out", "", "directory of the outputs of the run, a new one under runs if empty (gif2D and gif3D: the latest run)")
+	flags.BoolVar(&options.overwrite, "overwrite", false, "write into an output directory that already holds files")
+
+	flags.Parse(args)
+
+	options.formats = strings.Split(*format, ",")
+	for _, f := range options.formats {
+		known := false
+		for _, name := range AnimationFormats {
+			if f == name {
+				known = true
+			}
+		}
+		if known == false {
+			log.Fatal("Unknown animation format " + f + ", expected one of " + strings.Join(AnimationFormats, ", "))
+		}
+	}
+
+	if options.stride < 1 || options.fps < 1 {
+		log.Fatal("-stride and -fps have to be at least 1")
+	}
+
+	return options
+}
+
+//DefaultConfig returns the settings used when no config file is given.
+func DefaultConfig() Config {
+
+	var config Config
+
+	config.ECM = DefaultECMConfig()
+	config.Cycle = DefaultCycleConfig()
+	config.Mechanics = DefaultMechanicsConfig()
+	config.Metastasis = DefaultMetastasisConfig()
+	config.Render = DefaultRenderConfig()
+	config.Slices = DefaultSliceConfig()
+	config.Overlay = DefaultOverlayConfig()
+	config.Palette = DefaultPaletteConfig()
+	config.SVG = DefaultSVGConfig()
+	config.VTK = DefaultVTKConfig()
+	config.Mesh = DefaultMeshConfig()
+	config.Tidy = DefaultTidyConfig()
+	config.Checkpoint = DefaultCheckpointConfig()
+
+	return config
+}
+
+//ReadConfig reads a JSON config file on top of DefaultConfig. An empty filename returns DefaultConfig.
+//The colors of the 3D renders are those of the palette, with the render colors of the file on top.
+func ReadConfig(filename string) Config {
+
+	if filename == "" {
+		return ParseConfig(nil, "")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return ParseConfig(data, "file "+filename)
+}
+
+//ParseConfig reads the JSON of a config, from a file or a snapshot named source, on top of DefaultConfig.
+//Empty data returns DefaultConfig.
+func ParseConfig(data []byte, source string) Config {
+
+	config := DefaultConfig()
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &config)
+		if err != nil {
+			log.Fatal("Problem when reading config " + source + ": " + err.Error())
+		}
+	}
+
+	//every taxis rule must refer to a chemical field, found once here rather than for every cell
+	for r := range config.Taxis {
+		config.Taxis[r].fieldIndex = GetChemicalIndex(config.Chemicals, config.Taxis[r].Field)
+	}
+
+	CheckMetastasisConfig(config.Metastasis)
+
+	CheckTidyConfig(config.Tidy)
+
+	config.Palette = CheckPaletteConfig(config.Palette, config.Chemicals)
+
+	renderColors := GetStateHexColors3D(config.Palette)
+	for state, hex := range config.Render.Colors {
+		renderColors[state] = hex
+	}
+	config.Render.Colors = renderColors
+
+	return config
+}
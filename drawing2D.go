@@ -8,54 +8,31 @@ import (
 
 // The following code was written by Simon Levine-Gottreich
 
-//DrawMatrices takes in a slice of matrices to output slice of images that can be used to draw GIF
-func DrawMatrices(matrices []Matrix2D, cellWidth int, x, y int) []image.Image {
+//DrawMatrices takes in a slice of matrices to output slice of images that can be used to draw GIF, in the colors of the palette
+func DrawMatrices(matrices []Matrix2D, cellWidth int, x, y int, paletteConfig PaletteConfig) []image.Image {
 	numGenerations := len(matrices)
 	imageList := make([]image.Image, numGenerations)
 	for i := range matrices {
 		fmt.Println("Drawing " + strconv.Itoa(i) + "th matrix")
-		imageList[i] = DrawMatrix2D(matrices[i], cellWidth, x, y)
+		imageList[i] = DrawMatrix2D(matrices[i], cellWidth, x, y, paletteConfig)
 	}
 	return imageList
 }
 
-//DrawMatrix2D takes in matrix and outputs image.Image
-func DrawMatrix2D(matrix Matrix2D, cellWidth int, x, y int) image.Image {
+//DrawMatrix2D takes in matrix and outputs image.Image, coloring the sites as chosen by the palette
+func DrawMatrix2D(matrix Matrix2D, cellWidth int, x, y int, paletteConfig PaletteConfig) image.Image {
 	height := len(matrix) * cellWidth
 	width := len(matrix[0]) * cellWidth
 	c := CreateNewCanvas(width, height)
 
 	// declare colors
-	darkGray := MakeColor(50, 50, 50)
-	black := MakeColor(0, 0, 0)
-	blue := MakeColor(0, 0, 255)
-	red := MakeColor(255, 0, 0)
-	green := MakeColor(213, 245, 227)
-	yellow := MakeColor(255, 255, 0)
 	white := MakeColor(255, 255, 255)
 
-	// draw the grid lines
-	c.SetStrokeColor(darkGray)
-	DrawGridLines(c, cellWidth)
-
 	// fill in colored squares
 	for i := range matrix {
 		for j := range matrix[i] {
 			if InField2D(i, j, x, y) == true {
-				if matrix[i][j].state == "C" {
-					c.SetFillColor(blue)
-				} else if matrix[i][j].state == "Q" {
-					c.SetFillColor(yellow)
-				} else if matrix[i][j].state == "h" {
-					c.SetFillColor(green)
-
-				} else if matrix[i][j].state == "N" {
-					c.SetFillColor(red)
-
-				} else if matrix[i][j].state == "wN" {
-					c.SetFillColor(black)
-
-				}
+				c.SetFillColor(GetSiteColor2D(matrix[i][j], paletteConfig))
 			} else {
 				c.SetFillColor(white)
 			}
@@ -66,6 +43,12 @@ func DrawMatrix2D(matrix Matrix2D, cellWidth int, x, y int) image.Image {
 		}
 	}
 
+	// draw the grid lines over the squares, if they are wide enough
+	if paletteConfig.Grid != "" && cellWidth > 1 {
+		c.SetStrokeColor(ParseHexColor(paletteConfig.Grid))
+		DrawGridLines(c, cellWidth)
+	}
+
 	return c.img
 }
 
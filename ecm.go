@@ -0,0 +1,223 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"os"
+)
+
+//ECMConfig holds the settings of the extracellular matrix (ECM) density field.
+//ECM density is stored per site in [0,1]; dense ECM resists invasion and is degraded by MMPs secreted from cancer cells.
+type ECMConfig struct {
+
+	//Enabled turns the ECM field on
+	Enabled bool `json:"enabled"`
+
+	//Pattern is "uniform", "fibres" or "image"
+	Pattern string `json:"pattern"`
+
+	//Density is the background density of the "uniform" and "fibres" patterns
+	Density float64 `json:"density"`
+
+	//Image is the grayscale picture read by the "image" pattern. White is dense ECM, black is none.
+	Image string `json:"image"`
+
+	//Fibres are straight segments of FibreDensity, FibreLength sites long and FibreWidth sites wide
+	NumFibres    int     `json:"numFibres"`
+	FibreLength  int     `json:"fibreLength"`
+	FibreWidth   int     `json:"fibreWidth"`
+	FibreDensity float64 `json:"fibreDensity"`
+
+	//FibreAngle is the fibre orientation in degrees. FibreSpread is the random deviation around it (180 gives random fibres).
+	FibreAngle  float64 `json:"fibreAngle"`
+	FibreSpread float64 `json:"fibreSpread"`
+
+	//Degradation is the ECM density removed by MMPs per generation at the site and neighbors of each cancer cell
+	Degradation float64 `json:"degradation"`
+
+	//Resistance is the chance that a site of density 1 blocks a daughter cell from invading it
+	Resistance float64 `json:"resistance"`
+
+	//Haptotaxis weights the ECM density of a neighborhood against its cancer density when choosing the invasion direction.
+	//Positive values draw cells along dense ECM (e.g. fibres), negative values push them toward sparse ECM.
+	Haptotaxis float64 `json:"haptotaxis"`
+}
+
+//DefaultECMConfig returns a disabled ECM field with moderate fibre and MMP settings.
+func DefaultECMConfig() ECMConfig {
+
+	var ecmConfig ECMConfig
+
+	ecmConfig.Enabled = false
+	ecmConfig.Pattern = "uniform"
+	ecmConfig.Density = 0.5
+	ecmConfig.NumFibres = 60
+	ecmConfig.FibreLength = 60
+	ecmConfig.FibreWidth = 1
+	ecmConfig.FibreDensity = 1.0
+	ecmConfig.FibreAngle = 0.0
+	ecmConfig.FibreSpread = 180.0
+	ecmConfig.Degradation = 0.1
+	ecmConfig.Resistance = 0.5
+	ecmConfig.Haptotaxis = 1.0
+
+	return ecmConfig
+}
+
+//SeedECM2D fills the ECM density of every site of the matrix according to the pattern of ecmConfig.
+func SeedECM2D(matrix Matrix2D, ecmConfig ECMConfig) Matrix2D {
+
+	if ecmConfig.Pattern == "uniform" {
+		for i := range matrix {
+			for j := range matrix[i] {
+				matrix[i][j].ecm = ecmConfig.Density
+			}
+		}
+	} else if ecmConfig.Pattern == "fibres" {
+		for i := range matrix {
+			for j := range matrix[i] {
+				matrix[i][j].ecm = ecmConfig.Density
+			}
+		}
+		for f := 0; f < ecmConfig.NumFibres; f++ {
+			DrawFibre2D(matrix, ecmConfig)
+		}
+	} else if ecmConfig.Pattern == "image" {
+		ecmBoard := ReadGrayscaleImage(ecmConfig.Image, GetNumRows2D(matrix), GetNumCols2D(matrix))
+		for i := range matrix {
+			for j := range matrix[i] {
+				matrix[i][j].ecm = ecmBoard[i][j]
+			}
+		}
+	} else {
+		panic("ECM pattern has to be uniform, fibres or image")
+	}
+
+	return matrix
+}
+
+//DrawFibre2D draws one straight ECM fibre starting at a random site of the matrix.
+func DrawFibre2D(matrix Matrix2D, ecmConfig ECMConfig) {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	angle := (ecmConfig.FibreAngle + ecmConfig.FibreSpread*(2*RNG.Float64()-1)) * math.Pi / 180.0
+	dx := math.Cos(angle)
+	dy := math.Sin(angle)
+
+	x := RNG.Float64() * float64(numRows)
+	y := RNG.Float64() * float64(numCols)
+
+	//the fibre is drawn as a square brush of FibreWidth sites moved along the segment
+	half := ecmConfig.FibreWidth / 2
+
+	for step := 0; step < ecmConfig.FibreLength; step++ {
+		i := int(x + float64(step)*dx)
+		j := int(y + float64(step)*dy)
+
+		for a := i - half; a <= i-half+ecmConfig.FibreWidth-1; a++ {
+			for b := j - half; b <= j-half+ecmConfig.FibreWidth-1; b++ {
+				if a >= 0 && a < numRows && b >= 0 && b < numCols {
+					matrix[a][b].ecm = math.Max(matrix[a][b].ecm, ecmConfig.FibreDensity)
+				}
+			}
+		}
+	}
+}
+
+//ReadGrayscaleImage reads an image and resamples it to a numRows x numCols board of gray levels in [0,1].
+//Image rows correspond to matrix rows, as in DrawMatrix2D.
+func ReadGrayscaleImage(filename string, numRows, numCols int) [][]float64 {
+
+	imgFile, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer imgFile.Close()
+
+	img, _, err := image.Decode(imgFile)
+	if err != nil {
+		panic("Error while decoding image " + filename)
+	}
+
+	bounds := img.Bounds()
+
+	grayBoard := make([][]float64, numRows)
+
+	for i := range grayBoard {
+		grayBoard[i] = make([]float64, numCols)
+
+		for j := range grayBoard[i] {
+			//nearest pixel to the site
+			px := bounds.Min.X + j*bounds.Dx()/numCols
+			py := bounds.Min.Y + i*bounds.Dy()/numRows
+
+			gray := color.GrayModel.Convert(img.At(px, py)).(color.Gray)
+			grayBoard[i][j] = float64(gray.Y) / 255.0
+		}
+	}
+
+	return grayBoard
+}
+
+//DegradeECM2D lowers the ECM density at the site and von Neumann neighbors of every cancer cell, modelling MMP secretion.
+func DegradeECM2D(matrix Matrix2D, ecmConfig ECMConfig) Matrix2D {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	//MMPs are counted on the old states so that the order of the sweep does not matter
+	mmp := make([][]float64, numRows)
+	for i := range mmp {
+		mmp[i] = make([]float64, numCols)
+	}
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			if InField2D(i, j, numRows, numCols) == true {
+				if matrix[i][j].state == "C" || matrix[i][j].state == "Q" {
+					mmp[i][j] += ecmConfig.Degradation
+					mmp[i-1][j] += ecmConfig.Degradation
+					mmp[i+1][j] += ecmConfig.Degradation
+					mmp[i][j-1] += ecmConfig.Degradation
+					mmp[i][j+1] += ecmConfig.Degradation
+				}
+			}
+		}
+	}
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			matrix[i][j].ecm = math.Max(0.0, matrix[i][j].ecm-mmp[i][j])
+		}
+	}
+
+	return matrix
+}
+
+//GetMeanECM2D returns the mean ECM density over a neighborhood, center included.
+func GetMeanECM2D(nhd Neighborhood2D) float64 {
+
+	sum := nhd.center.ecm
+
+	for i := range nhd.neighbors {
+		sum += nhd.neighbors[i].ecm
+	}
+
+	return sum / float64(len(nhd.neighbors)+1)
+}
+
+//ECMBlocks2D decides whether the ECM at a site stops a daughter cell from invading it.
+func ECMBlocks2D(currCell Cell2D, ecmConfig ECMConfig) bool {
+
+	if ecmConfig.Enabled == false {
+		return false
+	}
+
+	return RNG.Float64() < ecmConfig.Resistance*currCell.ecm
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+//EventRecord is one intravasation event as written to the event log.
+type EventRecord struct {
+	Generation    int    `json:"generation"`
+	X             int    `json:"x"`
+	Y             int    `json:"y"`
+	Z             int    `json:"z"`
+	Clone         int    `json:"clone"`
+	ConnectedSize int    `json:"connectedSize"`
+	ClusterSize   int    `json:"clusterSize"`
+	Survived      bool   `json:"survived"`
+	Organ         string `json:"organ"`
+	Fate          string `json:"fate"`
+	Arrival       int    `json:"arrival"`
+	Reawakened    int    `json:"reawakened"`
+}
+
+//GenerationRecord holds the metastasis counts of one generation.
+type GenerationRecord struct {
+	Generation int `json:"generation"`
+
+	//intravasation attempts and cells that extravasated in this generation
+	Attempts     int `json:"attempts"`
+	Extravasated int `json:"extravasated"`
+
+	//cumulative extravasations per organ
+	Organs map[string]int `json:"organs"`
+}
+
+//MetastasisSummary is the report of a metastasis run.
+type MetastasisSummary struct {
+	Generations int `json:"generations"`
+
+	//intravasation attempts of single cells and of clusters, and how many of them extravasated
+	Attempts        int `json:"attempts"`
+	SingleAttempts  int `json:"singleAttempts"`
+	ClusterAttempts int `json:"clusterAttempts"`
+	Survived        int `json:"survived"`
+	SingleSurvived  int `json:"singleSurvived"`
+	ClusterSurvived int `json:"clusterSurvived"`
+
+	//mean number of cells shed per attempt, and generation of the first extravasation (0 if none)
+	MeanClusterSize float64 `json:"meanClusterSize"`
+	FirstMetastasis int     `json:"firstMetastasis"`
+
+	//number of attempts per fate and extravasations per organ at the end of the run
+	Fates  map[string]int `json:"fates"`
+	Organs map[string]int `json:"organs"`
+
+	PerGeneration []GenerationRecord `json:"perGeneration"`
+}
+
+//GetEventRecord turns an event into its record in the event log.
+func GetEventRecord(event MetastasisEvent) EventRecord {
+	return EventRecord{event.generation, event.x, event.y, event.z, event.clone, event.connectedSize, event.clusterSize,
+		event.survived, event.organ, event.fate, event.arrival, event.reawakened}
+}
+
+//GetMetastasisSummary summarises the events and counts of a metastasis run. organNames are the columns of results.metaSlice.
+func GetMetastasisSummary(results MetastasisResults, organNames []string) MetastasisSummary {
+
+	var summary MetastasisSummary
+
+	summary.Generations = len(results.metaSlice) - 1
+	summary.Fates = make(map[string]int)
+	summary.Organs = make(map[string]int)
+
+	totalSize := 0
+
+	for _, event := range results.events {
+		summary.Attempts++
+		totalSize += event.clusterSize
+
+		if event.clusterSize == 1 {
+			summary.SingleAttempts++
+		} else {
+			summary.ClusterAttempts++
+		}
+
+		if event.survived == true {
+			summary.Survived++
+			if event.clusterSize == 1 {
+				summary.SingleSurvived++
+			} else {
+				summary.ClusterSurvived++
+			}
+
+			if summary.FirstMetastasis == 0 || event.arrival < summary.FirstMetastasis {
+				summary.FirstMetastasis = event.arrival
+			}
+		}
+
+		summary.Fates[event.fate]++
+	}
+
+	if summary.Attempts > 0 {
+		summary.MeanClusterSize = float64(totalSize) / float64(summary.Attempts)
+	}
+
+	//attempts per generation
+	attempts := make([]int, len(results.metaSlice))
+	for _, event := range results.events {
+		if event.generation < len(attempts) {
+			attempts[event.generation]++
+		}
+	}
+
+	for g := range results.metaSlice {
+
+		var record GenerationRecord
+		record.Generation = g
+		record.Attempts = attempts[g]
+		record.Organs = make(map[string]int)
+
+		for n := range organNames {
+			record.Organs[organNames[n]] = results.metaSlice[g][n]
+			if g > 0 {
+				record.Extravasated += results.metaSlice[g][n] - results.metaSlice[g-1][n]
+			}
+		}
+
+		summary.PerGeneration = append(summary.PerGeneration, record)
+	}
+
+	last := results.metaSlice[len(results.metaSlice)-1]
+	for n := range organNames {
+		summary.Organs[organNames[n]] = last[n]
+	}
+
+	return summary
+}
+
+//OutputEventLog writes the event log of a metastasis run: "events.jsonl" and "events.csv", one record per intravasation attempt,
+//and "summary.json", the totals of the run with its counts per generation. The first error met is returned.
+func OutputEventLog(results MetastasisResults, organNames []string) error {
+
+	err := OutputFileEventsInJSONL(results.events)
+	if err == nil {
+		err = OutputFileEventsInCSV(results.events)
+	}
+	if err == nil {
+		err = OutputFileSummaryInJSON(GetMetastasisSummary(results, organNames))
+	}
+
+	return err
+}
+
+//OutputFileEventsInJSONL writes "events.jsonl", one JSON object per intravasation event.
+func OutputFileEventsInJSONL(events []MetastasisEvent) error {
+
+	filename := GetOutputPath("events.jsonl")
+
+	jsonfile, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(jsonfile)
+	for _, event := range events {
+		err = encoder.Encode(GetEventRecord(event))
+		if err != nil {
+			break
+		}
+	}
+
+	if errClose := jsonfile.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + filename + ": " + err.Error())
+	}
+
+	return nil
+}
+
+//OutputFileEventsInCSV writes "events.csv", one row per intravasation event. z is 0 in 2D.
+func OutputFileEventsInCSV(events []MetastasisEvent) error {
+
+	//Naming the columns
+	output := [][]string{{"generation", "x", "y", "z", "clone", "connectedSize", "clusterSize", "survived", "organ", "fate", "arrival", "reawakened"}}
+
+	for _, event := range events {
+		record := GetEventRecord(event)
+		output = append(output, []string{strconv.Itoa(record.Generation), strconv.Itoa(record.X), strconv.Itoa(record.Y), strconv.Itoa(record.Z),
+			strconv.Itoa(record.Clone), strconv.Itoa(record.ConnectedSize), strconv.Itoa(record.ClusterSize), strconv.FormatBool(record.Survived),
+			record.Organ, record.Fate, strconv.Itoa(record.Arrival), strconv.Itoa(record.Reawakened)})
+	}
+
+	return WriteCSVFile(GetOutputPath("events.csv"), output)
+}
+
+//OutputFileSummaryInJSON writes "summary.json" and prints its totals.
+func OutputFileSummaryInJSON(summary MetastasisSummary) error {
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = WriteOutputFile(GetOutputPath("summary.json"), data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Metastasis: " + strconv.Itoa(summary.Attempts) + " intravasation attempts, " + strconv.Itoa(summary.Survived) + " extravasated")
+
+	return nil
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/csv"
+	"errors"
 	"fmt"
 	"image"
 	"io/ioutil"
@@ -9,15 +9,19 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 //There codes were written by Noah Chang
 
-//OutputFile3DinCSV takes in a 3D slice of Matrix, []Matrix, and outputs a csvfile with a name matching the index of the input.
-//It outputs in the folder "outputcsv3D" under the current directory, removing all the contents under the folder before writing the file.
-func OutputFile3DinCSV(timepoints []Matrix) {
+//OutputFile3DinCSV takes in a 3D slice of Matrix, []Matrix, and outputs a csvfile with a name matching the generation of each matrix,
+//firstGeneration being that of timepoints[0] (above 0 for runs resumed from a snapshot).
+//It outputs in the folder "outputcsv3D" of the run directory, removing the csv files already in the folder before writing the files.
+//The state column holds the hex color of each site in colors (the 3D colors of the renders), for plot3D, and the label column its state.
+//States without a color are left out, as healthy tissue is. The first error met is returned.
+func OutputFile3DinCSV(timepoints []Matrix, firstGeneration int, colors map[string]string) error {
 
 	folderName := "outputcsv3D"
 
@@ -25,7 +29,10 @@ func OutputFile3DinCSV(timepoints []Matrix) {
 	outputFolder := GetNewFolderDir(folderName)
 
 	//If the directory does not exist, make one
-	MakeDirIfNotExist(outputFolder)
+	err := os.MkdirAll(outputFolder, 0755)
+	if err != nil {
+		return err
+	}
 
 	//Delete the previous csv files
 	RefreshDirectory(outputFolder)
@@ -33,21 +40,18 @@ func OutputFile3DinCSV(timepoints []Matrix) {
 	for i := range timepoints {
 
 		//Get filename for ith generation
-		filename := outputFolder + "/3D_Matrix_" + strconv.Itoa(i) + ".csv"
-		csvfile, err := os.Create(filename)
-		if err != nil {
-			fmt.Println("Couldn’t create the file!")
-		}
-		defer csvfile.Close()
+		filename := outputFolder + "/3D_Matrix_" + strconv.Itoa(firstGeneration+i) + ".csv"
 
 		//Setting col names
-		output := [][]string{{"x", "y", "z", "state"}}
+		output := [][]string{{"x", "y", "z", "state", "label"}}
 
 		for x := range timepoints[i] {
 			for y := range timepoints[i][x] {
 				for z := range timepoints[i][x][y] {
 
-					if timepoints[i][x][y][z].state != "h" {
+					state := timepoints[i][x][y][z].state
+
+					if state != "h" && colors[state] != "" {
 						outputCoordinate := make([]string, 0)
 
 						outputCoordinate = append(outputCoordinate, strconv.Itoa(x))
@@ -55,21 +59,9 @@ func OutputFile3DinCSV(timepoints []Matrix) {
 						outputCoordinate = append(outputCoordinate, strconv.Itoa(z))
 
 						//replacing the states with appropriate hex color codes
-						if timepoints[i][x][y][z].state == "C" {
-							outputCoordinate = append(outputCoordinate, "#ADD8E6")
-						}
-
-						//Options for further color coding----------------------------------
-						// if timepoints[i][x][y][z].state == "Q" {
-						// 	outputCoordinate = append(outputCoordinate, "#FFFF00")
-						// }
-						// if timepoints[i][x][y][z].state == "N" {
-						// 	outputCoordinate = append(outputCoordinate, "#8B0000")
-						// }
-						// if timepoints[i][x][y][z].state == "wN" {
-						// 	outputCoordinate = append(outputCoordinate, "#696969")
-						// }
-						//------------------------------------------------------------------
+						outputCoordinate = append(outputCoordinate, colors[state])
+						outputCoordinate = append(outputCoordinate, state)
+
 						output = append(output, outputCoordinate)
 					}
 				}
@@ -77,38 +69,33 @@ func OutputFile3DinCSV(timepoints []Matrix) {
 		}
 
 		//writing csv files
-		writer := csv.NewWriter(csvfile)
-		for _, elements := range output {
-			err := writer.Write(elements)
-			if err != nil {
-				fmt.Println("Error:", err)
-				return
-			}
+		err := WriteCSVFile(filename, output)
+		if err != nil {
+			return err
 		}
-		writer.Flush()
 	}
+
+	return nil
 }
 
 //OutputFile2DinCSV functions similar to OutputFile3DinCSV.
-//It takes in a 2D slice of Matrix, []Matrix, and outputs a csvfile with a name matching the index of the input.
-//It outputs in the folder "outputcsv2D" under the current directory, removing all the contents under the folder before writing the file.
-func OutputFile2DinCSV(timepoints []Matrix2D) {
+//It takes in a 2D slice of Matrix, []Matrix, and outputs a csvfile with a name matching the generation of each matrix.
+//It outputs in the folder "outputcsv2D" of the run directory, removing the csv files already in the folder before writing the files.
+func OutputFile2DinCSV(timepoints []Matrix2D, firstGeneration int) error {
 	folderName := "outputcsv2D"
 
 	outputFolder := GetNewFolderDir(folderName)
 
-	MakeDirIfNotExist(outputFolder)
+	err := os.MkdirAll(outputFolder, 0755)
+	if err != nil {
+		return err
+	}
 
 	RefreshDirectory(outputFolder)
 
 	for i := range timepoints {
 
-		filename := outputFolder + "/2D_Matrix_" + strconv.Itoa(i) + ".csv"
-		csvfile, err := os.Create(filename)
-		if err != nil {
-			fmt.Println("Couldn’t create the file!")
-		}
-		defer csvfile.Close()
+		filename := outputFolder + "/2D_Matrix_" + strconv.Itoa(firstGeneration+i) + ".csv"
 
 		output := [][]string{{"x", "y", "state"}}
 
@@ -126,24 +113,26 @@ func OutputFile2DinCSV(timepoints []Matrix2D) {
 			}
 		}
 
-		writer := csv.NewWriter(csvfile)
-		for _, elements := range output {
-			err := writer.Write(elements)
-			if err != nil {
-				fmt.Println("Error:", err)
-				return
-			}
+		err := WriteCSVFile(filename, output)
+		if err != nil {
+			return err
 		}
-		writer.Flush()
 	}
+
+	return nil
 }
 
 //RefreshDirectory takes in a directory string and removes all *.csv content under it.
 //Edited code from https://stackoverflow.com/questions/33450980/how-to-remove-all-contents-of-a-directory-using-golang
 func RefreshDirectory(dir string) {
+	RefreshDirectoryOf(dir, ".csv")
+}
+
+//RefreshDirectoryOf deletes the files under dir whose name contains ext.
+func RefreshDirectoryOf(dir, ext string) {
 	d, _ := ioutil.ReadDir(dir)
 	for _, files := range d {
-		if strings.Contains(files.Name(), ".csv") {
+		if strings.Contains(files.Name(), ext) {
 			os.Remove(path.Join([]string{dir, files.Name()}...))
 		}
 	}
@@ -151,25 +140,19 @@ func RefreshDirectory(dir string) {
 
 //MakeDirIfNotExist takes in a directory string and makes the directory(folder) if the directory does not exist.
 //Edited code from https://siongui.github.io/2017/03/28/go-create-directory-if-not-exist/
-func MakeDirIfNotExist(dir string) {
+func MakeDirIfNotExist(dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err = os.MkdirAll(dir, 0755)
 		if err != nil {
-			panic("Problem when making a new folder")
+			return errors.New("problem when making folder " + dir + ": " + err.Error())
 		}
 	}
+	return nil
 }
 
-//GetNewFolderDir takes in a folderName string and creates a folder using the input string under the current directory.
+//GetNewFolderDir takes in a folderName string and returns the path of the folder of that name in the run directory.
 func GetNewFolderDir(folderName string) string {
-	currentDirectory, err := os.Getwd()
-	if err != nil {
-		log.Println(err)
-	}
-
-	outputFolder := currentDirectory + "/" + folderName
-
-	return outputFolder
+	return GetOutputPath(folderName)
 }
 
 //ReadPNGs takes in a directory and reads all the ".png" files.
@@ -216,7 +199,7 @@ func ReadPNGs(dir string) []image.Image {
 	return imageList
 }
 
-//SortByFileName takes in a list of files and sort them.
+//SortByFileName takes in a list of files and returns the ".png" plots among them sorted by the generation in their names.
 func SortByFileName(files []os.FileInfo) []os.FileInfo {
 
 	PNGOnly := make([]os.FileInfo, 0)
@@ -229,65 +212,126 @@ func SortByFileName(files []os.FileInfo) []os.FileInfo {
 	}
 	fmt.Println(len(PNGOnly))
 
-	filenumbers := make([]string, 0)
-
-	for i := range PNGOnly {
-		filenumbers = append(filenumbers, strconv.Itoa(i))
-	}
+	//generation in the name of each plot
+	generations := make(map[string]int)
 
 	sortedFiles := make([]os.FileInfo, 0)
 
-	for i := range filenumbers {
-		for _, j := range PNGOnly {
-
-			//indexing is specific! if any change in naming in R should correspond here too!
-			if filenumbers[i] == j.Name()[13:len(j.Name())-5] {
+	for _, j := range PNGOnly {
+		name := j.Name()
 
-				sortedFiles = append(sortedFiles, j)
-
-			}
+		//indexing is specific! if any change in naming in R should correspond here too!
+		if len(name) < 18 {
+			continue
 		}
+		generation, err := strconv.Atoi(name[13 : len(name)-5])
+		if err != nil {
+			continue
+		}
+
+		generations[name] = generation
+		sortedFiles = append(sortedFiles, j)
 	}
 
+	//resumed runs start at the generation of their snapshot
+	sort.Slice(sortedFiles, func(a, b int) bool {
+		return generations[sortedFiles[a].Name()] < generations[sortedFiles[b].Name()]
+	})
+
 	for _, i := range sortedFiles {
 		fmt.Println(i.Name())
 	}
 	return sortedFiles
 }
 
-//OutputFileMetastasisInCSV writes CSV according to the slices of gens of metastasis cell counts
-func OutputFileMetastasisInCSV(metaSlice [][3]int) {
+//OutputFileMetastasisInCSV writes CSV according to the slices of gens of metastasis cell counts, with one column per organ in organNames
+func OutputFileMetastasisInCSV(metaSlice [][]int, organNames []string) error {
 
-	filename := "metastasis.csv"
-	csvfile, err := os.Create(filename)
-	if err != nil {
-		fmt.Println("Couldn’t create the file!")
-	}
-	defer csvfile.Close()
+	filename := GetOutputPath("metastasis.csv")
 
 	//Naming the columns
-	output := [][]string{{"Bones", "Lungs", "Liver"}}
+	output := [][]string{organNames}
 
 	for i := range metaSlice {
 		string := make([]string, 0)
 
 		//Append to each columns
-		string = append(string, strconv.Itoa(metaSlice[i][0]))
-		string = append(string, strconv.Itoa(metaSlice[i][1]))
-		string = append(string, strconv.Itoa(metaSlice[i][2]))
+		for n := range organNames {
+			string = append(string, strconv.Itoa(metaSlice[i][n]))
+		}
 
 		output = append(output, string)
 	}
 
 	//Writing csv files...
-	writer := csv.NewWriter(csvfile)
-	for _, elements := range output {
-		err := writer.Write(elements)
-		if err != nil {
-			fmt.Println("Error:", err)
-			return
+	return WriteCSVFile(filename, output)
+}
+
+//OutputFileCyclePhasesInCSV writes "cellcycle.csv" with the number of cells in each cell cycle phase (and necrotic cells) per generation.
+func OutputFileCyclePhasesInCSV(timepoints []Matrix2D, firstGeneration int) error {
+
+	filename := GetOutputPath("cellcycle.csv")
+
+	//Naming the columns
+	columns := []string{"G1", "S", "G2", "M", "G0", "N"}
+	output := [][]string{append([]string{"generation"}, columns...)}
+
+	for i := range timepoints {
+		counts := GetPhaseCounts2D(timepoints[i])
+
+		row := []string{strconv.Itoa(firstGeneration + i)}
+		for _, phase := range columns {
+			row = append(row, strconv.Itoa(counts[phase]))
 		}
+
+		output = append(output, row)
 	}
-	writer.Flush()
 
+	//Writing csv files...
+	return WriteCSVFile(filename, output)
+}
+
+//OutputFileBurdenInCSV writes "burden.csv", the tumour burden of the primary site (site 0) and of each secondary site per generation,
+//one row per site and generation.
+func OutputFileBurdenInCSV(timepoints []Matrix2D, sites []SecondarySite) error {
+
+	filename := GetOutputPath("burden.csv")
+
+	//Naming the columns
+	output := [][]string{{"generation", "site", "organ", "burden"}}
+
+	for i := range timepoints {
+		output = append(output, []string{strconv.Itoa(i), "0", "Primary", strconv.Itoa(GetTumourBurden2D(timepoints[i]))})
+	}
+
+	for s := range sites {
+		for g := range sites[s].burden {
+			output = append(output, []string{strconv.Itoa(sites[s].start + g), strconv.Itoa(s + 1), sites[s].organ, strconv.Itoa(sites[s].burden[g])})
+		}
+	}
+
+	//Writing csv files...
+	return WriteCSVFile(filename, output)
+}
+
+//OutputFileCirculationInCSV writes "ctc.csv", the time series of circulating tumour cells and dormant cells.
+func OutputFileCirculationInCSV(ctcCounts []CirculationCounts) error {
+
+	filename := GetOutputPath("ctc.csv")
+
+	//Naming the columns
+	output := [][]string{{"generation", "singles", "clusters", "cells", "died", "extravasated", "reawakened", "dormant"}}
+
+	for _, counts := range ctcCounts {
+		row := []int{counts.generation, counts.singles, counts.clusters, counts.cells, counts.died, counts.extravasated, counts.reawakened, counts.dormant}
+
+		line := make([]string, len(row))
+		for c := range row {
+			line[c] = strconv.Itoa(row[c])
+		}
+		output = append(output, line)
+	}
+
+	//Writing csv files...
+	return WriteCSVFile(filename, output)
 }
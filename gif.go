@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"sort"
+)
+
+//GIFDelay is the delay of each frame written by ImagesToGIF, in hundredths of a second.
+var GIFDelay = 10
+
+//ImagesToGIF writes the images as the frames of an animated GIF, filename + ".gif", each shown for GIFDelay.
+func ImagesToGIF(imglist []image.Image, filename string) error {
+
+	delays := make([]int, len(imglist))
+	for i := range delays {
+		delays[i] = GIFDelay
+	}
+
+	return ImagesToGIFWithDelays(imglist, filename, delays)
+}
+
+//ImagesToGIFWithDelays writes the images as the frames of an animated GIF, filename + ".gif", showing frame i for delays[i]
+//hundredths of a second. All frames share one palette of at most 256 colors, quantised from the colors of every frame.
+//The first error met when writing the file is returned.
+func ImagesToGIFWithDelays(imglist []image.Image, filename string, delays []int) error {
+
+	if len(imglist) == 0 {
+		return nil
+	}
+
+	palette := GetPalette(imglist, 256)
+
+	animation := new(gif.GIF)
+	animation.Image = make([]*image.Paletted, len(imglist))
+	animation.Delay = delays
+
+	for i := range imglist {
+		animation.Image[i] = ImageToPaletted(imglist[i], palette)
+	}
+
+	gifFile, err := CreateOutputFile(filename + ".gif")
+	if err != nil {
+		return err
+	}
+
+	err = gif.EncodeAll(gifFile, animation)
+	if errClose := gifFile.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + filename + ".gif: " + err.Error())
+	}
+
+	return nil
+}
+
+//ColorBox is a box of the RGB cube holding some of the colors of a histogram, as split by median cut.
+type ColorBox struct {
+	colors []color.RGBA
+}
+
+//GetPalette returns a palette of at most maxColors colors for a set of images. If the images use no more colors than that,
+//the palette holds exactly their colors; otherwise the colors are quantised by median cut, weighted by how often they occur.
+func GetPalette(imglist []image.Image, maxColors int) color.Palette {
+
+	histogram := make(map[color.RGBA]int)
+
+	for _, img := range imglist {
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				histogram[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)]++
+			}
+		}
+	}
+
+	colors := make([]color.RGBA, 0, len(histogram))
+	for col := range histogram {
+		colors = append(colors, col)
+	}
+
+	//a fixed order, so that the same images always give the same palette
+	sort.Slice(colors, func(a, b int) bool { return ColorKey(colors[a]) < ColorKey(colors[b]) })
+
+	palette := make(color.Palette, 0, maxColors)
+
+	if len(colors) <= maxColors {
+		for _, col := range colors {
+			palette = append(palette, col)
+		}
+		return palette
+	}
+
+	boxes := []ColorBox{{colors}}
+
+	for len(boxes) < maxColors {
+
+		//splitting the box with the widest range of a channel
+		best, bestChannel, bestRange := -1, 0, 0
+		for b := range boxes {
+			if len(boxes[b].colors) < 2 {
+				continue
+			}
+			for channel := 0; channel < 3; channel++ {
+				low, high := GetChannelRange(boxes[b].colors, channel)
+				if high-low > bestRange {
+					best, bestChannel, bestRange = b, channel, high-low
+				}
+			}
+		}
+
+		if best == -1 {
+			break
+		}
+
+		box := boxes[best].colors
+		sort.Slice(box, func(a, b int) bool { return GetChannel(box[a], bestChannel) < GetChannel(box[b], bestChannel) })
+
+		//cutting at the weighted median
+		total := 0
+		for _, col := range box {
+			total += histogram[col]
+		}
+		cut, count := 1, 0
+		for k := range box {
+			count += histogram[box[k]]
+			if 2*count >= total {
+				cut = k + 1
+				break
+			}
+		}
+		if cut >= len(box) {
+			cut = len(box) - 1
+		}
+
+		boxes[best] = ColorBox{box[:cut]}
+		boxes = append(boxes, ColorBox{box[cut:]})
+	}
+
+	//each box is represented by the weighted mean of its colors
+	for _, box := range boxes {
+		var r, g, b, a, weight int
+		for _, col := range box.colors {
+			w := histogram[col]
+			r += int(col.R) * w
+			g += int(col.G) * w
+			b += int(col.B) * w
+			a += int(col.A) * w
+			weight += w
+		}
+		palette = append(palette, color.RGBA{uint8(r / weight), uint8(g / weight), uint8(b / weight), uint8(a / weight)})
+	}
+
+	return palette
+}
+
+//ColorKey packs a color into one number, for sorting.
+func ColorKey(col color.RGBA) uint32 {
+	return uint32(col.R)<<24 | uint32(col.G)<<16 | uint32(col.B)<<8 | uint32(col.A)
+}
+
+//GetChannel returns the red (0), green (1) or blue (2) component of a color.
+func GetChannel(col color.RGBA, channel int) int {
+
+	if channel == 0 {
+		return int(col.R)
+	} else if channel == 1 {
+		return int(col.G)
+	}
+
+	return int(col.B)
+}
+
+//GetChannelRange returns the lowest and highest value of a channel over colors.
+func GetChannelRange(colors []color.RGBA, channel int) (int, int) {
+
+	low, high := 255, 0
+
+	for _, col := range colors {
+		value := GetChannel(col, channel)
+		if value < low {
+			low = value
+		}
+		if value > high {
+			high = value
+		}
+	}
+
+	return low, high
+}
+
+//ImageToPaletted maps every pixel of an image to the nearest color of the palette.
+func ImageToPaletted(img image.Image, palette color.Palette) *image.Paletted {
+
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(bounds, palette)
+
+	//images have few distinct colors, so each is matched only once
+	indices := make(map[color.RGBA]uint8)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+
+			index, ok := indices[col]
+			if ok == false {
+				index = uint8(palette.Index(col))
+				indices[col] = index
+			}
+
+			paletted.SetColorIndex(x, y, index)
+		}
+	}
+
+	return paletted
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//TestImagesToGIFExactColors checks that frames of few colors are written without loss, with their delays.
+func TestImagesToGIFExactColors(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	colors := []color.RGBA{{255, 255, 255, 255}, {173, 216, 230, 255}, {139, 0, 0, 255}, {105, 105, 105, 255}}
+
+	imglist := make([]image.Image, 3)
+	for i := range imglist {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 7))
+		for y := 0; y < 7; y++ {
+			for x := 0; x < 10; x++ {
+				img.SetRGBA(x, y, colors[(x+y+i)%len(colors)])
+			}
+		}
+		imglist[i] = img
+	}
+	delays := []int{5, 10, 20}
+
+	filename := filepath.Join(dir, "growth")
+	err = ImagesToGIFWithDelays(imglist, filename, delays)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename + ".gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(animation.Image) != len(imglist) || reflect.DeepEqual(animation.Delay, delays) == false {
+		t.Fatalf("%d frames with delays %v, expected %d with %v", len(animation.Image), animation.Delay, len(imglist), delays)
+	}
+
+	for i := range imglist {
+		for y := 0; y < 7; y++ {
+			for x := 0; x < 10; x++ {
+				read := color.RGBAModel.Convert(animation.Image[i].At(x, y))
+				if read != imglist[i].At(x, y) {
+					t.Fatalf("frame %d pixel %d %d read as %v, written as %v", i, x, y, read, imglist[i].At(x, y))
+				}
+			}
+		}
+	}
+}
+
+//TestGetPaletteQuantised checks that images of more than 256 colors get a palette of 256, close to every color.
+func TestGetPaletteQuantised(t *testing.T) {
+
+	//4096 colors, 17 apart on each channel
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x%16) * 17, uint8(y%16) * 17, uint8(x/16+y/16*4) * 17, 255})
+		}
+	}
+
+	palette := GetPalette([]image.Image{img}, 256)
+	if len(palette) > 256 {
+		t.Fatalf("palette of %d colors", len(palette))
+	}
+
+	paletted := ImageToPaletted(img, palette)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			written := img.RGBAAt(x, y)
+			read := color.RGBAModel.Convert(paletted.At(x, y)).(color.RGBA)
+
+			for channel := 0; channel < 3; channel++ {
+				difference := GetChannel(written, channel) - GetChannel(read, channel)
+				if difference > 48 || difference < -48 {
+					t.Fatalf("pixel %d %d of color %v quantised to %v", x, y, written, read)
+				}
+			}
+		}
+	}
+}
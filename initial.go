@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//SeedConfig describes one tumour seed of the initial conditions.
+//Shape is one of:
+//
+//	"point"    a single site at X,Y(,Z)
+//	"diamond"  the sites within Radius von Neumann steps of X,Y(,Z) (the default seed is a diamond of radius 2)
+//	"disk"     the sites within Euclidean distance Radius of X,Y(,Z); "sphere" is the same shape
+//	"random"   every site in the field of the lattice
+//	"mask"     the bright pixels of the PNG File, resampled to the lattice (in 3D, on the plane of aisle Z)
+//	"csv"      the sites listed in File, a CSV written by OutputFile2DinCSV or OutputFile3DinCSV
+//
+//Each site of the shape is seeded with probability Density (0 is read as 1), with a state drawn from Composition.
+type SeedConfig struct {
+	Shape   string  `json:"shape"`
+	X       int     `json:"x"`
+	Y       int     `json:"y"`
+	Z       int     `json:"z"`
+	Radius  int     `json:"radius"`
+	File    string  `json:"file"`
+	Density float64 `json:"density"`
+
+	//Composition gives the fraction of seeded sites in each state, e.g. {"C": 0.8, "Q": 0.2}. Fractions summing to less than 1
+	//leave the remaining sites healthy. Empty means all "C". Ignored by "csv", which has its own states.
+	Composition map[string]float64 `json:"composition"`
+
+	//Clone labels the cells of the seed and their progeny. 0 gives each seed its position in the list, counting from 1.
+	Clone int `json:"clone"`
+}
+
+//SeedCentralDiamond2D seeds cancerous cells on the central cell, its neighbors and their neighbors (the default initial condition).
+func SeedCentralDiamond2D(matrix Matrix2D) Matrix2D {
+
+	x := GetNumRows2D(matrix)
+	y := GetNumCols2D(matrix)
+
+	//seeding with cancerous cells at center.
+	centerCell := GetCentralCell2D(matrix)
+
+	cellNhd := GetCurrentNeighborhood2D(matrix, centerCell.location.x, centerCell.location.y, x, y)
+
+	for n := range cellNhd.neighbors { //of all neighbors to given cell...
+
+		matrix[cellNhd.neighbors[n].location.x][cellNhd.neighbors[n].location.y].state = "C"
+
+		i := cellNhd.neighbors[n].location.x
+		j := cellNhd.neighbors[n].location.y
+
+		//...get the neighborhood of that cell
+		neighborNhd := GetCurrentNeighborhood2D(matrix, i, j, x, y)
+
+		//meta step: ranging over neighborhood of that original cell's neighbors.
+		for m := range neighborNhd.neighbors {
+			matrix[neighborNhd.neighbors[m].location.x][neighborNhd.neighbors[m].location.y].state = "C"
+
+		}
+	}
+
+	matrix[centerCell.location.x][centerCell.location.y].state = "C"
+
+	//all cells of the default seed belong to the first clone
+	for i := range matrix {
+		for j := range matrix[i] {
+			if matrix[i][j].state == "C" {
+				matrix[i][j].clone = 1
+			}
+		}
+	}
+
+	return matrix
+}
+
+//SeedInitialConditions2D seeds a matrix with each of the seeds in turn. Later seeds overwrite earlier ones where they overlap.
+func SeedInitialConditions2D(matrix Matrix2D, seeds []SeedConfig) Matrix2D {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	for s, seed := range seeds {
+
+		clone := seed.Clone
+		if clone == 0 {
+			clone = s + 1
+		}
+
+		if seed.Shape == "csv" {
+			sites, err := ReadInitialCSV(seed.File)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, row := range sites {
+				if row.x >= 0 && row.x < numRows && row.y >= 0 && row.y < numCols {
+					matrix[row.x][row.y].state = row.state
+					matrix[row.x][row.y].clone = clone
+					if row.clone > 0 {
+						matrix[row.x][row.y].clone = row.clone
+					}
+				}
+			}
+			continue
+		}
+
+		var mask [][]float64
+		if seed.Shape == "mask" {
+			mask = ReadGrayscaleImage(seed.File, numRows, numCols)
+		}
+
+		for i := range matrix {
+			for j := range matrix[i] {
+
+				inShape := false
+
+				if seed.Shape == "mask" {
+					inShape = mask[i][j] > 0.5
+				} else if seed.Shape == "random" {
+					inShape = InField2D(i, j, numRows, numCols)
+				} else {
+					inShape = InSeedShape(seed, float64(i-seed.X), float64(j-seed.Y), 0.0)
+				}
+
+				if inShape == true {
+					state := DrawSeedState(seed)
+					if state != "" {
+						matrix[i][j].state = state
+						matrix[i][j].clone = clone
+					}
+				}
+			}
+		}
+	}
+
+	return matrix
+}
+
+//SeedInitialConditions3D is the 3D version of SeedInitialConditions2D.
+//Only the states of the 3D model (VTKStates) can be seeded; any other state in a composition or CSV stops the program.
+func SeedInitialConditions3D(matrix Matrix, seeds []SeedConfig) Matrix {
+
+	numRows := GetNumRows(matrix)
+	numCols := GetNumCols(matrix)
+	numAisles := GetNumAisles(matrix)
+
+	for _, seed := range seeds {
+		for state := range seed.Composition {
+			if IsState3D(state) == false {
+				panic("Seed state " + state + " is not a 3D state: h, C, Q, N or wN")
+			}
+		}
+	}
+
+	for s, seed := range seeds {
+
+		clone := seed.Clone
+		if clone == 0 {
+			clone = s + 1
+		}
+
+		if seed.Shape == "csv" {
+			sites, err := ReadInitialCSV(seed.File)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, row := range sites {
+				if IsState3D(row.state) == false {
+					log.Fatal("State " + row.state + " in " + seed.File + " is not a 3D state: h, C, Q, N or wN")
+				}
+				if row.x >= 0 && row.x < numRows && row.y >= 0 && row.y < numCols && row.z >= 0 && row.z < numAisles {
+					matrix[row.x][row.y][row.z].state = row.state
+					matrix[row.x][row.y][row.z].clone = clone
+					if row.clone > 0 {
+						matrix[row.x][row.y][row.z].clone = row.clone
+					}
+				}
+			}
+			continue
+		}
+
+		var mask [][]float64
+		if seed.Shape == "mask" {
+			mask = ReadGrayscaleImage(seed.File, numRows, numCols)
+		}
+
+		for i := range matrix {
+			for j := range matrix[i] {
+				for k := range matrix[i][j] {
+
+					inShape := false
+
+					if seed.Shape == "mask" {
+						inShape = k == seed.Z && mask[i][j] > 0.5
+					} else if seed.Shape == "random" {
+						inShape = InField3D(i, j, k, numRows, numCols, numAisles)
+					} else {
+						inShape = InSeedShape(seed, float64(i-seed.X), float64(j-seed.Y), float64(k-seed.Z))
+					}
+
+					if inShape == true {
+						state := DrawSeedState(seed)
+						if state != "" {
+							matrix[i][j][k].state = state
+							matrix[i][j][k].clone = clone
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return matrix
+}
+
+//IsState3D returns true if state is one of the states of the 3D model.
+func IsState3D(state string) bool {
+
+	for _, name := range VTKStates {
+		if state == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+//InSeedShape returns true if the offset dx,dy,dz from the seed's center lies in its "point", "diamond" or "disk"/"sphere" shape.
+func InSeedShape(seed SeedConfig, dx, dy, dz float64) bool {
+
+	radius := float64(seed.Radius)
+
+	if seed.Shape == "point" {
+		return dx == 0 && dy == 0 && dz == 0
+	} else if seed.Shape == "diamond" {
+		return math.Abs(dx)+math.Abs(dy)+math.Abs(dz) <= radius
+	} else if seed.Shape == "disk" || seed.Shape == "sphere" {
+		return dx*dx+dy*dy+dz*dz <= radius*radius
+	}
+
+	panic("Seed shape has to be point, diamond, disk, sphere, random, mask or csv")
+}
+
+//DrawSeedState picks the state of one site of a seed: "" if the site is left unseeded (by density or composition),
+//otherwise a state drawn from the seed's composition.
+func DrawSeedState(seed SeedConfig) string {
+
+	density := seed.Density
+	if density == 0 {
+		density = 1.0
+	}
+
+	if RNG.Float64() >= density {
+		return ""
+	}
+
+	if len(seed.Composition) == 0 {
+		return "C"
+	}
+
+	//states are taken in a fixed order so that runs with the same random seed agree
+	others := make([]string, 0)
+	for state := range seed.Composition {
+		if state != "C" && state != "Q" && state != "N" && state != "wN" {
+			others = append(others, state)
+		}
+	}
+	sort.Strings(others)
+	states := append([]string{"C", "Q", "N", "wN"}, others...)
+
+	draw := RNG.Float64()
+	for _, state := range states {
+		if draw < seed.Composition[state] {
+			return state
+		}
+		draw -= seed.Composition[state]
+	}
+
+	return ""
+}
+
+//InitialSite is one row of a CSV of initial conditions.
+type InitialSite struct {
+	x, y, z, clone int
+	state          string
+}
+
+//ReadInitialCSV reads the sites of a CSV written by OutputFile2DinCSV or OutputFile3DinCSV (columns are found by their header,
+//so "z" and "clone" are optional). The states are read from the label column of OutputFile3DinCSV if there is one;
+//otherwise the hex colors of its original palette are turned back into states.
+//A missing x, y or state column, a short row or a bad number is returned as an error.
+func ReadInitialCSV(filename string) ([]InitialSite, error) {
+
+	csvfile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer csvfile.Close()
+
+	//the length of the rows is checked below, for a clearer error
+	reader := csv.NewReader(csvfile)
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.New("problem when reading initial conditions " + filename + ": " + err.Error())
+	}
+
+	sites := make([]InitialSite, 0)
+
+	if len(rows) == 0 {
+		return sites, nil
+	}
+
+	//column of each header name
+	columns := make(map[string]int)
+	for c, name := range rows[0] {
+		columns[name] = c
+	}
+
+	//the coordinates and either the state or the label are required
+	for _, name := range []string{"x", "y"} {
+		if _, ok := columns[name]; ok == false {
+			return nil, errors.New("initial conditions " + filename + " have no " + name + " column")
+		}
+	}
+	_, hasLabel := columns["label"]
+	_, hasState := columns["state"]
+	if hasLabel == false && hasState == false {
+		return nil, errors.New("initial conditions " + filename + " have no state or label column")
+	}
+
+	for r, row := range rows[1:] {
+
+		//line of the row in the file, for the errors
+		line := strconv.Itoa(r + 2)
+
+		if len(row) != len(rows[0]) {
+			return nil, errors.New("initial conditions " + filename + " line " + line + " has " + strconv.Itoa(len(row)) + " columns instead of " + strconv.Itoa(len(rows[0])))
+		}
+
+		var site InitialSite
+
+		//the integer columns, read when the header has them
+		values := map[string]*int{"x": &site.x, "y": &site.y, "z": &site.z, "clone": &site.clone}
+
+		for _, name := range []string{"x", "y", "z", "clone"} {
+			c, ok := columns[name]
+			if ok == false {
+				continue
+			}
+
+			value, err := strconv.Atoi(row[c])
+			if err != nil {
+				return nil, errors.New("initial conditions " + filename + " line " + line + " has a bad " + name + ": " + err.Error())
+			}
+			*values[name] = value
+		}
+
+		if hasLabel == true {
+			site.state = row[columns["label"]]
+		} else {
+			site.state = GetStateFromCSV(row[columns["state"]])
+		}
+
+		sites = append(sites, site)
+	}
+
+	return sites, nil
+}
+
+//GetStateFromCSV returns the state written in a CSV cell, translating the hex colors of OutputFile3DinCSV.
+func GetStateFromCSV(value string) string {
+
+	hexStates := map[string]string{"#ADD8E6": "C", "#FFFF00": "Q", "#8B0000": "N", "#696969": "wN"}
+
+	if state, ok := hexStates[strings.ToUpper(value)]; ok == true {
+		return state
+	}
+
+	return value
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//WriteTestCSV writes the lines of a CSV to name in dir and returns the path of the file.
+func WriteTestCSV(t *testing.T, dir, name string, lines ...string) string {
+
+	filename := filepath.Join(dir, name)
+
+	err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+//TestReadInitialCSV checks the sites read from CSV files of initial conditions, with and without the optional columns.
+func TestReadInitialCSV(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		lines []string
+		sites []InitialSite
+	}{
+		{"2D", []string{"x,y,state", "1,2,C", "3,4,N"},
+			[]InitialSite{{x: 1, y: 2, state: "C"}, {x: 3, y: 4, state: "N"}}},
+		{"3D colors", []string{"x,y,z,state", "1,2,3,#adD8E6", "4,5,6,#696969"},
+			[]InitialSite{{x: 1, y: 2, z: 3, state: "C"}, {x: 4, y: 5, z: 6, state: "wN"}}},
+		{"3D labels", []string{"x,y,z,state,label", "1,2,3,#ADD8E6,Q"},
+			[]InitialSite{{x: 1, y: 2, z: 3, state: "Q"}}},
+		{"clones in any order", []string{"clone,state,y,x", "2,C,5,6"},
+			[]InitialSite{{x: 6, y: 5, clone: 2, state: "C"}}},
+		{"header only", []string{"x,y,state"},
+			[]InitialSite{}},
+	}
+
+	for _, test := range tests {
+		filename := WriteTestCSV(t, dir, "sites.csv", test.lines...)
+
+		sites, err := ReadInitialCSV(filename)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+		} else if reflect.DeepEqual(sites, test.sites) == false {
+			t.Errorf("%s: read %+v, expected %+v", test.name, sites, test.sites)
+		}
+	}
+}
+
+//TestReadInitialCSVErrors checks that missing columns, short rows and bad numbers are returned as errors naming the problem.
+func TestReadInitialCSVErrors(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		lines []string
+		error string
+	}{
+		{"no y", []string{"x,state", "1,C"}, "no y column"},
+		{"no state", []string{"x,y,clone", "1,2,3"}, "no state or label column"},
+		{"short row", []string{"x,y,state", "1,2,C", "3,4"}, "line 3 has 2 columns instead of 3"},
+		{"bad x", []string{"x,y,state", "one,2,C"}, "line 2 has a bad x"},
+		{"bad clone", []string{"x,y,state,clone", "1,2,C,1.5"}, "line 2 has a bad clone"},
+	}
+
+	for _, test := range tests {
+		filename := WriteTestCSV(t, dir, "sites.csv", test.lines...)
+
+		_, err := ReadInitialCSV(filename)
+		if err == nil {
+			t.Errorf("%s: read without error", test.name)
+		} else if strings.Contains(err.Error(), test.error) == false {
+			t.Errorf("%s: error %q, expected one about %q", test.name, err.Error(), test.error)
+		}
+	}
+
+	_, err = ReadInitialCSV(filepath.Join(dir, "missing.csv"))
+	if err == nil {
+		t.Error("missing file: read without error")
+	}
+}
+
+//TestReadInitialCSVOutput checks that the CSV files written by a run are read back as its sites.
+func TestReadInitialCSVOutput(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	previous := OutputDir
+	OutputDir = dir
+	defer func() { OutputDir = previous }()
+
+	SeedRandom(5)
+	config := ReadConfig("")
+
+	matrix2D := InitialMatrix2D(15, 15, config)
+	matrix2D = Update2DMatrix(matrix2D, 3, 3, 1, config)
+
+	err = OutputFile2DinCSV([]Matrix2D{matrix2D}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sites, err := ReadInitialCSV(filepath.Join(dir, "outputcsv2D", "2D_Matrix_4.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) == 0 {
+		t.Fatal("no sites read")
+	}
+	for _, site := range sites {
+		if matrix2D[site.x][site.y].state != site.state {
+			t.Fatalf("site %d %d read as %s, written as %s", site.x, site.y, site.state, matrix2D[site.x][site.y].state)
+		}
+	}
+
+	matrix3D := SeedMatrix3D(Initialize3DMatrix(7, 7, 7), config)
+	matrix3D[1][2][3].state = "N"
+
+	err = OutputFile3DinCSV([]Matrix{matrix3D}, 0, config.Render.Colors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sites, err = ReadInitialCSV(filepath.Join(dir, "outputcsv3D", "3D_Matrix_0.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != CountSurfaceSites(matrix3D, []string{"C", "Q", "N", "wN"}) {
+		t.Fatalf("%d sites read", len(sites))
+	}
+	for _, site := range sites {
+		if matrix3D[site.x][site.y][site.z].state != site.state {
+			t.Fatalf("site %d %d %d read as %s, written as %s", site.x, site.y, site.z, site.state, matrix3D[site.x][site.y][site.z].state)
+		}
+	}
+}
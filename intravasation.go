@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+)
+
+//IntravasationConfig holds the settings of the cancer cells shed into a ruptured vessel.
+//The cells shed are those of the connected cancer cluster touching the vessel, up to MaxClusterSize of them taken closest to the vessel first.
+type IntravasationConfig struct {
+
+	//MaxClusterSize is the largest number of cells shed together
+	MaxClusterSize int `json:"maxClusterSize"`
+
+	//Survival is the curve giving the chance that n cells shed together survive the circulation:
+	//
+	//	"step"        SingleSurvival for a single cell, ClusterSurvival for any cluster (the original model)
+	//	"power"       SingleSurvival * n^Exponent
+	//	"saturating"  ClusterSurvival - (ClusterSurvival - SingleSurvival) * exp(-(n-1)/Scale)
+	//
+	//Probabilities above one are read as one. The curve is not used when the circulation compartment is enabled.
+	Survival        string  `json:"survival"`
+	SingleSurvival  float64 `json:"singleSurvival"`
+	ClusterSurvival float64 `json:"clusterSurvival"`
+	Exponent        float64 `json:"exponent"`
+	Scale           float64 `json:"scale"`
+}
+
+//DefaultIntravasationConfig returns the literature survival of single cells (5 in 10000) and clusters (250 in 10000).
+func DefaultIntravasationConfig() IntravasationConfig {
+
+	var intravasationConfig IntravasationConfig
+
+	intravasationConfig.MaxClusterSize = 20
+	intravasationConfig.Survival = "step"
+	intravasationConfig.SingleSurvival = 0.0005
+	intravasationConfig.ClusterSurvival = 0.025
+	intravasationConfig.Exponent = 1.5
+	intravasationConfig.Scale = 3.0
+
+	return intravasationConfig
+}
+
+//GetConnectedCluster2D returns the sites of the connected cluster of living cancer cells ("C" and "Q") containing the site i,j,
+//in breadth-first order from i,j over von Neumann neighbors, so the sites closest to i,j come first.
+//It returns an empty cluster if i,j holds no cancer cell.
+func GetConnectedCluster2D(matrix Matrix2D, i, j int) []OrderedPair {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	cluster := make([]OrderedPair, 0)
+
+	if matrix[i][j].state != "C" && matrix[i][j].state != "Q" {
+		return cluster
+	}
+
+	start := OrderedPair{i, j}
+	visited := map[OrderedPair]bool{start: true}
+	queue := []OrderedPair{start}
+
+	for len(queue) > 0 {
+
+		site := queue[0]
+		queue = queue[1:]
+		cluster = append(cluster, site)
+
+		nextSites := []OrderedPair{{site.x - 1, site.y}, {site.x + 1, site.y}, {site.x, site.y - 1}, {site.x, site.y + 1}}
+		for _, next := range nextSites {
+			if next.x < 0 || next.x >= numRows || next.y < 0 || next.y >= numCols || visited[next] == true {
+				continue
+			}
+			if matrix[next.x][next.y].state == "C" || matrix[next.x][next.y].state == "Q" {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return cluster
+}
+
+//GetShedClusterSize returns the number of cells shed into a vessel from a connected cluster of clusterSize cells.
+func GetShedClusterSize(clusterSize int, intravasationConfig IntravasationConfig) int {
+
+	if intravasationConfig.MaxClusterSize > 0 && clusterSize > intravasationConfig.MaxClusterSize {
+		return intravasationConfig.MaxClusterSize
+	}
+
+	return clusterSize
+}
+
+//GetSurvivalProbability returns the chance that n cells shed together survive the circulation, following the survival curve.
+func GetSurvivalProbability(n int, intravasationConfig IntravasationConfig) float64 {
+
+	var prob float64
+
+	if intravasationConfig.Survival == "step" {
+		prob = intravasationConfig.ClusterSurvival
+		if n == 1 {
+			prob = intravasationConfig.SingleSurvival
+		}
+	} else if intravasationConfig.Survival == "power" {
+		prob = intravasationConfig.SingleSurvival * math.Pow(float64(n), intravasationConfig.Exponent)
+	} else if intravasationConfig.Survival == "saturating" {
+		prob = intravasationConfig.ClusterSurvival - (intravasationConfig.ClusterSurvival-intravasationConfig.SingleSurvival)*math.Exp(-float64(n-1)/intravasationConfig.Scale)
+	} else {
+		panic("Survival curve has to be step, power or saturating")
+	}
+
+	return math.Min(1.0, prob)
+}
+
+//SurvivalCheckSize decides whether n cells shed together survive the circulation.
+func SurvivalCheckSize(n int, intravasationConfig IntravasationConfig) bool {
+	return RNG.Float64() < GetSurvivalProbability(n, intravasationConfig)
+}
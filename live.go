@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//LiveStates are the states counted in the stats sent to the live viewer.
+var LiveStates = []string{"C", "Q", "N", "wN"}
+
+//LiveServer runs a simulation one generation at a time, streaming each frame and its population counts to the browsers
+//connected to it, as server-sent events. The coupling constants can be changed and the run paused, resumed and stepped meanwhile.
+type LiveServer struct {
+	lock sync.Mutex
+	wake *sync.Cond
+
+	//"2D" or "3D", and the lattice of that dimension
+	dimension string
+	matrix2D  Matrix2D
+	matrix3D  Matrix
+
+	generation, numGens int
+	Kcc, Knn, Knc       float64
+
+	//paused runs only advance by the steps asked for
+	paused bool
+	steps  int
+
+	config Config
+
+	//counts of LiveStates at every generation so far, and the last frame as a data URL
+	populations [][]int
+	frame       string
+
+	//channels of the connected browsers
+	clients map[chan []byte]bool
+}
+
+//LiveMessage is the event sent to the browsers after every generation and every change of the settings.
+type LiveMessage struct {
+	Generation int               `json:"generation"`
+	NumGens    int               `json:"numGens"`
+	Paused     bool              `json:"paused"`
+	Kcc        float64           `json:"Kcc"`
+	Knn        float64           `json:"Knn"`
+	Knc        float64           `json:"Knc"`
+	Counts     map[string]int    `json:"counts"`
+	Colors     map[string]string `json:"colors"`
+	Frame      string            `json:"frame"`
+}
+
+//NewLiveServer returns a live server of a new 2D or 3D simulation of numGens generations, seeded as in config.
+func NewLiveServer(dimension string, numGens int, Kcc, Knn, Knc float64, config Config) *LiveServer {
+
+	server := &LiveServer{dimension: dimension, numGens: numGens, Kcc: Kcc, Knn: Knn, Knc: Knc, config: config}
+	server.wake = sync.NewCond(&server.lock)
+	server.clients = make(map[chan []byte]bool)
+
+	if dimension == "2D" {
+		server.matrix2D = InitialMatrix2D(201, 201, config)
+	} else if dimension == "3D" {
+		server.matrix3D = SeedMatrix3D(Initialize3DMatrix(100, 100, 100), config)
+	} else {
+		panic("Live viewer dimension has to be 2D or 3D")
+	}
+
+	server.DrawFrame()
+
+	return server
+}
+
+//Serve runs the simulation and serves the viewer at addr until the program is stopped. At most fps generations are run a second.
+func (s *LiveServer) Serve(addr string, fps int) {
+
+	go s.Run(fps)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.HandlePage)
+	mux.HandleFunc("/events", s.HandleEvents)
+	mux.HandleFunc("/control", s.HandleControl)
+
+	fmt.Println("Live viewer at http://" + addr)
+
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+//Run updates the lattice generation after generation, waiting while the run is paused or finished.
+func (s *LiveServer) Run(fps int) {
+
+	for {
+		s.lock.Lock()
+		for s.generation >= s.numGens || (s.paused == true && s.steps == 0) {
+			s.wake.Wait()
+		}
+		if s.steps > 0 {
+			s.steps--
+		}
+		Kcc, Knn, Knc := s.Kcc, s.Knn, s.Knc
+		s.lock.Unlock()
+
+		//only this goroutine changes the lattice, so it is updated without holding the lock
+		if s.dimension == "2D" {
+			s.matrix2D = Update2DMatrix(s.matrix2D, Kcc, Knn, Knc, s.config)
+		} else {
+			s.matrix3D = UpdateMatrix(s.matrix3D, Kcc, Knn, Knc)
+		}
+
+		s.lock.Lock()
+		s.generation++
+		s.lock.Unlock()
+
+		s.DrawFrame()
+
+		time.Sleep(time.Second / time.Duration(fps))
+	}
+}
+
+//DrawFrame draws the current lattice, with the overlays if enabled, counts its states and sends both to the browsers.
+func (s *LiveServer) DrawFrame() {
+
+	var img image.Image
+	var counts []int
+
+	if s.dimension == "2D" {
+		img = DrawMatrix2D(s.matrix2D, 1, GetNumRows2D(s.matrix2D), GetNumCols2D(s.matrix2D), s.config.Palette)
+		counts = CountStates2D(s.matrix2D, LiveStates)
+	} else {
+		img = RenderMatrix3D(s.matrix3D, s.config.Render, s.config.Render.Azimuth)
+		counts = CountStates3D(s.matrix3D, LiveStates)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.populations = append(s.populations, counts)
+
+	if s.config.Overlay.Enabled == true {
+		img = s.DrawOverlay(img)
+	}
+
+	var data bytes.Buffer
+	err := png.Encode(&data, img)
+	if err != nil {
+		log.Fatal("Problem when encoding a live frame: " + err.Error())
+	}
+
+	s.frame = "data:image/png;base64," + base64.StdEncoding.EncodeToString(data.Bytes())
+
+	s.Broadcast()
+}
+
+//DrawOverlay draws the overlays of the config into a frame, charting the generations run so far.
+func (s *LiveServer) DrawOverlay(img image.Image) image.Image {
+
+	overlayConfig := s.config.Overlay
+
+	//the chart shows the states of the overlays, counted again as they may differ from LiveStates
+	populations := make([][]int, len(s.populations))
+	for g := range populations {
+		populations[g] = make([]int, len(overlayConfig.ChartStates))
+		for c, chartState := range overlayConfig.ChartStates {
+			for l, liveState := range LiveStates {
+				if chartState == liveState {
+					populations[g][c] = s.populations[g][l]
+				}
+			}
+		}
+	}
+
+	if s.dimension == "2D" {
+		states := append(append([]string{}, overlayConfig.LegendStates...), overlayConfig.ChartStates...)
+		return OverlayFrame(img, s.generation, populations, GetStateColors2D(states, s.config.Palette), 1, overlayConfig)
+	}
+
+	return OverlayFrame(img, s.generation, populations, GetRenderColors3D(s.config.Render), 0, overlayConfig)
+}
+
+//GetMessage returns the current event for the browsers. The lock must be held.
+func (s *LiveServer) GetMessage() []byte {
+
+	var message LiveMessage
+
+	message.Generation = s.generation
+	message.NumGens = s.numGens
+	message.Paused = s.paused
+	message.Kcc = s.Kcc
+	message.Knn = s.Knn
+	message.Knc = s.Knc
+	message.Frame = s.frame
+
+	message.Counts = make(map[string]int)
+	last := s.populations[len(s.populations)-1]
+	for i, state := range LiveStates {
+		message.Counts[state] = last[i]
+	}
+
+	//the page charts the states in the colors of the frames
+	message.Colors = GetStateHexColors2D(s.config.Palette)
+	if s.dimension == "3D" {
+		message.Colors = s.config.Render.Colors
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return data
+}
+
+//Broadcast sends the current event to every browser. A browser that has not taken the last event yet misses this one.
+//The lock must be held.
+func (s *LiveServer) Broadcast() {
+
+	message := s.GetMessage()
+
+	for client := range s.clients {
+		select {
+		case client <- message:
+		default:
+		}
+	}
+}
+
+//HandlePage serves the viewer page.
+func (s *LiveServer) HandlePage(w http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, LivePage)
+}
+
+//HandleEvents streams the events to a browser, starting with the current one, until it disconnects.
+func (s *LiveServer) HandleEvents(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if ok == false {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	client := make(chan []byte, 1)
+
+	s.lock.Lock()
+	s.clients[client] = true
+	client <- s.GetMessage()
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, client)
+		s.lock.Unlock()
+	}()
+
+	for {
+		select {
+		case message := <-client:
+			fmt.Fprintf(w, "data: %s\n\n", message)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+//HandleControl changes the run as posted by the page: action "pause", "resume" or "step", and new values of Kcc, Knn and Knc.
+func (s *LiveServer) HandleControl(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Controls have to be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	//reading every constant before changing any
+	constants := make(map[string]float64)
+	for _, name := range []string{"Kcc", "Knn", "Knc"} {
+		if value := r.PostForm.Get(name); value != "" {
+			constants[name], err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				http.Error(w, name+" has to be a number", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	action := r.PostForm.Get("action")
+	if action != "" && action != "pause" && action != "resume" && action != "step" {
+		http.Error(w, "Action has to be pause, resume or step", http.StatusBadRequest)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if value, ok := constants["Kcc"]; ok == true {
+		s.Kcc = value
+	}
+	if value, ok := constants["Knn"]; ok == true {
+		s.Knn = value
+	}
+	if value, ok := constants["Knc"]; ok == true {
+		s.Knc = value
+	}
+
+	if action == "pause" {
+		s.paused = true
+	} else if action == "resume" {
+		s.paused = false
+	} else if action == "step" {
+		s.paused = true
+		s.steps++
+	}
+
+	s.wake.Broadcast()
+	s.Broadcast()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//LivePage is the viewer: the frame, a chart of the populations, and the controls of the run.
+const LivePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tumour growth</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+#frame { width: 603px; image-rendering: pixelated; border: 1px solid #ccc; }
+#panel { display: inline-block; vertical-align: top; margin-left: 20px; }
+input { width: 60px; }
+td { padding-right: 12px; }
+</style>
+</head>
+<body>
+<img id="frame">
+<div id="panel">
+<p id="generation"></p>
+<p>
+<button onclick="control({action: 'pause'})">Pause</button>
+<button onclick="control({action: 'resume'})">Resume</button>
+<button onclick="control({action: 'step'})">Step</button>
+</p>
+<p>
+Kcc <input id="Kcc"> Knn <input id="Knn"> Knc <input id="Knc">
+<button onclick="control({Kcc: value('Kcc'), Knn: value('Knn'), Knc: value('Knc')})">Apply</button>
+</p>
+<table id="counts"></table>
+<canvas id="chart" width="400" height="200"></canvas>
+</div>
+<script>
+var states = ["C", "Q", "N", "wN"];
+var colors = {};
+var populationHistory = [];
+var edited = false;
+
+function value(id) { return document.getElementById(id).value; }
+
+function control(fields) {
+	edited = false;
+	fetch("/control", {method: "POST", body: new URLSearchParams(fields)});
+}
+
+["Kcc", "Knn", "Knc"].forEach(function(id) {
+	document.getElementById(id).addEventListener("input", function() { edited = true; });
+});
+
+function drawChart() {
+	var canvas = document.getElementById("chart");
+	var context = canvas.getContext("2d");
+	context.clearRect(0, 0, canvas.width, canvas.height);
+	context.strokeStyle = "#999";
+	context.strokeRect(0, 0, canvas.width, canvas.height);
+
+	var highest = 1, last = 1;
+	populationHistory.forEach(function(point) {
+		last = Math.max(last, point.generation);
+		for (var state in point.counts) { highest = Math.max(highest, point.counts[state]); }
+	});
+
+	states.forEach(function(state) {
+		context.strokeStyle = colors[state] || "#000000";
+		context.beginPath();
+		populationHistory.forEach(function(point, i) {
+			var x = 2 + (canvas.width - 4) * point.generation / last;
+			var y = canvas.height - 2 - (canvas.height - 4) * point.counts[state] / highest;
+			if (i == 0) { context.moveTo(x, y); } else { context.lineTo(x, y); }
+		});
+		context.stroke();
+	});
+}
+
+var events = new EventSource("/events");
+events.onmessage = function(event) {
+	var message = JSON.parse(event.data);
+	colors = message.colors;
+
+	document.getElementById("frame").src = message.frame;
+	document.getElementById("generation").textContent = "Generation " + message.generation + " of " + message.numGens +
+		(message.paused ? " (paused)" : "");
+
+	if (edited == false) {
+		["Kcc", "Knn", "Knc"].forEach(function(id) { document.getElementById(id).value = message[id]; });
+	}
+
+	var rows = "";
+	states.forEach(function(state) {
+		rows += "<tr><td style='color:" + (colors[state] || "#000000") + "'>" + state + "</td><td>" + message.counts[state] + "</td></tr>";
+	});
+	document.getElementById("counts").innerHTML = rows;
+
+	if (populationHistory.length == 0 || populationHistory[populationHistory.length - 1].generation != message.generation) {
+		populationHistory.push({generation: message.generation, counts: message.counts});
+		drawChart();
+	}
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//TestHandlePage checks that the viewer page is served, and that its script declares none of the globals a browser
+//keeps read-only on window, which would leave the chart empty.
+func TestHandlePage(t *testing.T) {
+
+	server := &LiveServer{}
+
+	recorder := httptest.NewRecorder()
+	server.HandlePage(recorder, httptest.NewRequest("GET", "/", nil))
+
+	page := recorder.Body.String()
+	if recorder.Code != 200 || strings.Contains(page, "var populationHistory = [];") == false {
+		t.Fatalf("page of status %d without the population history", recorder.Code)
+	}
+
+	for _, name := range []string{"history", "location", "name", "status", "parent", "top", "self", "frames", "length", "closed"} {
+		if strings.Contains(page, "var "+name+" ") == true {
+			t.Errorf("page declares the browser global %s", name)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	server.HandlePage(recorder, httptest.NewRequest("GET", "/missing", nil))
+	if recorder.Code != 404 {
+		t.Errorf("status %d for a missing page", recorder.Code)
+	}
+}
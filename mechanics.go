@@ -0,0 +1,230 @@
+package main
+
+//MechanicsConfig holds the settings of the pushing mechanics.
+//When enabled, a dividing cell pushes a chain of cells toward the nearest free site instead of overwriting a living cell at its target,
+//and proliferation is suppressed where the crowding pressure exceeds a threshold.
+type MechanicsConfig struct {
+
+	//Enabled turns the mechanics on
+	Enabled bool `json:"enabled"`
+
+	//PressureRadius is the half-width of the square window over which crowding is measured
+	PressureRadius int `json:"pressureRadius"`
+
+	//PressureThreshold is the pressure (fraction of occupied sites in the window) above which proliferative cells turn quiescent
+	PressureThreshold float64 `json:"pressureThreshold"`
+
+	//MaxPushDistance is the longest chain of cells a dividing cell can push. Cells whose target is further from a free site do not divide.
+	MaxPushDistance int `json:"maxPushDistance"`
+}
+
+//DefaultMechanicsConfig returns disabled mechanics with a 5x5 crowding window.
+func DefaultMechanicsConfig() MechanicsConfig {
+
+	var mechanicsConfig MechanicsConfig
+
+	mechanicsConfig.Enabled = false
+	mechanicsConfig.PressureRadius = 2
+	mechanicsConfig.PressureThreshold = 0.9
+	mechanicsConfig.MaxPushDistance = 6
+
+	return mechanicsConfig
+}
+
+//IsOccupied2D returns true if a site holds a living cell that has to be pushed away to make room.
+//Healthy tissue, necrotic debris and the marks left by necrotic cells give way, as they do to daughters in PushAllCells2D.
+func IsOccupied2D(currCell Cell2D) bool {
+	return currCell.state != "h" && currCell.state != "N" && currCell.state != "wN"
+}
+
+//UpdatePressure2D sets the pressure of every site to the fraction of occupied sites in the square window of the given radius around it.
+func UpdatePressure2D(matrix Matrix2D, radius int) Matrix2D {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	for i := range matrix {
+		for j := range matrix[i] {
+
+			occupied := 0
+			total := 0
+
+			for a := i - radius; a <= i+radius; a++ {
+				for b := j - radius; b <= j+radius; b++ {
+					if (a != i || b != j) && a >= 0 && a < numRows && b >= 0 && b < numCols {
+						total++
+						if IsOccupied2D(matrix[a][b]) == true {
+							occupied++
+						}
+					}
+				}
+			}
+
+			matrix[i][j].pressure = 0.0
+			if total > 0 {
+				matrix[i][j].pressure = float64(occupied) / float64(total)
+			}
+		}
+	}
+
+	return matrix
+}
+
+//FindPushPath2D returns the path of least resistance from the site i,j to the nearest free site, excluding i,j and
+//ending at the free site. Every step costs one, plus the ECM resistance of the site entered if the ECM is enabled.
+//It returns nil if no free site is within maxDist steps.
+func FindPushPath2D(matrix Matrix2D, i, j int, maxDist int, config Config) []OrderedPair {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	start := OrderedPair{i, j}
+
+	cost := map[OrderedPair]float64{start: 0.0}
+	steps := map[OrderedPair]int{start: 0}
+	previous := make(map[OrderedPair]OrderedPair)
+	done := make(map[OrderedPair]bool)
+
+	//sites reached but not done yet, in the order they were reached
+	frontier := []OrderedPair{start}
+
+	for len(frontier) > 0 {
+
+		//taking the cheapest site of the frontier (the first one in case of a tie)
+		best := 0
+		for f := range frontier {
+			if cost[frontier[f]] < cost[frontier[best]] {
+				best = f
+			}
+		}
+		site := frontier[best]
+		frontier = append(frontier[:best], frontier[best+1:]...)
+		done[site] = true
+
+		if site != start && IsOccupied2D(matrix[site.x][site.y]) == false {
+
+			//walking back to the dividing cell
+			path := []OrderedPair{site}
+			for previous[site] != start {
+				site = previous[site]
+				path = append([]OrderedPair{site}, path...)
+			}
+			return path
+		}
+
+		if steps[site] == maxDist {
+			continue
+		}
+
+		//shuffled so that ties between equally cheap directions are broken at random
+		nextSites := []OrderedPair{{site.x - 1, site.y}, {site.x + 1, site.y}, {site.x, site.y - 1}, {site.x, site.y + 1}}
+		RNG.Shuffle(len(nextSites), func(a, b int) { nextSites[a], nextSites[b] = nextSites[b], nextSites[a] })
+
+		for _, next := range nextSites {
+
+			if InField2D(next.x, next.y, numRows, numCols) == false || done[next] == true {
+				continue
+			}
+
+			stepCost := 1.0
+			if config.ECM.Enabled == true {
+				stepCost += config.ECM.Resistance * matrix[next.x][next.y].ecm
+			}
+
+			oldCost, reached := cost[next]
+			if reached == false || cost[site]+stepCost < oldCost {
+				if reached == false {
+					frontier = append(frontier, next)
+				}
+				cost[next] = cost[site] + stepCost
+				steps[next] = steps[site] + 1
+				previous[next] = site
+			}
+		}
+	}
+
+	return nil
+}
+
+//PushDivisions2D divides the cancer cells that were proliferative in currMatrix without overwriting living cells in pushedMatrix.
+//The daughter goes to the target given by the mother's velocity; if a living cell is there, the cells along the path of least
+//resistance from the target to a free site each move one step outward to make room.
+//Dividing cells are taken in random order. A mother pushed by an earlier division keeps the offset of her target from her site,
+//and a mother whose target has no free site in reach does not divide.
+func PushDivisions2D(currMatrix, pushedMatrix Matrix2D, config Config) Matrix2D {
+
+	numCols := GetNumCols2D(pushedMatrix)
+
+	//each cell of pushedMatrix is labelled by its site, so that mothers can be found again after being pushed
+	labels := make([][]int, len(pushedMatrix))
+	positions := make([]OrderedPair, len(pushedMatrix)*numCols)
+
+	for i := range pushedMatrix {
+		labels[i] = make([]int, numCols)
+		for j := range pushedMatrix[i] {
+			labels[i][j] = i*numCols + j
+			positions[i*numCols+j] = OrderedPair{i, j}
+		}
+	}
+
+	mothers := make([]OrderedPair, 0)
+	for i := range currMatrix {
+		for j := range currMatrix[i] {
+			if currMatrix[i][j].state == "C" && pushedMatrix[i][j].state == "C" && DividesNow2D(currMatrix[i][j], config.Cycle) == true {
+				mothers = append(mothers, OrderedPair{i, j})
+			}
+		}
+	}
+
+	RNG.Shuffle(len(mothers), func(a, b int) { mothers[a], mothers[b] = mothers[b], mothers[a] })
+
+	for _, mother := range mothers {
+
+		label := mother.x*numCols + mother.y
+
+		//the velocity stays with the site, so the target is found from the mother's site in currMatrix
+		site := positions[label]
+		velocity := currMatrix[mother.x][mother.y].velocityDirection
+		target := OrderedPair{site.x + velocity.x - mother.x, site.y + velocity.y - mother.y}
+
+		if IsOccupied2D(pushedMatrix[target.x][target.y]) == true {
+
+			path := FindPushPath2D(pushedMatrix, target.x, target.y, config.Mechanics.MaxPushDistance, config)
+			if path == nil {
+				continue
+			}
+			chain := append([]OrderedPair{target}, path...)
+
+			//moving the chain outward, starting from the free site
+			for p := len(chain) - 1; p > 0; p-- {
+				from := chain[p-1]
+				to := chain[p]
+
+				MoveCell2D(&pushedMatrix[to.x][to.y], pushedMatrix[from.x][from.y])
+
+				labels[to.x][to.y] = labels[from.x][from.y]
+				if labels[to.x][to.y] >= 0 {
+					positions[labels[to.x][to.y]] = to
+				}
+			}
+		}
+
+		//the daughter gets a label that no mother uses
+		labels[target.x][target.y] = -1
+
+		site = positions[label]
+		DivideCell2D(pushedMatrix, site.x, site.y, target.x, target.y, config.Cycle)
+	}
+
+	return pushedMatrix
+}
+
+//ApplyContactInhibition2D turns a proliferative cell quiescent if the pressure at its site is above the threshold.
+func ApplyContactInhibition2D(prevCell, newCell Cell2D, mechanicsConfig MechanicsConfig) Cell2D {
+
+	if newCell.state == "C" && prevCell.pressure > mechanicsConfig.PressureThreshold {
+		newCell.state = "Q"
+	}
+
+	return newCell
+}
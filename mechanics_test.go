@@ -0,0 +1,180 @@
+package main
+
+import (
+	"testing"
+)
+
+//GetTestBlock2D returns an n by n matrix of healthy tissue with a square of cancer cells from low to high on both axes.
+//Every cell has a clone of its own and a velocity toward the site on its right.
+func GetTestBlock2D(n, low, high int) Matrix2D {
+
+	matrix := Initialize2DMatrix(n, n)
+
+	clone := 1
+	for i := low; i <= high; i++ {
+		for j := low; j <= high; j++ {
+			matrix[i][j].state = "C"
+			matrix[i][j].clone = clone
+			matrix[i][j].velocityDirection = OrderedPair{i, j + 1}
+			clone++
+		}
+	}
+
+	return matrix
+}
+
+//TestUpdatePressure2D checks the pressure of sites inside, on the edge of and away from a block of cells.
+func TestUpdatePressure2D(t *testing.T) {
+
+	matrix := GetTestBlock2D(5, 1, 3)
+	matrix = UpdatePressure2D(matrix, 1)
+
+	tests := []struct {
+		i, j     int
+		pressure float64
+	}{
+		{2, 2, 1}, {1, 1, 3.0 / 8}, {0, 0, 1.0 / 3}, {0, 2, 3.0 / 5}, {4, 4, 1.0 / 3},
+	}
+	for _, test := range tests {
+		if matrix[test.i][test.j].pressure != test.pressure {
+			t.Errorf("pressure %g at %d %d, expected %g", matrix[test.i][test.j].pressure, test.i, test.j, test.pressure)
+		}
+	}
+
+	//necrotic debris gives way, so it does not crowd
+	matrix[1][1].state = "N"
+	matrix = UpdatePressure2D(matrix, 1)
+	if matrix[2][2].pressure != 7.0/8 {
+		t.Errorf("pressure %g next to debris, expected 7/8", matrix[2][2].pressure)
+	}
+}
+
+//TestFindPushPath2D checks that the path from the middle of a block runs out of it by the fewest steps.
+//The block is kept clear of the border of the lattice, which InField2D leaves out.
+func TestFindPushPath2D(t *testing.T) {
+
+	SeedRandom(3)
+	config := ReadConfig("")
+
+	matrix := GetTestBlock2D(17, 6, 10)
+
+	path := FindPushPath2D(matrix, 8, 8, 6, config)
+	if len(path) != 3 {
+		t.Fatalf("path %v, expected 3 steps", path)
+	}
+
+	previous := OrderedPair{8, 8}
+	for p, site := range path {
+		distance := site.x - previous.x + site.y - previous.y
+		if (distance != 1 && distance != -1) || (site.x != previous.x && site.y != previous.y) {
+			t.Fatalf("path %v does not go from site to site", path)
+		}
+		if IsOccupied2D(matrix[site.x][site.y]) == (p == len(path)-1) {
+			t.Fatalf("path %v does not end at its first free site", path)
+		}
+		previous = site
+	}
+
+	if path := FindPushPath2D(matrix, 8, 8, 2, config); path != nil {
+		t.Fatalf("path %v longer than the 2 steps allowed", path)
+	}
+}
+
+//TestPushDivisions2D checks that every cell of a block divides without any cell being overwritten.
+func TestPushDivisions2D(t *testing.T) {
+
+	SeedRandom(3)
+	config := ReadConfig("")
+	config.Mechanics.Enabled = true
+
+	currMatrix := GetTestBlock2D(19, 8, 10)
+	pushedMatrix := GetTestBlock2D(19, 8, 10)
+
+	pushedMatrix = PushDivisions2D(currMatrix, pushedMatrix, config)
+
+	clones := make(map[int]int)
+	for i := range pushedMatrix {
+		for j := range pushedMatrix[i] {
+			if pushedMatrix[i][j].state == "C" {
+				clones[pushedMatrix[i][j].clone]++
+			} else if pushedMatrix[i][j].state != "h" {
+				t.Fatalf("site %d %d of state %s", i, j, pushedMatrix[i][j].state)
+			}
+		}
+	}
+
+	if len(clones) != 9 {
+		t.Fatalf("%d clones after the divisions, expected 9", len(clones))
+	}
+	for clone, count := range clones {
+		if count != 2 {
+			t.Errorf("%d cells of clone %d, expected a mother and a daughter", count, clone)
+		}
+	}
+}
+
+//TestPushDivisionsMovedMother2D checks that a mother pushed aside by an earlier division puts her daughter at the offset
+//of her target from her new site. The mother at 9,8 divides into the site of the one at 9,9, which divides to her right.
+func TestPushDivisionsMovedMother2D(t *testing.T) {
+
+	config := ReadConfig("")
+	config.Mechanics.Enabled = true
+
+	currMatrix := GetTestBlock2D(19, 9, 9)
+	currMatrix[9][8] = currMatrix[9][9]
+	currMatrix[9][8].clone = 2
+	currMatrix[9][8].location = OrderedPair{9, 8}
+	currMatrix[9][8].velocityDirection = OrderedPair{9, 9}
+
+	//mothers are told from their daughters by their age
+	currMatrix[9][8].age = 5
+	currMatrix[9][9].age = 5
+
+	pushed := 0
+
+	for seed := int64(1); seed <= 20; seed++ {
+
+		//the mothers are shuffled in the order they are found; only the seeds where the one at 9,8 divides first are kept
+		SeedRandom(seed)
+		order := []int{0, 1}
+		RNG.Shuffle(len(order), func(a, b int) { order[a], order[b] = order[b], order[a] })
+		if order[0] != 0 {
+			continue
+		}
+		SeedRandom(seed)
+
+		pushedMatrix := make(Matrix2D, len(currMatrix))
+		for i := range currMatrix {
+			pushedMatrix[i] = append([]Cell2D(nil), currMatrix[i]...)
+		}
+
+		pushedMatrix = PushDivisions2D(currMatrix, pushedMatrix, config)
+
+		var mother, daughter OrderedPair
+		count := 0
+		for i := range pushedMatrix {
+			for j := range pushedMatrix[i] {
+				if pushedMatrix[i][j].clone == 1 {
+					count++
+					if pushedMatrix[i][j].age == 5 {
+						mother = OrderedPair{i, j}
+					} else {
+						daughter = OrderedPair{i, j}
+					}
+				}
+			}
+		}
+
+		if count != 2 || mother == (OrderedPair{9, 9}) {
+			t.Fatalf("seed %d: %d cells of the pushed clone, its mother at %v", seed, count, mother)
+		}
+		if daughter != (OrderedPair{mother.x, mother.y + 1}) {
+			t.Fatalf("seed %d: daughter at %v, expected on the right of her mother at %v", seed, daughter, mother)
+		}
+		pushed++
+	}
+
+	if pushed == 0 {
+		t.Fatal("the mother at 9,8 never divides first")
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//MeshConfig holds the settings of the surface meshes of 3D runs. The surface around the sites of each of Surfaces is
+//extracted with marching cubes, smoothed, and written to the folder "mesh3D" as <surface>_<generation>.<format>, with the
+//surface area and enclosed volume of every mesh in surfaces.csv. Lengths are in units of Spacing per site.
+type MeshConfig struct {
+
+	//Enabled turns the meshes on
+	Enabled bool `json:"enabled"`
+
+	//Generations meshed; -1 is the last
+	Generations []int `json:"generations"`
+
+	//Surfaces around groups of states
+	Surfaces []SurfaceConfig `json:"surfaces"`
+
+	//Formats written: "obj", "stl" (binary) and "ply" (binary)
+	Formats []string `json:"formats"`
+
+	//Smoothing is the number of rounds of Taubin smoothing, which rounds off the steps of the lattice without shrinking the mesh
+	Smoothing int `json:"smoothing"`
+
+	//Spacing is the size of a site, 1 for lattice units
+	Spacing float64 `json:"spacing"`
+}
+
+//SurfaceConfig is a surface around the sites of some states, named in the file names.
+type SurfaceConfig struct {
+	Name   string   `json:"name"`
+	States []string `json:"states"`
+}
+
+//Mesh is a triangle mesh, the corners of each triangle counterclockwise seen from outside.
+type Mesh struct {
+	vertices  []Vector3
+	triangles [][3]int
+}
+
+//CubeLoop is a polygon of the surface in a cube of marching cubes: a loop of the edges it crosses, an edge being a pair of
+//corners, and its triangles as indices into the loop.
+type CubeLoop struct {
+	edges     [][2]int
+	triangles [][3]int
+}
+
+//CubeFaces are the corners of each face of a cube of marching cubes, counterclockwise seen from outside the cube.
+//Corner c is at (c&1, c>>1&1, c>>2&1).
+var CubeFaces = [6][4]int{{0, 4, 6, 2}, {1, 3, 7, 5}, {0, 1, 5, 4}, {2, 6, 7, 3}, {0, 2, 3, 1}, {4, 5, 7, 6}}
+
+//MarchingCubesTable holds, for each of the 256 sets of corners of a cube inside the surface, the polygons of the surface in the cube.
+var MarchingCubesTable = GetMarchingCubesTable()
+
+//DefaultMeshConfig returns disabled meshes of the whole tumour and of the necrotic core at the last generation, as OBJ files.
+func DefaultMeshConfig() MeshConfig {
+
+	var meshConfig MeshConfig
+
+	meshConfig.Enabled = false
+	meshConfig.Generations = []int{-1}
+	meshConfig.Surfaces = []SurfaceConfig{
+		{Name: "tumour", States: []string{"C", "Q", "N", "wN"}},
+		{Name: "necrotic core", States: []string{"N", "wN"}},
+	}
+	meshConfig.Formats = []string{"obj"}
+	meshConfig.Smoothing = 10
+	meshConfig.Spacing = 1
+
+	return meshConfig
+}
+
+//GetMarchingCubesTable builds the table of marching cubes from the faces of the cube. On every face the surface crosses the
+//edges between an inside and an outside corner; crossings are joined into segments around the inside corners (which keeps
+//diagonal inside corners apart, so neighbouring cubes always agree), and the segments of the six faces close into loops.
+func GetMarchingCubesTable() [256][]CubeLoop {
+
+	var table [256][]CubeLoop
+
+	for inside := 0; inside < 256; inside++ {
+
+		//next maps each crossed edge to the following one along the surface
+		next := make(map[[2]int][2]int)
+
+		for _, face := range CubeFaces {
+
+			//crossings of the face in counterclockwise order, entering or leaving the inside corners
+			var edges [][2]int
+			var entering []bool
+
+			for t := 0; t < 4; t++ {
+				a, b := face[t], face[(t+1)%4]
+				inA, inB := inside>>uint(a)&1 == 1, inside>>uint(b)&1 == 1
+				if inA != inB {
+					edges = append(edges, GetCubeEdge(a, b))
+					entering = append(entering, inB)
+				}
+			}
+
+			//each entering crossing is joined to the leaving crossing after it
+			for c := range edges {
+				if entering[c] == true {
+					next[edges[c]] = edges[(c+1)%len(edges)]
+				}
+			}
+		}
+
+		//following the segments into loops
+		loops := make([][][2]int, 0)
+		visited := make(map[[2]int]bool)
+		for edge := range next {
+			if visited[edge] == true {
+				continue
+			}
+
+			loop := make([][2]int, 0)
+			for e := edge; visited[e] == false; e = next[e] {
+				visited[e] = true
+				loop = append(loop, e)
+			}
+
+			loops = append(loops, loop)
+		}
+
+		//loops in a fixed order, so that meshes do not depend on the order of the map
+		SortEdgeLoops(loops)
+
+		for _, loop := range loops {
+			table[inside] = append(table[inside], CubeLoop{edges: loop, triangles: TriangulateEdgeLoop(loop)})
+		}
+	}
+
+	return table
+}
+
+//GetCubeEdge returns the edge between two corners of a cube, lower corner first.
+func GetCubeEdge(a, b int) [2]int {
+
+	if a > b {
+		a, b = b, a
+	}
+
+	return [2]int{a, b}
+}
+
+//TriangulateEdgeLoop returns the triangles of a loop of edges of a cube: a fan from the first corner of the loop whose
+//diagonals all cross the inside of the cube. A diagonal along a face of the cube could be drawn by the neighbouring cube as
+//well, leaving an edge of the mesh with four triangles. Every loop of the 256 cubes has such a corner.
+func TriangulateEdgeLoop(loop [][2]int) [][3]int {
+
+	triangles := make([][3]int, 0)
+
+	for origin := range loop {
+		inside := true
+		for d := 2; d < len(loop)-1; d++ {
+			if IsOnCubeFace(loop[origin], loop[(origin+d)%len(loop)]) == true {
+				inside = false
+			}
+		}
+
+		if inside == true {
+			for t := 1; t+1 < len(loop); t++ {
+				triangles = append(triangles, [3]int{origin, (origin + t) % len(loop), (origin + t + 1) % len(loop)})
+			}
+			return triangles
+		}
+	}
+
+	panic("Marching cubes loop without a corner to fan its triangles from")
+}
+
+//IsOnCubeFace returns true if two edges of a cube lie on one face.
+func IsOnCubeFace(a, b [2]int) bool {
+
+	for _, face := range CubeFaces {
+		count := 0
+		for _, corner := range face {
+			if corner == a[0] || corner == a[1] || corner == b[0] || corner == b[1] {
+				count++
+			}
+		}
+		if count == 4 {
+			return true
+		}
+	}
+
+	return false
+}
+
+//SortEdgeLoops sorts loops by their first edge, each loop starting from its smallest edge.
+func SortEdgeLoops(loops [][][2]int) {
+
+	less := func(a, b [2]int) bool {
+		return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+	}
+
+	for _, loop := range loops {
+		smallest := 0
+		for e := range loop {
+			if less(loop[e], loop[smallest]) == true {
+				smallest = e
+			}
+		}
+		rotated := append(append([][2]int{}, loop[smallest:]...), loop[:smallest]...)
+		copy(loop, rotated)
+	}
+
+	for i := 1; i < len(loops); i++ {
+		for j := i; j > 0 && less(loops[j][0], loops[j-1][0]) == true; j-- {
+			loops[j], loops[j-1] = loops[j-1], loops[j]
+		}
+	}
+}
+
+//IsInSurface returns true if the site (i, j, k) is in the lattice and of one of states.
+func IsInSurface(matrix Matrix, i, j, k int, states map[string]bool) bool {
+
+	if i < 0 || j < 0 || k < 0 || i >= GetNumRows(matrix) || j >= GetNumCols(matrix) || k >= GetNumAisles(matrix) {
+		return false
+	}
+
+	return states[matrix[i][j][k].state]
+}
+
+//GetSurfaceMesh returns the surface around the sites of states by marching cubes over the centres of the sites.
+//The lattice is surrounded by a layer of outside sites, so that the surface is always closed. Vertices lie halfway
+//between an inside and an outside site, on the faces of the sites, in units of spacing, with site (i, j, k) filling
+//the cube from (i, j, k) to (i+1, j+1, k+1) as in the VTK export.
+func GetSurfaceMesh(matrix Matrix, states []string, spacing float64) Mesh {
+
+	var mesh Mesh
+
+	inStates := make(map[string]bool)
+	for _, state := range states {
+		inStates[state] = true
+	}
+
+	//vertices are shared between cubes: an edge of the lattice is its lower site and its axis
+	vertexIndices := make(map[[4]int]int)
+
+	for x := -1; x < GetNumRows(matrix); x++ {
+		for y := -1; y < GetNumCols(matrix); y++ {
+			for z := -1; z < GetNumAisles(matrix); z++ {
+
+				inside := 0
+				for c := 0; c < 8; c++ {
+					if IsInSurface(matrix, x+c&1, y+c>>1&1, z+c>>2&1, inStates) == true {
+						inside |= 1 << uint(c)
+					}
+				}
+
+				for _, loop := range MarchingCubesTable[inside] {
+					polygon := make([]int, len(loop.edges))
+
+					for e, edge := range loop.edges {
+						a, b := edge[0], edge[1]
+						key := [4]int{x + a&1, y + a>>1&1, z + a>>2&1, b - a}
+
+						index, ok := vertexIndices[key]
+						if ok == false {
+							index = len(mesh.vertices)
+							vertexIndices[key] = index
+
+							midpoint := Vector3{float64(x) + float64(a&1+b&1)/2, float64(y) + float64(a>>1&1+b>>1&1)/2, float64(z) + float64(a>>2&1+b>>2&1)/2}
+							mesh.vertices = append(mesh.vertices, ScaleVector(AddVectors(midpoint, Vector3{0.5, 0.5, 0.5}), spacing))
+						}
+						polygon[e] = index
+					}
+
+					for _, triangle := range loop.triangles {
+						mesh.triangles = append(mesh.triangles, [3]int{polygon[triangle[0]], polygon[triangle[1]], polygon[triangle[2]]})
+					}
+				}
+			}
+		}
+	}
+
+	return mesh
+}
+
+//SmoothMesh moves every vertex toward the average of its neighbours and back out again, rounds times (Taubin smoothing),
+//so that the steps of the lattice are rounded off without the mesh shrinking.
+func SmoothMesh(mesh Mesh, rounds int) Mesh {
+
+	neighbors := make([][]int, len(mesh.vertices))
+	linked := make(map[[2]int]bool)
+
+	for _, triangle := range mesh.triangles {
+		for t := 0; t < 3; t++ {
+			a, b := triangle[t], triangle[(t+1)%3]
+			if a > b {
+				a, b = b, a
+			}
+			if linked[[2]int{a, b}] == false {
+				linked[[2]int{a, b}] = true
+				neighbors[a] = append(neighbors[a], b)
+				neighbors[b] = append(neighbors[b], a)
+			}
+		}
+	}
+
+	vertices := append([]Vector3{}, mesh.vertices...)
+
+	for r := 0; r < rounds; r++ {
+		for _, factor := range []float64{0.5, -0.53} {
+			moved := make([]Vector3, len(vertices))
+
+			for v := range vertices {
+				if len(neighbors[v]) == 0 {
+					moved[v] = vertices[v]
+					continue
+				}
+
+				var average Vector3
+				for _, n := range neighbors[v] {
+					average = AddVectors(average, vertices[n])
+				}
+				average = ScaleVector(average, 1.0/float64(len(neighbors[v])))
+
+				moved[v] = AddVectors(vertices[v], ScaleVector(SubtractVectors(average, vertices[v]), factor))
+			}
+
+			vertices = moved
+		}
+	}
+
+	return Mesh{vertices: vertices, triangles: mesh.triangles}
+}
+
+//GetMeshArea returns the surface area of a mesh.
+func GetMeshArea(mesh Mesh) float64 {
+
+	area := 0.0
+
+	for _, triangle := range mesh.triangles {
+		normal := GetTriangleNormal(mesh, triangle)
+		area += math.Sqrt(DotProduct(normal, normal)) / 2
+	}
+
+	return area
+}
+
+//GetMeshVolume returns the volume enclosed by a closed mesh, from the signed volumes of the tetrahedra between its
+//triangles and the origin.
+func GetMeshVolume(mesh Mesh) float64 {
+
+	volume := 0.0
+
+	for _, triangle := range mesh.triangles {
+		a, b, c := mesh.vertices[triangle[0]], mesh.vertices[triangle[1]], mesh.vertices[triangle[2]]
+		volume += DotProduct(a, CrossProduct(b, c)) / 6
+	}
+
+	return volume
+}
+
+//GetTriangleNormal returns the normal of a triangle of a mesh, pointing outside, with a length of twice its area.
+func GetTriangleNormal(mesh Mesh, triangle [3]int) Vector3 {
+
+	a, b, c := mesh.vertices[triangle[0]], mesh.vertices[triangle[1]], mesh.vertices[triangle[2]]
+
+	return CrossProduct(SubtractVectors(b, a), SubtractVectors(c, a))
+}
+
+//WriteOBJ writes a mesh as a Wavefront OBJ file, with a comment line at the top.
+func WriteOBJ(mesh Mesh, filename, comment string) error {
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintln(writer, "# "+comment)
+
+	for _, v := range mesh.vertices {
+		fmt.Fprintf(writer, "v %g %g %g\n", v.x, v.y, v.z)
+	}
+
+	//OBJ counts vertices from 1
+	for _, triangle := range mesh.triangles {
+		fmt.Fprintf(writer, "f %d %d %d\n", triangle[0]+1, triangle[1]+1, triangle[2]+1)
+	}
+
+	return CloseOutputFile(file, writer)
+}
+
+//WriteSTL writes a mesh as a binary STL file, with comment in the header.
+func WriteSTL(mesh Mesh, filename, comment string) error {
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	//the header must not start with "solid", which marks ASCII STL files
+	header := make([]byte, 80)
+	copy(header, "binary STL: "+comment)
+	writer.Write(header)
+
+	binary.Write(writer, binary.LittleEndian, uint32(len(mesh.triangles)))
+
+	for _, triangle := range mesh.triangles {
+		normal := GetTriangleNormal(mesh, triangle)
+		if DotProduct(normal, normal) > 0 {
+			normal = NormalizeVector(normal)
+		}
+
+		values := []float32{float32(normal.x), float32(normal.y), float32(normal.z)}
+		for _, v := range triangle {
+			values = append(values, float32(mesh.vertices[v].x), float32(mesh.vertices[v].y), float32(mesh.vertices[v].z))
+		}
+
+		binary.Write(writer, binary.LittleEndian, values)
+		binary.Write(writer, binary.LittleEndian, uint16(0))
+	}
+
+	return CloseOutputFile(file, writer)
+}
+
+//WritePLY writes a mesh as a binary little-endian PLY file, with a comment in the header.
+func WritePLY(mesh Mesh, filename, comment string) error {
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintln(writer, "ply")
+	fmt.Fprintln(writer, "format binary_little_endian 1.0")
+	fmt.Fprintln(writer, "comment "+comment)
+	fmt.Fprintln(writer, "element vertex "+strconv.Itoa(len(mesh.vertices)))
+	fmt.Fprintln(writer, "property float x")
+	fmt.Fprintln(writer, "property float y")
+	fmt.Fprintln(writer, "property float z")
+	fmt.Fprintln(writer, "element face "+strconv.Itoa(len(mesh.triangles)))
+	fmt.Fprintln(writer, "property list uchar int vertex_indices")
+	fmt.Fprintln(writer, "end_header")
+
+	for _, v := range mesh.vertices {
+		binary.Write(writer, binary.LittleEndian, []float32{float32(v.x), float32(v.y), float32(v.z)})
+	}
+
+	for _, triangle := range mesh.triangles {
+		writer.WriteByte(3)
+		binary.Write(writer, binary.LittleEndian, []int32{int32(triangle[0]), int32(triangle[1]), int32(triangle[2])})
+	}
+
+	return CloseOutputFile(file, writer)
+}
+
+//CountSurfaceSites returns the number of sites of states in a matrix.
+func CountSurfaceSites(matrix Matrix, states []string) int {
+
+	count := 0
+	for _, n := range CountStates3D(matrix, states) {
+		count += n
+	}
+
+	return count
+}
+
+//OutputMesh3D writes the meshes of the surfaces of meshConfig at its generations of a 3D run to the folder "mesh3D",
+//and their sizes to mesh3D/surfaces.csv. firstGeneration is the generation of timepoints[0], above 0 for resumed runs.
+func OutputMesh3D(timepoints []Matrix, firstGeneration int, meshConfig MeshConfig) error {
+
+	for _, format := range meshConfig.Formats {
+		if format != "obj" && format != "stl" && format != "ply" {
+			panic("Mesh formats have to be obj, stl or ply")
+		}
+	}
+	if meshConfig.Spacing <= 0 {
+		panic("Mesh spacing has to be above 0")
+	}
+
+	outputFolder := GetNewFolderDir("mesh3D")
+	err := MakeDirIfNotExist(outputFolder)
+	if err != nil {
+		return err
+	}
+	for _, format := range append([]string{"csv"}, meshConfig.Formats...) {
+		RefreshDirectoryOf(outputFolder, "."+format)
+	}
+
+	file, err := CreateOutputFile(outputFolder + "/surfaces.csv")
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintln(writer, "generation,surface,sites,vertices,triangles,area,volume")
+
+	for _, m := range meshConfig.Generations {
+		if m == -1 {
+			m = len(timepoints) - 1
+		}
+		if m < 0 || m >= len(timepoints) {
+			fmt.Println("Skipping meshes of generation " + strconv.Itoa(m) + ", which was not run")
+			continue
+		}
+
+		g := firstGeneration + m
+
+		for _, surface := range meshConfig.Surfaces {
+			sites := CountSurfaceSites(timepoints[m], surface.States)
+			if sites == 0 {
+				fmt.Println("Skipping the " + surface.Name + " mesh of generation " + strconv.Itoa(g) + ", which has no sites")
+				continue
+			}
+
+			fmt.Println("Meshing the " + surface.Name + " of generation " + strconv.Itoa(g))
+
+			mesh := SmoothMesh(GetSurfaceMesh(timepoints[m], surface.States, meshConfig.Spacing), meshConfig.Smoothing)
+			area := GetMeshArea(mesh)
+			volume := GetMeshVolume(mesh)
+
+			fmt.Fprintf(writer, "%d,%s,%d,%d,%d,%g,%g\n", g, surface.Name, sites, len(mesh.vertices), len(mesh.triangles), area, volume)
+
+			comment := fmt.Sprintf("%s of generation %d, area %g, volume %g", surface.Name, g, area, volume)
+			filename := outputFolder + "/" + strings.Replace(surface.Name, " ", "_", -1) + "_" + strconv.Itoa(g)
+
+			for _, format := range meshConfig.Formats {
+				if format == "obj" {
+					err = WriteOBJ(mesh, filename+".obj", comment)
+				} else if format == "stl" {
+					err = WriteSTL(mesh, filename+".stl", comment)
+				} else {
+					err = WritePLY(mesh, filename+".ply", comment)
+				}
+				if err != nil {
+					file.Close()
+					return err
+				}
+			}
+		}
+	}
+
+	return CloseOutputFile(file, writer)
+}
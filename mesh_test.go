@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+//GetTestMatrix3D returns an n by n by n lattice of healthy tissue with the sites in cells made cancerous.
+func GetTestMatrix3D(n int, cells []OrderedTrio) Matrix {
+
+	matrix := Initialize3DMatrix(n, n, n)
+	for _, cell := range cells {
+		matrix[cell.x][cell.y][cell.z].state = "C"
+	}
+
+	return matrix
+}
+
+//CheckClosedMesh fails t unless every edge of the mesh is shared by two triangles, running one way in one and the other
+//way in the other, as in a closed surface whose triangles all face outside.
+func CheckClosedMesh(t *testing.T, mesh Mesh) {
+
+	edges := make(map[[2]int]int)
+	for _, triangle := range mesh.triangles {
+		for v := 0; v < 3; v++ {
+			edges[[2]int{triangle[v], triangle[(v+1)%3]}]++
+		}
+	}
+
+	for edge, count := range edges {
+		if count != 1 || edges[[2]int{edge[1], edge[0]}] != 1 {
+			t.Fatalf("edge %v is in %d triangles one way and %d the other", edge, count, edges[[2]int{edge[1], edge[0]}])
+		}
+	}
+}
+
+//TestSurfaceMeshSingleSite checks the surface of a single site: the octahedron between the centres of its faces.
+func TestSurfaceMeshSingleSite(t *testing.T) {
+
+	matrix := GetTestMatrix3D(3, []OrderedTrio{{1, 1, 1}})
+
+	mesh := GetSurfaceMesh(matrix, []string{"C"}, 1)
+
+	if len(mesh.vertices) != 6 || len(mesh.triangles) != 8 {
+		t.Fatalf("%d vertices and %d triangles, expected 6 and 8", len(mesh.vertices), len(mesh.triangles))
+	}
+	CheckClosedMesh(t, mesh)
+
+	//the site fills the cube from (1, 1, 1) to (2, 2, 2)
+	centre := Vector3{1.5, 1.5, 1.5}
+	for _, vertex := range mesh.vertices {
+		offset := SubtractVectors(vertex, centre)
+		if math.Abs(math.Sqrt(DotProduct(offset, offset))-0.5) > 1e-12 {
+			t.Fatalf("vertex %v is not on a face of the site", vertex)
+		}
+	}
+
+	volume := GetMeshVolume(mesh)
+	if math.Abs(volume-1.0/6) > 1e-12 {
+		t.Fatalf("volume %g, expected 1/6", volume)
+	}
+
+	area := GetMeshArea(mesh)
+	if math.Abs(area-math.Sqrt(3)) > 1e-12 {
+		t.Fatalf("area %g, expected the square root of 3", area)
+	}
+
+	//spacing scales the lengths
+	mesh = GetSurfaceMesh(matrix, []string{"C"}, 2)
+	volume = GetMeshVolume(mesh)
+	if math.Abs(volume-8.0/6) > 1e-12 {
+		t.Fatalf("volume %g with a spacing of 2, expected 8/6", volume)
+	}
+}
+
+//TestSurfaceMeshEdges checks that the surface of sites on the edge of the lattice is closed too, and that sites of other
+//states are left out.
+func TestSurfaceMeshEdges(t *testing.T) {
+
+	matrix := GetTestMatrix3D(4, []OrderedTrio{{0, 0, 0}, {3, 3, 3}})
+
+	mesh := GetSurfaceMesh(matrix, []string{"C"}, 1)
+	CheckClosedMesh(t, mesh)
+
+	volume := GetMeshVolume(mesh)
+	if math.Abs(volume-2.0/6) > 1e-12 {
+		t.Fatalf("volume %g of two sites, expected 2/6", volume)
+	}
+
+	mesh = GetSurfaceMesh(matrix, []string{"N", "wN"}, 1)
+	if len(mesh.triangles) != 0 {
+		t.Fatalf("%d triangles around no sites", len(mesh.triangles))
+	}
+}
+
+//TestSurfaceMeshRandom checks that the surface of a random lattice is closed, and that its volume grows with the sites.
+func TestSurfaceMeshRandom(t *testing.T) {
+
+	SeedRandom(11)
+
+	matrix := Initialize3DMatrix(8, 8, 8)
+	for i := range matrix {
+		for j := range matrix[i] {
+			for k := range matrix[i][j] {
+				if RNG.Float64() < 0.4 {
+					matrix[i][j][k].state = "C"
+				}
+			}
+		}
+	}
+
+	mesh := GetSurfaceMesh(matrix, []string{"C"}, 1)
+	CheckClosedMesh(t, mesh)
+
+	sites := CountSurfaceSites(matrix, []string{"C"})
+	volume := GetMeshVolume(mesh)
+	if volume < float64(sites)/6 || volume > float64(sites) {
+		t.Fatalf("volume %g around %d sites", volume, sites)
+	}
+}
@@ -3,51 +3,93 @@ package main
 import (
 	"fmt"
 	"image"
-	"math/rand"
+	"sort"
 	"strconv"
 )
 
 //These codes are written by Noah Chang
 
-//Metastasis2D takes in a current Matrix, current metasized cell count, and the ruptured vessel seed type to return the cumulative number of cells metastasized.
-func Metastasis2D(currMatrix Matrix2D, metaBoard [][]bool, metaCount [3]int) [3]int {
+//MetastasisEvent records one attempt of cancer cells to intravasate through a ruptured vessel.
+type MetastasisEvent struct {
+	generation int
+	x, y, z    int
+	clone      int
+
+	//size of the connected cancer cluster touching the vessel, and the number of cells shed from it
+	connectedSize int
+	clusterSize   int
+
+	//whether the cells survived the circulation, and the organ they extravasated into if they did
+	survived bool
+	organ    string
+
+	//fate of the cells: "died", "circulating", "extravasated", "dormant" or "reawakened",
+	//with the generations they extravasated and reawakened at (0 if they did not)
+	fate       string
+	arrival    int
+	reawakened int
+}
 
-	numRows := GetNumRows2D(currMatrix)
-	numCols := GetNumCols2D(currMatrix)
+//MetastasisResults holds what a metastasis run produces besides the primary matrices.
+type MetastasisResults struct {
+
+	//cumulative number of cells metastasized to each organ per generation, in the order of GetOrganNames
+	metaSlice [][]int
+
+	//every intravasation event, in the order they happened
+	events []MetastasisEvent
+
+	//secondary sites and CTC time series, if enabled
+	sites     []SecondarySite
+	ctcCounts []CirculationCounts
+}
+
+//Metastasis2D takes in a current Matrix, current metasized cell count per organ (in the order of organNames), and the ruptured vessel board
+//to return the cumulative number of cells metastasized to each organ, and the intravasation events of this generation.
+//At each ruptured vessel touched by a cancer cell, the cells nearest the vessel in its connected cluster are shed together.
+//If the circulation compartment is enabled, survival and extravasation are left to UpdateCirculation.
+func Metastasis2D(currMatrix Matrix2D, metaBoard [][]bool, metaCount []int, metaConfig MetastasisConfig, organNames []string) ([]int, []MetastasisEvent) {
+
+	//copying, so that the counts of the previous generation are kept
+	metaCount = append([]int(nil), metaCount...)
+
+	events := make([]MetastasisEvent, 0)
 
 	for i := range currMatrix {
-		for j := range currMatrix {
+		for j := range currMatrix[i] {
 			//If the cell is cancerous
 			if currMatrix[i][j].state == "C" {
 				//And there is a ruptured vessel at the same coordinate
 				if IsVascular(metaBoard, currMatrix, i, j) == true {
 
-					nhd := GetCurrentNeighborhood2D(currMatrix, i, j, numRows, numCols)
+					var event MetastasisEvent
+					event.x = i
+					event.y = j
+					event.clone = currMatrix[i][j].clone
 
-					//case for a single cancer cell
-					if GetNumCancerous2D(nhd) == 0 {
-						//Does it survive inside the blood vessel?
-						if SurvivalCheck("single") == true {
-							//If it does, it extravastates into one of three destinations
-							metaCount = Extravastate(metaCount)
-						}
-					}
+					//measuring the cluster touching the vessel
+					event.connectedSize = len(GetConnectedCluster2D(currMatrix, i, j))
+					event.clusterSize = GetShedClusterSize(event.connectedSize, metaConfig.Intravasation)
 
-					//case for a cluster of cancer cells
-					if GetNumCancerous2D(nhd) > 0 {
+					if metaConfig.Circulation.Enabled == false {
 						//Does it survive inside the blood vessel?
-						if SurvivalCheck("cluster") == true {
-							//If it does, it extravastates into one of three destinations
-							metaCount = Extravastate(metaCount)
+						event.survived = SurvivalCheckSize(event.clusterSize, metaConfig.Intravasation)
+						event.fate = "died"
+
+						//If it does, it extravastates into one of the destinations of its clone
+						if event.survived == true {
+							metaCount, event.organ = Extravastate(metaCount, GetOrganTropism(metaConfig, event.clone), organNames)
+							event.fate = "extravasated"
 						}
 					}
 
+					events = append(events, event)
 				}
 			}
 		}
 	}
 
-	return metaCount
+	return metaCount, events
 }
 
 //GenerateMetastasisBoard2D generates the coordinates of the ruptured vessels
@@ -75,7 +117,7 @@ func SeedMetastasisBoard2D(metaBoard [][]bool, seedType string) [][]bool {
 
 	length := len(metaBoard)
 	if seedType == "random" {
-		metaBoard[rand.Intn(length)][rand.Intn(length)] = true
+		metaBoard[RNG.Intn(length)][RNG.Intn(length)] = true
 	} else if seedType == "set" {
 		metaBoard[length/4][length/2] = true
 		metaBoard[length/2][length/4] = true
@@ -100,94 +142,248 @@ func IsVascular(metaBoard [][]bool, currMatrix Matrix2D, i, j int) bool {
 	return vascular
 }
 
-//SurvivalCheck calculates the probability of survival of either single cell or cluster of cells according to probability from a literature
-func SurvivalCheck(nbhState string) bool {
-	survived := false
+//OrganConfig is one destination of metastasis with its relative probability.
+type OrganConfig struct {
+	Name        string  `json:"name"`
+	Probability float64 `json:"probability"`
+}
+
+//MetastasisConfig holds the destinations of metastatic cells.
+type MetastasisConfig struct {
 
-	if nbhState == "single" {
-		prob := rand.Intn(10000)
-		if prob <= 5 {
-			survived = true
-			fmt.Println("A single cell has survived! Extravastating...")
-		}
+	//Preset is the cancer type whose organ tropism is used if Organs is empty: "breast" (default), "colorectal", "prostate", "lung" or "melanoma"
+	Preset string `json:"preset"`
+
+	//Organs lists the destinations and their probabilities, which are normalised to sum to one
+	Organs []OrganConfig `json:"organs"`
+
+	//CloneTropism overrides the destinations for the cells of a clone, keyed by clone
+	CloneTropism map[int][]OrganConfig `json:"cloneTropism"`
+
+	//Size of the clusters shed into ruptured vessels and their chance of surviving the circulation
+	Intravasation IntravasationConfig `json:"intravasation"`
+
+	//Transit of the cells through the blood stream, and their dormancy at the destination
+	Circulation CirculationConfig `json:"circulation"`
+
+	//Secondary-site simulations spawned by the cells that reach an organ
+	Secondary SecondaryConfig `json:"secondary"`
+}
+
+//DefaultMetastasisConfig returns the breast cancer preset.
+func DefaultMetastasisConfig() MetastasisConfig {
+
+	var metaConfig MetastasisConfig
+
+	metaConfig.Preset = "breast"
+	metaConfig.Intravasation = DefaultIntravasationConfig()
+	metaConfig.Circulation = DefaultCirculationConfig()
+	metaConfig.Secondary = DefaultSecondaryConfig()
+
+	return metaConfig
+}
+
+//GetOrganPreset returns the organ tropism of a cancer type: approximate shares of distant metastases by site, from population studies.
+func GetOrganPreset(preset string) []OrganConfig {
+
+	if preset == "breast" {
+		//54.61% bones, 25.53% lungs, the rest liver (the original model)
+		return []OrganConfig{{"Bones", 0.5461}, {"Lungs", 0.2553}, {"Liver", 0.1986}}
+	} else if preset == "colorectal" {
+		return []OrganConfig{{"Liver", 0.55}, {"Lungs", 0.25}, {"Peritoneum", 0.15}, {"Bones", 0.05}}
+	} else if preset == "prostate" {
+		return []OrganConfig{{"Bones", 0.74}, {"Lymph nodes", 0.09}, {"Liver", 0.09}, {"Lungs", 0.08}}
+	} else if preset == "lung" {
+		return []OrganConfig{{"Brain", 0.28}, {"Bones", 0.25}, {"Liver", 0.20}, {"Adrenal glands", 0.15}, {"Lungs", 0.12}}
+	} else if preset == "melanoma" {
+		return []OrganConfig{{"Lungs", 0.36}, {"Liver", 0.20}, {"Brain", 0.20}, {"Bones", 0.14}, {"Skin", 0.10}}
 	}
 
-	if nbhState == "cluster" {
-		prob := rand.Intn(10000)
-		if prob <= 250 {
-			survived = true
-			fmt.Println("A cluster of cells has survived! Extravastating...")
-		}
+	panic("Metastasis preset has to be breast, colorectal, prostate, lung or melanoma")
+}
+
+//GetOrganTropism returns the destinations of cells of the given clone: the clone's override if any, else Organs, else the preset.
+func GetOrganTropism(metaConfig MetastasisConfig, clone int) []OrganConfig {
+
+	if organs, ok := metaConfig.CloneTropism[clone]; ok == true {
+		return organs
 	}
 
-	return survived
+	if len(metaConfig.Organs) > 0 {
+		return metaConfig.Organs
+	}
 
+	return GetOrganPreset(metaConfig.Preset)
 }
 
-//Extravastate simulates the extravastation of breast cancer cell/cells into either bone, lungs, or liver.
-func Extravastate(metaCount [3]int) [3]int {
-	prob := rand.Intn(10000)
+//CheckMetastasisConfig stops the program if a list of destinations (Organs or a clone override) has a negative probability,
+//or probabilities that sum to zero, so that every cell that extravasates reaches an organ.
+func CheckMetastasisConfig(metaConfig MetastasisConfig) {
 
-	//metaCount[0]=Bones, metaCount[1]=lungs, metaCount[2]=liver
+	lists := map[string][]OrganConfig{"organs": GetOrganTropism(metaConfig, 0)}
+	for clone, organs := range metaConfig.CloneTropism {
+		lists["cloneTropism of clone "+strconv.Itoa(clone)] = organs
+	}
+
+	for name, organs := range lists {
+
+		total := 0.0
+		for _, organ := range organs {
+			if organ.Probability < 0.0 {
+				panic("Metastasis " + name + " has a negative probability for " + organ.Name)
+			}
+			total += organ.Probability
+		}
 
-	//Bones
-	if prob < 5461 {
-		metaCount[0]++
+		if total <= 0.0 {
+			panic("Metastasis " + name + " has no destination with a probability above zero")
+		}
 	}
+}
+
+//GetOrganNames returns every destination named in metaConfig (base list and clone overrides), in order of first appearance.
+//These are the columns of the metastasis counts.
+func GetOrganNames(metaConfig MetastasisConfig) []string {
 
-	//Lungs
-	if prob > 5461 && prob < 5461+2553 {
-		metaCount[1]++
+	organNames := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(organs []OrganConfig) {
+		for _, organ := range organs {
+			if seen[organ.Name] == false {
+				seen[organ.Name] = true
+				organNames = append(organNames, organ.Name)
+			}
+		}
 	}
 
-	//Liver
-	if prob > 5461+2553 && prob < 9999 {
-		metaCount[2]++
+	add(GetOrganTropism(metaConfig, 0))
+
+	//clones in increasing order, so that the columns do not depend on map order
+	clones := make([]int, 0)
+	for clone := range metaConfig.CloneTropism {
+		clones = append(clones, clone)
 	}
+	sort.Ints(clones)
 
-	return metaCount
+	for _, clone := range clones {
+		add(metaConfig.CloneTropism[clone])
+	}
 
+	return organNames
 }
 
-//Generate2DMatricesMetastasis expands on the Generate2DMatrices function and adds a metastasis part
-func Generate2DMatricesMetastasis(numGens int, x, y int, Kcc, Knn, Knc float64, seedType string) ([]Matrix2D, [][3]int) {
+//Extravastate simulates the extravastation of cancer cell/cells into one of the organs, drawn with their probabilities.
+//metaCount holds the count of each organ in organNames. The name of the organ reached is returned with the updated counts.
+//The probabilities are checked by CheckMetastasisConfig, so an organ is always reached.
+func Extravastate(metaCount []int, organs []OrganConfig, organNames []string) ([]int, string) {
 
-	matrices := make([]Matrix2D, numGens+1)
-	matrices[0] = Initialize2DMatrix(x, y)
-	centerCell := GetCentralCell2D(matrices[0])
+	total := 0.0
+	for _, organ := range organs {
+		total += organ.Probability
+	}
+
+	draw := RNG.Float64() * total
 
-	cellNhd := GetCurrentNeighborhood2D(matrices[0], centerCell.location.x, centerCell.location.y, x, y)
-	for n := range cellNhd.neighbors {
-		matrices[0][cellNhd.neighbors[n].location.x][cellNhd.neighbors[n].location.y].state = "C"
-		i := cellNhd.neighbors[n].location.x
-		j := cellNhd.neighbors[n].location.y
+	//the organ drawn; rounding can leave the draw just past the end, where it falls to the last organ that can be reached
+	reached := -1
 
-		neighborNhd := GetCurrentNeighborhood2D(matrices[0], i, j, x, y)
+	for o := range organs {
+		if organs[o].Probability <= 0.0 {
+			continue
+		}
+		reached = o
+		if draw < organs[o].Probability {
+			break
+		}
+		draw -= organs[o].Probability
+	}
 
-		for m := range neighborNhd.neighbors {
-			matrices[0][neighborNhd.neighbors[m].location.x][neighborNhd.neighbors[m].location.y].state = "C"
+	if reached < 0 {
+		return metaCount, ""
+	}
 
+	for n := range organNames {
+		if organNames[n] == organs[reached].Name {
+			metaCount[n]++
 		}
 	}
-	matrices[0][centerCell.location.x][centerCell.location.y].state = "C"
+
+	return metaCount, organs[reached].Name
+}
+
+//Generate2DMatricesMetastasis expands on the Generate2DMatrices function and adds a metastasis part
+//The counts of each generation are given per organ, in the order of GetOrganNames(config.Metastasis).
+//If enabled in config, cells reaching an organ spawn secondary sites, which are simulated alongside.
+//The counts, the intravasation events, the secondary sites and the CTC counts of each generation are returned in MetastasisResults,
+//along with the first error met when writing the exports.
+func Generate2DMatricesMetastasis(numGens int, x, y int, Kcc, Knn, Knc float64, seedType string, config Config) ([]Matrix2D, MetastasisResults, error) {
+
+	matrices := make([]Matrix2D, numGens+1)
+	matrices[0] = InitialMatrix2D(x, y, config)
+	err := ExportGeneration(matrices[0], nil, 0, 0, Kcc, Knn, Knc, config)
+	if err != nil {
+		return nil, MetastasisResults{}, err
+	}
 
 	//metastasis edited code -----------------------------------------------------
-	metaSlice := make([][3]int, 0)
-	firstGenMeta := [3]int{0, 0, 0}
+	organNames := GetOrganNames(config.Metastasis)
+
+	metaSlice := make([][]int, 0)
+	firstGenMeta := make([]int, len(organNames))
 	metaSlice = append(metaSlice, firstGenMeta)
 
 	metaBoard := GenerateMetastasisBoard2D(matrices[0])
 	metaBoard = SeedMetastasisBoard2D(metaBoard, seedType)
 
+	sites := make([]SecondarySite, 0)
+
+	var circulation Circulation
+	ctcCounts := make([]CirculationCounts, 0)
+
+	allEvents := make([]MetastasisEvent, 0)
+
 	for m := 1; m <= numGens; m++ {
 		fmt.Println("Updating " + strconv.Itoa(m) + "th generation...")
-		matrices[m] = Update2DMatrix(matrices[m-1], Kcc, Knn, Knc)
+		matrices[m] = Update2DMatrix(matrices[m-1], Kcc, Knn, Knc, config)
+		err = ExportGeneration(matrices[m], nil, m, 0, Kcc, Knn, Knc, config)
+		if err != nil {
+			return nil, MetastasisResults{}, err
+		}
+
+		//secondary sites grow alongside the primary
+		sites = UpdateSecondarySites2D(sites)
+
+		nextMetaCount, events := Metastasis2D(matrices[m], metaBoard, metaSlice[m-1], config.Metastasis, organNames)
+		for e := range events {
+			events[e].generation = m
+			if events[e].fate == "extravasated" {
+				events[e].arrival = m
+			}
+		}
+		allEvents = append(allEvents, events...)
+
+		//the intravasated cells enter the blood stream, and those settling in an organ this generation take their place
+		if config.Metastasis.Circulation.Enabled == true {
+			var counts CirculationCounts
+			circulation, nextMetaCount, events, counts = UpdateCirculation(circulation, allEvents, len(events), nextMetaCount, m, config.Metastasis, organNames)
+			ctcCounts = append(ctcCounts, counts)
+		}
 
-		nextMetaCount := Metastasis2D(matrices[m], metaBoard, metaSlice[m-1])
 		metaSlice = append(metaSlice, nextMetaCount)
+
+		for _, event := range events {
+			if config.Metastasis.Secondary.Enabled == true && event.survived == true && event.organ != "" && len(sites) < config.Metastasis.Secondary.MaxSites {
+				sites = append(sites, SpawnSecondarySite2D(event, Kcc, Knn, Knc, config))
+			}
+		}
+	}
+
+	if config.Metastasis.Secondary.Enabled == true {
+		fmt.Println("Simulated " + strconv.Itoa(len(sites)) + " secondary sites")
 	}
 
-	return matrices, metaSlice
+	return matrices, MetastasisResults{metaSlice, allEvents, sites, ctcCounts}, nil
 	//----------------------------------------------------------------------------
 }
 
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//Metastasis3D is the 3D version of Metastasis2D.
+func Metastasis3D(currMatrix Matrix, metaBoard [][][]bool, metaCount []int, metaConfig MetastasisConfig, organNames []string) ([]int, []MetastasisEvent) {
+
+	//copying, so that the counts of the previous generation are kept
+	metaCount = append([]int(nil), metaCount...)
+
+	events := make([]MetastasisEvent, 0)
+
+	for i := range currMatrix {
+		for j := range currMatrix[i] {
+			for k := range currMatrix[i][j] {
+				//If the cell is cancerous and there is a ruptured vessel at the same coordinate
+				if IsVascular3D(metaBoard, currMatrix, i, j, k) == true {
+
+					var event MetastasisEvent
+					event.x = i
+					event.y = j
+					event.z = k
+					event.clone = currMatrix[i][j][k].clone
+
+					//measuring the cluster touching the vessel
+					event.connectedSize = len(GetConnectedCluster3D(currMatrix, i, j, k))
+					event.clusterSize = GetShedClusterSize(event.connectedSize, metaConfig.Intravasation)
+
+					if metaConfig.Circulation.Enabled == false {
+						event.survived = SurvivalCheckSize(event.clusterSize, metaConfig.Intravasation)
+						event.fate = "died"
+
+						if event.survived == true {
+							metaCount, event.organ = Extravastate(metaCount, GetOrganTropism(metaConfig, event.clone), organNames)
+							event.fate = "extravasated"
+						}
+					}
+
+					events = append(events, event)
+				}
+			}
+		}
+	}
+
+	return metaCount, events
+}
+
+//GenerateMetastasisBoard3D is the 3D version of GenerateMetastasisBoard2D
+func GenerateMetastasisBoard3D(currMatrix Matrix) [][][]bool {
+
+	metaBoard := make([][][]bool, GetNumRows(currMatrix))
+
+	for i := range metaBoard {
+		metaBoard[i] = make([][]bool, GetNumCols(currMatrix))
+		for j := range metaBoard[i] {
+			metaBoard[i][j] = make([]bool, GetNumAisles(currMatrix))
+		}
+	}
+
+	return metaBoard
+}
+
+//SeedMetastasisBoard3D seeds ruptured vessels on the 3D board:
+//
+//	"random"  a single random coordinate
+//	"set"     six coordinates, a quarter of the board away from the center along each axis
+//	"tube"    a vessel running along the aisles, a quarter of the board away from the center, ruptured every tenth site
+func SeedMetastasisBoard3D(metaBoard [][][]bool, seedType string) [][][]bool {
+
+	numRows := len(metaBoard)
+	numCols := len(metaBoard[0])
+	numAisles := len(metaBoard[0][0])
+
+	if seedType == "random" {
+		metaBoard[RNG.Intn(numRows)][RNG.Intn(numCols)][RNG.Intn(numAisles)] = true
+	} else if seedType == "set" {
+		metaBoard[numRows/4][numCols/2][numAisles/2] = true
+		metaBoard[numRows*3/4][numCols/2][numAisles/2] = true
+		metaBoard[numRows/2][numCols/4][numAisles/2] = true
+		metaBoard[numRows/2][numCols*3/4][numAisles/2] = true
+		metaBoard[numRows/2][numCols/2][numAisles/4] = true
+		metaBoard[numRows/2][numCols/2][numAisles*3/4] = true
+	} else if seedType == "tube" {
+		for k := 0; k < numAisles; k += 10 {
+			metaBoard[numRows*3/4][numCols/2][k] = true
+		}
+	} else {
+		panic("Seed type has to be random, set or tube")
+	}
+
+	return metaBoard
+}
+
+//IsVascular3D is the 3D version of IsVascular
+func IsVascular3D(metaBoard [][][]bool, currMatrix Matrix, i, j, k int) bool {
+	return metaBoard[i][j][k] == true && currMatrix[i][j][k].state == "C"
+}
+
+//GetConnectedCluster3D is the 3D version of GetConnectedCluster2D
+func GetConnectedCluster3D(matrix Matrix, i, j, k int) []OrderedTrio {
+
+	numRows := GetNumRows(matrix)
+	numCols := GetNumCols(matrix)
+	numAisles := GetNumAisles(matrix)
+
+	cluster := make([]OrderedTrio, 0)
+
+	if matrix[i][j][k].state != "C" && matrix[i][j][k].state != "Q" {
+		return cluster
+	}
+
+	start := OrderedTrio{i, j, k}
+	visited := map[OrderedTrio]bool{start: true}
+	queue := []OrderedTrio{start}
+
+	for len(queue) > 0 {
+
+		site := queue[0]
+		queue = queue[1:]
+		cluster = append(cluster, site)
+
+		nextSites := []OrderedTrio{
+			{site.x - 1, site.y, site.z}, {site.x + 1, site.y, site.z},
+			{site.x, site.y - 1, site.z}, {site.x, site.y + 1, site.z},
+			{site.x, site.y, site.z - 1}, {site.x, site.y, site.z + 1},
+		}
+		for _, next := range nextSites {
+			if next.x < 0 || next.x >= numRows || next.y < 0 || next.y >= numCols || next.z < 0 || next.z >= numAisles || visited[next] == true {
+				continue
+			}
+			if matrix[next.x][next.y][next.z].state == "C" || matrix[next.x][next.y][next.z].state == "Q" {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return cluster
+}
+
+//GenerateMatricesMetastasis is the 3D version of Generate2DMatricesMetastasis. Secondary sites are not simulated in 3D.
+func GenerateMatricesMetastasis(initialMatrix Matrix, numGens int, Kcc, Knn, Knc float64, seedType string, config Config) ([]Matrix, MetastasisResults, error) {
+
+	matrices := make([]Matrix, numGens+1)
+	matrices[0] = SeedMatrix3D(initialMatrix, config)
+	err := ExportGeneration(nil, matrices[0], 0, 0, Kcc, Knn, Knc, config)
+	if err != nil {
+		return nil, MetastasisResults{}, err
+	}
+
+	organNames := GetOrganNames(config.Metastasis)
+
+	metaSlice := make([][]int, 0)
+	metaSlice = append(metaSlice, make([]int, len(organNames)))
+
+	metaBoard := GenerateMetastasisBoard3D(matrices[0])
+	metaBoard = SeedMetastasisBoard3D(metaBoard, seedType)
+
+	var circulation Circulation
+	ctcCounts := make([]CirculationCounts, 0)
+
+	allEvents := make([]MetastasisEvent, 0)
+
+	for m := 1; m <= numGens; m++ {
+		fmt.Println("3D Matrix Generation No." + strconv.Itoa(m))
+		matrices[m] = UpdateMatrix(matrices[m-1], Kcc, Knn, Knc)
+		err = ExportGeneration(nil, matrices[m], m, 0, Kcc, Knn, Knc, config)
+		if err != nil {
+			return nil, MetastasisResults{}, err
+		}
+
+		nextMetaCount, events := Metastasis3D(matrices[m], metaBoard, metaSlice[m-1], config.Metastasis, organNames)
+		for e := range events {
+			events[e].generation = m
+			if events[e].fate == "extravasated" {
+				events[e].arrival = m
+			}
+		}
+		allEvents = append(allEvents, events...)
+
+		if config.Metastasis.Circulation.Enabled == true {
+			var counts CirculationCounts
+			circulation, nextMetaCount, _, counts = UpdateCirculation(circulation, allEvents, len(events), nextMetaCount, m, config.Metastasis, organNames)
+			ctcCounts = append(ctcCounts, counts)
+		}
+
+		metaSlice = append(metaSlice, nextMetaCount)
+	}
+
+	return matrices, MetastasisResults{metaSlice, allEvents, nil, ctcCounts}, nil
+}
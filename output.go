@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//OutputDir is the run directory every output of the program is written to, and OutputFiles the files written to it so far.
+//Simulations write to a new directory under "runs" (see SetupRunDirectory); the GIF modes work in the directory given with -out,
+//or else in the latest run directory (see OpenRunDirectory).
+var OutputDir = "."
+var OutputFiles = make([]string, 0)
+
+//RunStarted is the time the run directory was set up.
+var RunStarted = time.Now()
+
+//Manifest lists the files of a run directory, in manifest.json, with the command and seed of the run that wrote them.
+type Manifest struct {
+	Command  []string       `json:"command"`
+	Seed     int64          `json:"seed"`
+	Started  string         `json:"started"`
+	Finished string         `json:"finished"`
+	Files    []ManifestFile `json:"files"`
+}
+
+//ManifestFile is a file of a run directory: its path in the directory, its size in bytes and its SHA-256 checksum.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+//SetupRunDirectory makes the run directory of a simulation: dir if it is given, otherwise runs/run_<date>_<time> under the current
+//directory. It refuses a directory that already holds files, unless overwrite is true, so that runs never destroy each other's results.
+func SetupRunDirectory(dir string, overwrite bool) error {
+
+	RunStarted = time.Now()
+
+	if dir == "" {
+		dir = filepath.Join("runs", "run_"+RunStarted.Format("20060102_150405"))
+
+		//two runs started in the same second get their own directories
+		for n := 2; ; n++ {
+			empty, err := IsDirEmpty(dir)
+			if err != nil {
+				return err
+			}
+			if empty == true {
+				break
+			}
+			dir = filepath.Join("runs", "run_"+RunStarted.Format("20060102_150405")+"_"+strconv.Itoa(n))
+		}
+	} else {
+		empty, err := IsDirEmpty(dir)
+		if err != nil {
+			return err
+		}
+
+		if empty == false {
+			if overwrite == false {
+				return errors.New("output directory " + dir + " already holds a run; choose another with -out or write over it with -overwrite")
+			}
+
+			//the manifest of the previous run no longer describes the directory
+			err = os.Remove(filepath.Join(dir, "manifest.json"))
+			if err != nil && os.IsNotExist(err) == false {
+				return err
+			}
+		}
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.New("problem when making output directory " + dir + ": " + err.Error())
+	}
+
+	OutputDir = dir
+	OutputFiles = make([]string, 0)
+
+	fmt.Println("Writing the outputs to " + dir)
+
+	return nil
+}
+
+//OpenRunDirectory makes dir, the directory of an earlier run, the run directory of the program, so that its files are read
+//and added to. If dir is not given, the latest run directory under "runs" is opened.
+func OpenRunDirectory(dir string) error {
+
+	if dir == "" {
+		var err error
+		dir, err = GetLatestRunDirectory()
+		if err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.New("problem when opening run directory " + dir + ": " + err.Error())
+	}
+	if info.IsDir() == false {
+		return errors.New("run directory " + dir + " is not a directory")
+	}
+
+	OutputDir = dir
+	OutputFiles = make([]string, 0)
+
+	fmt.Println("Working in " + dir)
+
+	return nil
+}
+
+//GetLatestRunDirectory returns the directory under "runs" of the latest run, going by the times and numbers SetupRunDirectory
+//names them with.
+func GetLatestRunDirectory() (string, error) {
+
+	files, err := ioutil.ReadDir("runs")
+	if err != nil && os.IsNotExist(err) == false {
+		return "", errors.New("problem when reading runs: " + err.Error())
+	}
+
+	latest := ""
+	latestStarted := ""
+	latestNumber := 0
+
+	for _, file := range files {
+		name := file.Name()
+
+		//run_<date>_<time>, followed by _<number> for the second run and on of the same second
+		if file.IsDir() == false || strings.HasPrefix(name, "run_") == false || len(name) < 19 {
+			continue
+		}
+		started := name[4:19]
+		number := 1
+		if len(name) > 19 {
+			if name[19] != '_' {
+				continue
+			}
+			number, err = strconv.Atoi(name[20:])
+			if err != nil {
+				continue
+			}
+		}
+
+		if started > latestStarted || (started == latestStarted && number > latestNumber) {
+			latest = name
+			latestStarted = started
+			latestNumber = number
+		}
+	}
+
+	if latest == "" {
+		return "", errors.New("no run directory found under runs; give the run directory with -out")
+	}
+
+	return filepath.Join("runs", latest), nil
+}
+
+//IsDirEmpty returns true if dir does not exist or holds no files, and an error if dir cannot be read.
+func IsDirEmpty(dir string) (bool, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) == true {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.New("problem when reading output directory " + dir + ": " + err.Error())
+	}
+
+	return len(files) == 0, nil
+}
+
+//GetOutputPath returns the path of a file or folder named name in the run directory.
+func GetOutputPath(name string) string {
+	return filepath.Join(OutputDir, name)
+}
+
+//RegisterOutputFile adds a file written to the run directory to the manifest.
+func RegisterOutputFile(filename string) {
+	OutputFiles = append(OutputFiles, filename)
+}
+
+//CreateOutputFile creates (or truncates) a file of the run directory and registers it for the manifest.
+func CreateOutputFile(filename string) (*os.File, error) {
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	RegisterOutputFile(filename)
+
+	return file, nil
+}
+
+//CloseOutputFile flushes writer and closes the file under it, returning the first error met when writing the file:
+//a bufio.Writer keeps the first error of its writes, which Flush returns.
+func CloseOutputFile(file *os.File, writer *bufio.Writer) error {
+
+	err := writer.Flush()
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + file.Name() + ": " + err.Error())
+	}
+
+	return nil
+}
+
+//WriteCSVFile writes the rows of a CSV file of the run directory, returning the first error met.
+func WriteCSVFile(filename string, rows [][]string) error {
+
+	csvfile, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(csvfile)
+	writer.WriteAll(rows)
+
+	err = writer.Error()
+	if errClose := csvfile.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + filename + ": " + err.Error())
+	}
+
+	return nil
+}
+
+//WriteOutputFile writes data to a file of the run directory.
+func WriteOutputFile(filename string, data []byte) error {
+
+	err := ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	RegisterOutputFile(filename)
+
+	return nil
+}
+
+//GetFileChecksum returns the SHA-256 checksum of a file, in hex.
+func GetFileChecksum(filename string) (string, error) {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+//WriteManifest writes manifest.json in the run directory, listing the files written by this run and, if the directory already
+//had a manifest, the files listed there that still exist, so that the GIF modes add to the manifest of the run they work in.
+func WriteManifest() error {
+
+	manifestFile := GetOutputPath("manifest.json")
+
+	manifest := Manifest{Command: os.Args, Seed: RandomSeed, Started: RunStarted.Format(time.RFC3339)}
+
+	paths := make(map[string]bool)
+
+	data, err := ioutil.ReadFile(manifestFile)
+	if err == nil {
+		var previous Manifest
+		if json.Unmarshal(data, &previous) == nil {
+			manifest.Command, manifest.Seed, manifest.Started = previous.Command, previous.Seed, previous.Started
+			for _, file := range previous.Files {
+				paths[file.Path] = true
+			}
+		}
+	}
+
+	for _, filename := range OutputFiles {
+		relative, err := filepath.Rel(OutputDir, filename)
+		if err != nil || strings.HasPrefix(relative, "..") {
+			continue
+		}
+		paths[filepath.ToSlash(relative)] = true
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	manifest.Files = make([]ManifestFile, 0, len(sorted))
+
+	for _, path := range sorted {
+		filename := filepath.Join(OutputDir, filepath.FromSlash(path))
+
+		info, err := os.Stat(filename)
+		if err != nil || info.IsDir() == true {
+			continue
+		}
+
+		checksum, err := GetFileChecksum(filename)
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, ManifestFile{Path: path, Bytes: info.Size(), SHA256: checksum})
+	}
+
+	manifest.Finished = time.Now().Format(time.RFC3339)
+
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(manifestFile, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Wrote " + strconv.Itoa(len(manifest.Files)) + " files to " + OutputDir + ", listed in manifest.json")
+
+	return nil
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+//OverlayConfig holds the settings of the annotations drawn into each frame of the animations: a legend of the state colors,
+//a generation (and time) label and a scale bar in a footer below the lattice, and an inset chart of the population counts.
+type OverlayConfig struct {
+
+	//Enabled turns the overlays on
+	Enabled bool `json:"enabled"`
+
+	//Legend of the colors of LegendStates
+	Legend       bool     `json:"legend"`
+	LegendStates []string `json:"legendStates"`
+
+	//Label of the generation, and of the time if HoursPerGeneration is above 0 (in hours, or in days past two days)
+	Label              bool    `json:"label"`
+	HoursPerGeneration float64 `json:"hoursPerGeneration"`
+
+	//Scale bar, given the size of a lattice site in micrometres. Its length is chosen if ScaleBarLength is 0.
+	ScaleBar       bool    `json:"scaleBar"`
+	SiteSize       float64 `json:"siteSize"`
+	ScaleBarLength float64 `json:"scaleBarLength"`
+
+	//Inset line chart of the number of sites in each of ChartStates, in the top right corner, in pixels
+	Chart       bool     `json:"chart"`
+	ChartStates []string `json:"chartStates"`
+	ChartWidth  int      `json:"chartWidth"`
+	ChartHeight int      `json:"chartHeight"`
+
+	//TextScale enlarges the 5 by 7 pixel font, for frames drawn with a large cell width
+	TextScale int `json:"textScale"`
+
+	//generation of the first frame, above 0 for runs resumed from a snapshot
+	firstGeneration int
+}
+
+//DefaultOverlayConfig returns disabled overlays with every annotation, for sites of 10 micrometres.
+func DefaultOverlayConfig() OverlayConfig {
+
+	var overlayConfig OverlayConfig
+
+	overlayConfig.Enabled = false
+	overlayConfig.Legend = true
+	overlayConfig.LegendStates = []string{"C", "Q", "N", "wN"}
+	overlayConfig.Label = true
+	overlayConfig.HoursPerGeneration = 0
+	overlayConfig.ScaleBar = true
+	overlayConfig.SiteSize = 10
+	overlayConfig.ScaleBarLength = 0
+	overlayConfig.Chart = true
+	overlayConfig.ChartStates = []string{"C", "Q", "N"}
+	overlayConfig.ChartWidth = 80
+	overlayConfig.ChartHeight = 50
+	overlayConfig.TextScale = 1
+
+	return overlayConfig
+}
+
+//Font5x7 holds the glyphs of the overlay text, each 7 rows of 5 pixels. Letters without a glyph of their own are drawn in upper case.
+var Font5x7 = map[rune][7]string{
+	' ': {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I': {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'd': {"....#", "....#", ".##.#", "#..##", "#...#", "#...#", ".####"},
+	'h': {"#....", "#....", "#.##.", "##..#", "#...#", "#...#", "#...#"},
+	'm': {".....", ".....", "##.#.", "#.#.#", "#.#.#", "#.#.#", "#.#.#"},
+	's': {".....", ".....", ".###.", "#....", ".###.", "....#", "####."},
+	'µ': {".....", "#...#", "#...#", "#...#", "#..##", "##.#.", "#...."},
+	'.': {".....", ".....", ".....", ".....", ".....", ".##..", ".##.."},
+	':': {".....", ".##..", ".##..", ".....", ".##..", ".##..", "....."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'=': {".....", ".....", "#####", ".....", "#####", ".....", "....."},
+	'/': {".....", "....#", "...#.", "..#..", ".#...", "#....", "....."},
+	'%': {"##..#", "##..#", "...#.", "..#..", ".#...", "#..##", "#..##"},
+	'(': {"...#.", "..#..", ".#...", ".#...", ".#...", "..#..", "...#."},
+	')': {".#...", "..#..", "...#.", "...#.", "...#.", "..#..", ".#..."},
+	'?': {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+}
+
+//GetGlyph returns the glyph of a character, its upper case if it has no glyph of its own, and "?" if neither has one.
+func GetGlyph(char rune) [7]string {
+
+	glyph, ok := Font5x7[char]
+	if ok == true {
+		return glyph
+	}
+
+	glyph, ok = Font5x7[unicode.ToUpper(char)]
+	if ok == true {
+		return glyph
+	}
+
+	return Font5x7['?']
+}
+
+//GetTextWidth returns the width in pixels of a text drawn by DrawText: 6 pixels a character (5 and a space), times scale.
+func GetTextWidth(text string, scale int) int {
+	return 6 * scale * len([]rune(text))
+}
+
+//DrawText draws a text with its top left corner at x,y, each pixel of the font being a square of scale pixels.
+func DrawText(c *Canvas, text string, x, y, scale int, col color.Color) {
+
+	for _, char := range text {
+		glyph := GetGlyph(char)
+
+		for row := range glyph {
+			for column, pixel := range glyph[row] {
+				if pixel == '#' {
+					px := x + column*scale
+					py := y + row*scale
+					c.FillRect(px, py, px+scale, py+scale, col)
+				}
+			}
+		}
+
+		x += 6 * scale
+	}
+}
+
+//CountStates2D returns the number of sites of a matrix in each of states.
+func CountStates2D(matrix Matrix2D, states []string) []int {
+
+	counts := make([]int, len(states))
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			for s := range states {
+				if matrix[i][j].state == states[s] {
+					counts[s]++
+				}
+			}
+		}
+	}
+
+	return counts
+}
+
+//CountStates3D returns the number of sites of a 3D matrix in each of states.
+func CountStates3D(matrix Matrix, states []string) []int {
+
+	counts := make([]int, len(states))
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			for k := range matrix[i][j] {
+				for s := range states {
+					if matrix[i][j][k].state == states[s] {
+						counts[s]++
+					}
+				}
+			}
+		}
+	}
+
+	return counts
+}
+
+//GetPopulations2D returns the counts of the chart states of the overlays at every generation.
+func GetPopulations2D(timepoints []Matrix2D, overlayConfig OverlayConfig) [][]int {
+
+	populations := make([][]int, len(timepoints))
+
+	for g := range timepoints {
+		populations[g] = CountStates2D(timepoints[g], overlayConfig.ChartStates)
+	}
+
+	return populations
+}
+
+//GetPopulations3D returns the counts of the chart states of the overlays at every generation of a 3D run.
+func GetPopulations3D(timepoints []Matrix, overlayConfig OverlayConfig) [][]int {
+
+	populations := make([][]int, len(timepoints))
+
+	for g := range timepoints {
+		populations[g] = CountStates3D(timepoints[g], overlayConfig.ChartStates)
+	}
+
+	return populations
+}
+
+//GetStateColors2D returns the 2D colors of the states in the palette.
+func GetStateColors2D(states []string, paletteConfig PaletteConfig) map[string]color.Color {
+
+	colors := make(map[string]color.Color)
+
+	for _, state := range states {
+		colors[state] = GetPaletteStateColor2D(paletteConfig, state)
+	}
+
+	return colors
+}
+
+//GetRenderColors3D returns the colors of the 3D rendering of the states, leaving out those that are not drawn.
+func GetRenderColors3D(renderConfig RenderConfig) map[string]color.Color {
+
+	colors := make(map[string]color.Color)
+
+	for state, hex := range renderConfig.Colors {
+		if hex != "" {
+			colors[state] = ParseHexColor(hex)
+		}
+	}
+
+	return colors
+}
+
+//OverlayFrames2D draws the overlays into the frames of a 2D run drawn by DrawMatrices with cellWidth, in the colors of the palette.
+func OverlayFrames2D(imglist []image.Image, timepoints []Matrix2D, cellWidth int, overlayConfig OverlayConfig, paletteConfig PaletteConfig) []image.Image {
+
+	states := append(append([]string{}, overlayConfig.LegendStates...), overlayConfig.ChartStates...)
+
+	return OverlayFrames(imglist, GetPopulations2D(timepoints, overlayConfig), GetStateColors2D(states, paletteConfig), float64(cellWidth), overlayConfig)
+}
+
+//OverlayFrames draws the overlays of overlayConfig into the frames of an animation, frame g showing generation g.
+//populations holds the counts of the chart states at each generation and colors the colors of the states.
+//pixelsPerSite is the size of a lattice site in the frames; the scale bar is left out if it is 0.
+func OverlayFrames(imglist []image.Image, populations [][]int, colors map[string]color.Color, pixelsPerSite float64, overlayConfig OverlayConfig) []image.Image {
+
+	overlaid := make([]image.Image, len(imglist))
+
+	for g := range imglist {
+		overlaid[g] = OverlayFrame(imglist[g], g, populations, colors, pixelsPerSite, overlayConfig)
+	}
+
+	return overlaid
+}
+
+//OverlayFrame draws the overlays of generation g into a frame, returning a new image with the footer below the frame.
+func OverlayFrame(img image.Image, g int, populations [][]int, colors map[string]color.Color, pixelsPerSite float64, overlayConfig OverlayConfig) image.Image {
+
+	scale := overlayConfig.TextScale
+	if scale < 1 {
+		scale = 1
+	}
+	lineHeight := 9 * scale
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+
+	//the lines of the footer: the label, the legend (wrapped to the width of the frame) and the scale bar
+	legendLines := 0
+	if overlayConfig.Legend == true {
+		legendLines = len(GetLegendRows(overlayConfig.LegendStates, width, scale))
+	}
+
+	footerLines := legendLines
+	if overlayConfig.Label == true {
+		footerLines++
+	}
+	showScaleBar := overlayConfig.ScaleBar == true && pixelsPerSite > 0 && overlayConfig.SiteSize > 0
+	if showScaleBar == true {
+		footerLines++
+	}
+
+	footer := 0
+	if footerLines > 0 {
+		footer = footerLines*lineHeight + 2*scale
+	}
+
+	c := CreateNewCanvas(width, bounds.Dy()+footer)
+	draw.Draw(c.img, image.Rect(0, 0, width, bounds.Dy()), img, bounds.Min, draw.Src)
+
+	black := MakeColor(0, 0, 0)
+	y := bounds.Dy() + 2*scale
+
+	if overlayConfig.Label == true {
+		DrawText(&c, GetGenerationLabel(g, overlayConfig), 2*scale, y, scale, black)
+		y += lineHeight
+	}
+
+	if overlayConfig.Legend == true {
+		for _, row := range GetLegendRows(overlayConfig.LegendStates, width, scale) {
+			x := 2 * scale
+			for _, state := range row {
+				c.FillRect(x, y, x+7*scale, y+7*scale, black)
+				col, ok := colors[state]
+				if ok == false {
+					col = MakeColor(255, 255, 255)
+				}
+				c.FillRect(x+scale, y+scale, x+6*scale, y+6*scale, col)
+				DrawText(&c, state, x+9*scale, y, scale, black)
+				x += GetLegendEntryWidth(state, scale)
+			}
+			y += lineHeight
+		}
+	}
+
+	if showScaleBar == true {
+		DrawScaleBar(&c, 2*scale, y, pixelsPerSite, overlayConfig)
+	}
+
+	if overlayConfig.Chart == true && len(populations) > 0 {
+		x := width - overlayConfig.ChartWidth - 2*scale
+		DrawPopulationChart(&c, x, 2*scale, g, populations, colors, overlayConfig)
+	}
+
+	return c.img
+}
+
+//GetGenerationLabel returns the label of generation g, with the time elapsed if the length of a generation is set.
+func GetGenerationLabel(g int, overlayConfig OverlayConfig) string {
+
+	g += overlayConfig.firstGeneration
+
+	label := "GEN " + strconv.Itoa(g)
+
+	if overlayConfig.HoursPerGeneration > 0 {
+		hours := float64(g) * overlayConfig.HoursPerGeneration
+		if hours >= 48 {
+			label += fmt.Sprintf("  %.1f d", hours/24)
+		} else {
+			label += fmt.Sprintf("  %.1f h", hours)
+		}
+	}
+
+	return label
+}
+
+//GetLegendEntryWidth returns the width of the legend entry of a state: its swatch, name and a gap.
+func GetLegendEntryWidth(state string, scale int) int {
+	return 9*scale + GetTextWidth(state, scale) + 4*scale
+}
+
+//GetLegendRows splits the legend entries of states into rows that fit in width.
+func GetLegendRows(states []string, width, scale int) [][]string {
+
+	rows := make([][]string, 0)
+	row := make([]string, 0)
+	x := 2 * scale
+
+	for _, state := range states {
+		entryWidth := GetLegendEntryWidth(state, scale)
+		if len(row) > 0 && x+entryWidth > width {
+			rows = append(rows, row)
+			row = make([]string, 0)
+			x = 2 * scale
+		}
+		row = append(row, state)
+		x += entryWidth
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+//GetScaleBarLength returns the length of the scale bar in micrometres: ScaleBarLength if set, otherwise the longest
+//1, 2 or 5 times a power of ten that spans at most a quarter of the frame.
+func GetScaleBarLength(frameWidth int, pixelsPerSite float64, overlayConfig OverlayConfig) float64 {
+
+	if overlayConfig.ScaleBarLength > 0 {
+		return overlayConfig.ScaleBarLength
+	}
+
+	maxLength := float64(frameWidth) / 4 / pixelsPerSite * overlayConfig.SiteSize
+
+	power := math.Pow(10, math.Floor(math.Log10(maxLength)))
+	length := power
+	for _, step := range []float64{2, 5} {
+		if step*power <= maxLength {
+			length = step * power
+		}
+	}
+
+	return length
+}
+
+//DrawScaleBar draws the scale bar with its top left corner at x,y, labelled with its length.
+func DrawScaleBar(c *Canvas, x, y int, pixelsPerSite float64, overlayConfig OverlayConfig) {
+
+	scale := overlayConfig.TextScale
+	if scale < 1 {
+		scale = 1
+	}
+
+	length := GetScaleBarLength(c.width, pixelsPerSite, overlayConfig)
+	barWidth := int(math.Round(length / overlayConfig.SiteSize * pixelsPerSite))
+
+	black := MakeColor(0, 0, 0)
+	c.FillRect(x, y+2*scale, x+barWidth, y+5*scale, black)
+
+	label := strconv.FormatFloat(length, 'f', -1, 64) + " µm"
+	if length >= 1000 {
+		label = strconv.FormatFloat(length/1000, 'f', -1, 64) + " mm"
+	}
+	DrawText(c, label, x+barWidth+3*scale, y, scale, black)
+}
+
+//DrawPopulationChart draws a line chart of the populations up to generation g with its top left corner at x,y.
+//The axes span every generation and the highest count, so that the lines grow across the frames of an animation.
+func DrawPopulationChart(c *Canvas, x, y, g int, populations [][]int, colors map[string]color.Color, overlayConfig OverlayConfig) {
+
+	scale := overlayConfig.TextScale
+	if scale < 1 {
+		scale = 1
+	}
+
+	chartWidth := overlayConfig.ChartWidth
+	chartHeight := overlayConfig.ChartHeight
+
+	highest := 1
+	for _, counts := range populations {
+		for _, count := range counts {
+			if count > highest {
+				highest = count
+			}
+		}
+	}
+
+	//frame of the chart, and the highest count in the top left corner
+	c.FillRect(x, y, x+chartWidth, y+chartHeight, MakeColor(80, 80, 80))
+	c.FillRect(x+1, y+1, x+chartWidth-1, y+chartHeight-1, MakeColor(255, 255, 255))
+	DrawText(c, strconv.Itoa(highest), x+2, y+2, 1, MakeColor(80, 80, 80))
+
+	//lines are drawn in the plot area below the label
+	left := float64(x + 2)
+	top := float64(y + 11)
+	plotWidth := float64(chartWidth - 4)
+	plotHeight := float64(chartHeight) - 13
+
+	numGens := len(populations) - 1
+	if numGens < 1 {
+		numGens = 1
+	}
+
+	c.SetLineWidth(float64(scale))
+
+	for s, state := range overlayConfig.ChartStates {
+		col, ok := colors[state]
+		if ok == false {
+			col = MakeColor(0, 0, 0)
+		}
+		c.SetStrokeColor(col)
+
+		for t := 0; t <= g && t < len(populations); t++ {
+			px := left + plotWidth*float64(t)/float64(numGens)
+			py := top + plotHeight*(1-float64(populations[t][s])/float64(highest))
+			if t == 0 {
+				c.MoveTo(px, py)
+			} else {
+				c.LineTo(px, py)
+			}
+		}
+		c.Stroke()
+	}
+
+	c.SetLineWidth(1)
+}
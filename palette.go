@@ -0,0 +1,267 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+//PaletteConfig holds the colors of the drawings: of the 2D frames and slices, the 3D renders and the hex codes of OutputFile3DinCSV.
+//The "classic" scheme is the original colors, which differ between 2D and 3D; every other scheme is shared by both.
+type PaletteConfig struct {
+
+	//Scheme is the built-in palette of states and clones (see PaletteSchemes)
+	Scheme string `json:"scheme"`
+
+	//States overrides the colors of the scheme, as "#RRGGBB" by state. Healthy tissue is never drawn in 3D.
+	States map[string]string `json:"states"`
+
+	//Clones are the colors of the clones, as "#RRGGBB", used in turn; the scheme's if empty
+	Clones []string `json:"clones"`
+
+	//ColorBy is what the 2D frames show: "state", "clone" (living cancer cells by clone, other sites by state)
+	//or "field", the value of Field ("ecm", "pressure" or the name of a chemical) through Colormap
+	ColorBy string `json:"colorBy"`
+	Field   string `json:"field"`
+
+	//Colormap of field values (see Colormaps), from FieldMin to FieldMax
+	Colormap string  `json:"colormap"`
+	FieldMin float64 `json:"fieldMin"`
+	FieldMax float64 `json:"fieldMax"`
+
+	//Grid is the color of the lines drawn between sites of 2D frames with cells wider than a pixel, or none if ""
+	Grid string `json:"grid"`
+
+	//index of Field in Config.Chemicals, set by ReadConfig
+	chemicalIndex int
+}
+
+//PaletteScheme is a built-in palette: the colors of states in 2D and 3D, and a list of colors for clones.
+type PaletteScheme struct {
+	states2D, states3D map[string]string
+	clones             []string
+}
+
+//PaletteSchemes are the built-in palettes. "okabe-ito" and "tol-bright" can be told apart with any type of color blindness.
+var PaletteSchemes = map[string]PaletteScheme{
+	"classic": {
+		states2D: map[string]string{"C": "#0000FF", "Q": "#FFFF00", "h": "#D5F5E3", "N": "#FF0000", "wN": "#000000"},
+		states3D: map[string]string{"C": "#ADD8E6", "Q": "#FFFF00", "N": "#8B0000", "wN": "#696969"},
+		clones:   []string{"#E69F00", "#56B4E9", "#009E73", "#F0E442", "#0072B2", "#D55E00", "#CC79A7", "#000000"},
+	},
+	"okabe-ito": {
+		states2D: map[string]string{"C": "#0072B2", "Q": "#F0E442", "h": "#EAEAEA", "N": "#D55E00", "wN": "#000000"},
+		states3D: map[string]string{"C": "#0072B2", "Q": "#F0E442", "N": "#D55E00", "wN": "#000000"},
+		clones:   []string{"#E69F00", "#56B4E9", "#009E73", "#F0E442", "#0072B2", "#D55E00", "#CC79A7", "#000000"},
+	},
+	"tol-bright": {
+		states2D: map[string]string{"C": "#4477AA", "Q": "#CCBB44", "h": "#EEEEEE", "N": "#EE6677", "wN": "#BBBBBB"},
+		states3D: map[string]string{"C": "#4477AA", "Q": "#CCBB44", "N": "#EE6677", "wN": "#BBBBBB"},
+		clones:   []string{"#4477AA", "#EE6677", "#228833", "#CCBB44", "#66CCEE", "#AA3377", "#BBBBBB"},
+	},
+}
+
+//Colormaps are the continuous colormaps of field values, each sampled at evenly spaced stops from 0 to 1.
+var Colormaps = map[string][]string{
+	"viridis": {"#440154", "#472D7B", "#3B528B", "#2C728E", "#21918C", "#28AE80", "#5EC962", "#ADDC30", "#FDE725"},
+	"magma":   {"#000004", "#1C1044", "#4F127B", "#812581", "#B5367A", "#E55064", "#FB8861", "#FEC287", "#FCFDBF"},
+	"inferno": {"#000004", "#1F0C48", "#550F6D", "#88226A", "#BA3655", "#E35933", "#F98C0A", "#F9C932", "#FCFFA4"},
+	"gray":    {"#000000", "#FFFFFF"},
+}
+
+//DefaultPaletteConfig returns the original colors, by state, with fields in viridis from 0 to 1 and no grid lines.
+func DefaultPaletteConfig() PaletteConfig {
+
+	var paletteConfig PaletteConfig
+
+	paletteConfig.Scheme = "classic"
+	paletteConfig.States = map[string]string{}
+	paletteConfig.Clones = []string{}
+	paletteConfig.ColorBy = "state"
+	paletteConfig.Field = "ecm"
+	paletteConfig.Colormap = "viridis"
+	paletteConfig.FieldMin = 0
+	paletteConfig.FieldMax = 1
+	paletteConfig.Grid = ""
+
+	return paletteConfig
+}
+
+//CheckPaletteConfig stops the program if the palette names an unknown scheme, colormap or coloring, or has a bad color,
+//and finds the chemical shown by a "field" coloring.
+func CheckPaletteConfig(paletteConfig PaletteConfig, chemicals []ChemicalConfig) PaletteConfig {
+
+	if _, ok := PaletteSchemes[paletteConfig.Scheme]; ok == false {
+		panic("Palette scheme has to be one of " + strings.Join(GetPaletteNames(), ", "))
+	}
+
+	if _, ok := Colormaps[paletteConfig.Colormap]; ok == false {
+		panic("Colormap has to be one of " + strings.Join(GetColormapNames(), ", "))
+	}
+
+	for _, hex := range paletteConfig.States {
+		ParseHexColor(hex)
+	}
+	for _, hex := range paletteConfig.Clones {
+		ParseHexColor(hex)
+	}
+	if paletteConfig.Grid != "" {
+		ParseHexColor(paletteConfig.Grid)
+	}
+
+	if paletteConfig.ColorBy == "field" {
+		if paletteConfig.Field != "ecm" && paletteConfig.Field != "pressure" {
+			paletteConfig.chemicalIndex = GetChemicalIndex(chemicals, paletteConfig.Field)
+		}
+		if paletteConfig.FieldMax <= paletteConfig.FieldMin {
+			panic("Palette fieldMax has to be above fieldMin")
+		}
+	} else if paletteConfig.ColorBy != "state" && paletteConfig.ColorBy != "clone" {
+		panic("Palette colorBy has to be state, clone or field")
+	}
+
+	return paletteConfig
+}
+
+//GetPaletteNames returns the names of the built-in palettes, sorted.
+func GetPaletteNames() []string {
+
+	names := make([]string, 0, len(PaletteSchemes))
+	for name := range PaletteSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//GetColormapNames returns the names of the colormaps, sorted.
+func GetColormapNames() []string {
+
+	names := make([]string, 0, len(Colormaps))
+	for name := range Colormaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//GetStateHexColors2D returns the colors of the states in 2D, as "#RRGGBB": those of the scheme with the overrides of the palette.
+func GetStateHexColors2D(paletteConfig PaletteConfig) map[string]string {
+
+	colors := make(map[string]string)
+
+	for state, hex := range PaletteSchemes[paletteConfig.Scheme].states2D {
+		colors[state] = hex
+	}
+	for state, hex := range paletteConfig.States {
+		colors[state] = hex
+	}
+
+	return colors
+}
+
+//GetStateHexColors3D returns the colors of the states in 3D, as "#RRGGBB": those of the scheme with the overrides of the palette,
+//leaving out healthy tissue, which would hide the tumour.
+func GetStateHexColors3D(paletteConfig PaletteConfig) map[string]string {
+
+	colors := make(map[string]string)
+
+	for state, hex := range PaletteSchemes[paletteConfig.Scheme].states3D {
+		colors[state] = hex
+	}
+	for state, hex := range paletteConfig.States {
+		if state != "h" {
+			colors[state] = hex
+		}
+	}
+
+	return colors
+}
+
+//GetPaletteStateColor2D returns the color of a state in the 2D frames, white if it has none.
+func GetPaletteStateColor2D(paletteConfig PaletteConfig, state string) color.Color {
+
+	hex, ok := paletteConfig.States[state]
+	if ok == false {
+		hex, ok = PaletteSchemes[paletteConfig.Scheme].states2D[state]
+	}
+
+	if ok == false {
+		return MakeColor(255, 255, 255)
+	}
+
+	return ParseHexColor(hex)
+}
+
+//GetCloneColor returns the color of a clone, going through the clone colors in turn.
+func GetCloneColor(paletteConfig PaletteConfig, clone int) color.Color {
+
+	clones := paletteConfig.Clones
+	if len(clones) == 0 {
+		clones = PaletteSchemes[paletteConfig.Scheme].clones
+	}
+
+	//clones are numbered from 1
+	index := (clone - 1) % len(clones)
+	if index < 0 {
+		index += len(clones)
+	}
+
+	return ParseHexColor(clones[index])
+}
+
+//GetFieldValue2D returns the value at a site of the field shown by a "field" coloring.
+func GetFieldValue2D(cell Cell2D, paletteConfig PaletteConfig) float64 {
+
+	if paletteConfig.Field == "ecm" {
+		return cell.ecm
+	} else if paletteConfig.Field == "pressure" {
+		return cell.pressure
+	}
+
+	if paletteConfig.chemicalIndex < len(cell.chemicals) {
+		return cell.chemicals[paletteConfig.chemicalIndex]
+	}
+
+	return 0
+}
+
+//GetColormapColor returns the color of a colormap at t in [0,1], interpolating between its stops. t is clamped to [0,1].
+func GetColormapColor(colormap string, t float64) color.Color {
+
+	stops := Colormaps[colormap]
+
+	t = math.Max(0, math.Min(1, t))
+
+	position := t * float64(len(stops)-1)
+	lower := int(math.Floor(position))
+	if lower >= len(stops)-1 {
+		lower = len(stops) - 2
+	}
+	fraction := position - float64(lower)
+
+	a := ParseHexColor(stops[lower])
+	b := ParseHexColor(stops[lower+1])
+
+	r := float64(a.R) + fraction*(float64(b.R)-float64(a.R))
+	g := float64(a.G) + fraction*(float64(b.G)-float64(a.G))
+	bl := float64(a.B) + fraction*(float64(b.B)-float64(a.B))
+
+	return MakeColor(uint8(math.Round(r)), uint8(math.Round(g)), uint8(math.Round(bl)))
+}
+
+//GetSiteColor2D returns the color of a site in the 2D frames, as chosen by the colorBy of the palette.
+func GetSiteColor2D(cell Cell2D, paletteConfig PaletteConfig) color.Color {
+
+	if paletteConfig.ColorBy == "clone" && (cell.state == "C" || cell.state == "Q") {
+		return GetCloneColor(paletteConfig, cell.clone)
+	} else if paletteConfig.ColorBy == "field" {
+		value := GetFieldValue2D(cell, paletteConfig)
+		return GetColormapColor(paletteConfig.Colormap, (value-paletteConfig.FieldMin)/(paletteConfig.FieldMax-paletteConfig.FieldMin))
+	}
+
+	return GetPaletteStateColor2D(paletteConfig, cell.state)
+}
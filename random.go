@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+//RandomSource is the xoshiro256** generator behind RNG. Unlike the source of math/rand its state can be read and restored,
+//so that a run resumed from a snapshot draws the same numbers as the run that wrote it.
+type RandomSource struct {
+	state [4]uint64
+}
+
+//RandomSeed is the seed of the current run, RandomState its generator, and RNG the random numbers every part of the model draws.
+var RandomSeed int64
+var RandomState = NewRandomSource(1)
+var RNG = rand.New(RandomState)
+
+//NewRandomSource returns a generator seeded with seed.
+func NewRandomSource(seed int64) *RandomSource {
+
+	source := &RandomSource{}
+	source.Seed(seed)
+
+	return source
+}
+
+//Seed sets the state of the generator from seed, spreading it over the four words with splitmix64.
+func (r *RandomSource) Seed(seed int64) {
+
+	x := uint64(seed)
+
+	for i := range r.state {
+		x += 0x9E3779B97F4A7C15
+		z := x
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		r.state[i] = z ^ (z >> 31)
+	}
+}
+
+//Uint64 returns the next 64 random bits.
+func (r *RandomSource) Uint64() uint64 {
+
+	s := &r.state
+
+	result := RotateLeft(s[1]*5, 7) * 9
+	t := s[1] << 17
+
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = RotateLeft(s[3], 45)
+
+	return result
+}
+
+//Int63 returns a random non-negative int64.
+func (r *RandomSource) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+//RotateLeft rotates the bits of x left by k.
+func RotateLeft(x uint64, k uint) uint64 {
+	return (x << k) | (x >> (64 - k))
+}
+
+//SeedRandom seeds RNG for a new run. A seed of 0 is replaced by one taken from the clock; the seed used is returned.
+func SeedRandom(seed int64) int64 {
+
+	if seed == 0 {
+		seed = time.Now().UTC().UnixNano()
+	}
+
+	RandomSeed = seed
+	RandomState.Seed(seed)
+
+	return seed
+}
+
+//RestoreRandom sets the seed and the generator state of RNG to those saved in a snapshot.
+func RestoreRandom(seed int64, state [4]uint64) {
+	RandomSeed = seed
+	RandomState.state = state
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+)
+
+//RenderConfig holds the settings of the 3D renderer, which draws Matrix frames directly instead of going through R.
+type RenderConfig struct {
+
+	//Enabled turns rendering of the 3D runs on (the animation "growth3D")
+	Enabled bool `json:"enabled"`
+
+	//Size of the frames in pixels
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	//Projection is "orthographic" or "perspective"
+	Projection string `json:"projection"`
+
+	//Camera direction from the center of the lattice, in degrees: Azimuth around the z axis, Elevation above the x-y plane.
+	//Distance is the distance of a perspective camera from the center in multiples of the lattice size, FieldOfView its vertical angle.
+	//Zoom enlarges the picture in both projections.
+	Azimuth     float64 `json:"azimuth"`
+	Elevation   float64 `json:"elevation"`
+	Distance    float64 `json:"distance"`
+	FieldOfView float64 `json:"fieldOfView"`
+	Zoom        float64 `json:"zoom"`
+
+	//Direction the light comes from in degrees (as for the camera), and the brightness of faces turned away from it
+	LightAzimuth   float64 `json:"lightAzimuth"`
+	LightElevation float64 `json:"lightElevation"`
+	Ambient        float64 `json:"ambient"`
+
+	//Colors of the states drawn, as "#RRGGBB", on top of the 3D colors of the palette (set by ReadConfig).
+	//States without a color (healthy tissue by default) are not drawn; a state is hidden by giving it the color "".
+	Colors     map[string]string `json:"colors"`
+	Background string            `json:"background"`
+
+	//Cutaways hide the sites on the far side of planes through the lattice, to show the inside of the tumour
+	Cutaways []CutawayConfig `json:"cutaways"`
+
+	//RotationFrames is the number of frames of a full turn of the camera around the last generation ("rotate3D"). 0 skips it.
+	RotationFrames int `json:"rotationFrames"`
+}
+
+//CutawayConfig is a cutting plane. The sites p with Normal·(p - center of the lattice) > Offset are hidden.
+type CutawayConfig struct {
+	Normal [3]float64 `json:"normal"`
+	Offset float64    `json:"offset"`
+}
+
+//DefaultRenderConfig returns a disabled 400x400 orthographic renderer looking down on the lattice at an angle,
+//with the colors of the palette.
+func DefaultRenderConfig() RenderConfig {
+
+	var renderConfig RenderConfig
+
+	renderConfig.Enabled = false
+	renderConfig.Width = 400
+	renderConfig.Height = 400
+	renderConfig.Projection = "orthographic"
+	renderConfig.Azimuth = 45.0
+	renderConfig.Elevation = 30.0
+	renderConfig.Distance = 2.0
+	renderConfig.FieldOfView = 40.0
+	renderConfig.Zoom = 1.0
+	renderConfig.LightAzimuth = 75.0
+	renderConfig.LightElevation = 60.0
+	renderConfig.Ambient = 0.3
+	renderConfig.Colors = map[string]string{}
+	renderConfig.Background = "#FFFFFF"
+
+	return renderConfig
+}
+
+//Vector3 is a point or direction in the space of the lattice.
+type Vector3 struct {
+	x, y, z float64
+}
+
+//Camera projects points of the lattice onto the frame.
+type Camera struct {
+	perspective bool
+
+	//eye is the position of a perspective camera, center the point looked at
+	eye, center Vector3
+
+	//orthonormal basis of the camera: forward points into the picture
+	right, up, forward Vector3
+
+	//pixels per lattice site (orthographic) or focal length in pixels (perspective)
+	scale float64
+
+	width, height int
+}
+
+//AddVectors returns a + b.
+func AddVectors(a, b Vector3) Vector3 {
+	return Vector3{a.x + b.x, a.y + b.y, a.z + b.z}
+}
+
+//SubtractVectors returns a - b.
+func SubtractVectors(a, b Vector3) Vector3 {
+	return Vector3{a.x - b.x, a.y - b.y, a.z - b.z}
+}
+
+//ScaleVector returns s * a.
+func ScaleVector(a Vector3, s float64) Vector3 {
+	return Vector3{s * a.x, s * a.y, s * a.z}
+}
+
+//DotProduct returns a·b.
+func DotProduct(a, b Vector3) float64 {
+	return a.x*b.x + a.y*b.y + a.z*b.z
+}
+
+//CrossProduct returns a×b.
+func CrossProduct(a, b Vector3) Vector3 {
+	return Vector3{a.y*b.z - a.z*b.y, a.z*b.x - a.x*b.z, a.x*b.y - a.y*b.x}
+}
+
+//NormalizeVector returns a scaled to length one.
+func NormalizeVector(a Vector3) Vector3 {
+	return ScaleVector(a, 1.0/math.Sqrt(DotProduct(a, a)))
+}
+
+//GetDirection returns the unit vector at the given azimuth around the z axis and elevation above the x-y plane, in degrees.
+func GetDirection(azimuth, elevation float64) Vector3 {
+
+	a := azimuth * math.Pi / 180.0
+	e := elevation * math.Pi / 180.0
+
+	return Vector3{math.Cos(e) * math.Cos(a), math.Cos(e) * math.Sin(a), math.Sin(e)}
+}
+
+//GetCamera sets up the camera of renderConfig for a matrix, turned by azimuth degrees around the z axis.
+func GetCamera(matrix Matrix, renderConfig RenderConfig, azimuth float64) Camera {
+
+	var camera Camera
+
+	numRows := float64(GetNumRows(matrix))
+	numCols := float64(GetNumCols(matrix))
+	numAisles := float64(GetNumAisles(matrix))
+
+	camera.width = renderConfig.Width
+	camera.height = renderConfig.Height
+	camera.center = Vector3{numRows / 2, numCols / 2, numAisles / 2}
+
+	//the camera looks from direction toward the center, with the z axis up
+	direction := GetDirection(azimuth, renderConfig.Elevation)
+	camera.forward = ScaleVector(direction, -1.0)
+
+	worldUp := Vector3{0, 0, 1}
+	if math.Abs(DotProduct(worldUp, direction)) > 0.999 {
+		worldUp = Vector3{0, 1, 0}
+	}
+	camera.right = NormalizeVector(CrossProduct(camera.forward, worldUp))
+	camera.up = CrossProduct(camera.right, camera.forward)
+
+	//the diagonal of the lattice fills the smaller side of the frame at zoom 1
+	diagonal := math.Sqrt(numRows*numRows + numCols*numCols + numAisles*numAisles)
+	size := math.Min(float64(renderConfig.Width), float64(renderConfig.Height))
+
+	if renderConfig.Projection == "orthographic" {
+		camera.scale = renderConfig.Zoom * size / diagonal
+	} else if renderConfig.Projection == "perspective" {
+		camera.perspective = true
+		camera.eye = AddVectors(camera.center, ScaleVector(direction, renderConfig.Distance*diagonal))
+		camera.scale = renderConfig.Zoom * float64(renderConfig.Height) / 2 / math.Tan(renderConfig.FieldOfView*math.Pi/360.0)
+	} else {
+		panic("Projection has to be orthographic or perspective")
+	}
+
+	return camera
+}
+
+//ProjectPoint returns the pixel coordinates of a point and its depth along the view direction (larger is further).
+func ProjectPoint(camera Camera, p Vector3) (float64, float64, float64) {
+
+	if camera.perspective == true {
+		relative := SubtractVectors(p, camera.eye)
+		depth := DotProduct(relative, camera.forward)
+
+		sx := float64(camera.width)/2 + camera.scale*DotProduct(relative, camera.right)/depth
+		sy := float64(camera.height)/2 - camera.scale*DotProduct(relative, camera.up)/depth
+
+		return sx, sy, depth
+	}
+
+	relative := SubtractVectors(p, camera.center)
+
+	sx := float64(camera.width)/2 + camera.scale*DotProduct(relative, camera.right)
+	sy := float64(camera.height)/2 - camera.scale*DotProduct(relative, camera.up)
+
+	return sx, sy, DotProduct(relative, camera.forward)
+}
+
+//ParseHexColor reads a color written as "#RRGGBB".
+func ParseHexColor(hex string) color.RGBA {
+
+	var r, g, b uint8
+
+	_, err := fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b)
+	if err != nil {
+		panic("Color has to be written as #RRGGBB, got " + hex)
+	}
+
+	return color.RGBA{r, g, b, 255}
+}
+
+//IsDrawn3D returns true if the site i,j,k is drawn: its state has a color and it is not hidden by a cutaway.
+func IsDrawn3D(matrix Matrix, i, j, k int, renderConfig RenderConfig) bool {
+
+	if i < 0 || i >= GetNumRows(matrix) || j < 0 || j >= GetNumCols(matrix) || k < 0 || k >= GetNumAisles(matrix) {
+		return false
+	}
+
+	if renderConfig.Colors[matrix[i][j][k].state] == "" {
+		return false
+	}
+
+	center := Vector3{float64(GetNumRows(matrix)) / 2, float64(GetNumCols(matrix)) / 2, float64(GetNumAisles(matrix)) / 2}
+	site := Vector3{float64(i) + 0.5, float64(j) + 0.5, float64(k) + 0.5}
+
+	for _, cutaway := range renderConfig.Cutaways {
+		normal := Vector3{cutaway.Normal[0], cutaway.Normal[1], cutaway.Normal[2]}
+		if DotProduct(normal, SubtractVectors(site, center)) > cutaway.Offset {
+			return false
+		}
+	}
+
+	return true
+}
+
+//RenderMatrix3D draws the sites of a matrix as shaded cubes seen by the camera of renderConfig turned by azimuth degrees.
+//Only the faces between a drawn site and one that is not drawn can be seen, so only those are drawn, with a depth buffer.
+func RenderMatrix3D(matrix Matrix, renderConfig RenderConfig, azimuth float64) image.Image {
+
+	camera := GetCamera(matrix, renderConfig, azimuth)
+
+	img := image.NewRGBA(image.Rect(0, 0, renderConfig.Width, renderConfig.Height))
+
+	draw.Draw(img, img.Bounds(), &image.Uniform{ParseHexColor(renderConfig.Background)}, image.Point{}, draw.Src)
+
+	depthBuffer := make([]float64, renderConfig.Width*renderConfig.Height)
+	for i := range depthBuffer {
+		depthBuffer[i] = math.Inf(1)
+	}
+
+	colors := make(map[string]color.RGBA)
+	for state, hex := range renderConfig.Colors {
+		if hex != "" {
+			colors[state] = ParseHexColor(hex)
+		}
+	}
+
+	light := GetDirection(renderConfig.LightAzimuth, renderConfig.LightElevation)
+
+	//the six faces of a cube: their normal, and the two axes spanning them
+	normals := []Vector3{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+	spans := [][2]Vector3{{{0, 1, 0}, {0, 0, 1}}, {{0, 1, 0}, {0, 0, 1}}, {{1, 0, 0}, {0, 0, 1}}, {{1, 0, 0}, {0, 0, 1}}, {{1, 0, 0}, {0, 1, 0}}, {{1, 0, 0}, {0, 1, 0}}}
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			for k := range matrix[i][j] {
+
+				if IsDrawn3D(matrix, i, j, k, renderConfig) == false {
+					continue
+				}
+
+				siteCenter := Vector3{float64(i) + 0.5, float64(j) + 0.5, float64(k) + 0.5}
+				baseColor := colors[matrix[i][j][k].state]
+
+				for f, normal := range normals {
+
+					//hidden by the neighbor
+					if IsDrawn3D(matrix, i+int(normal.x), j+int(normal.y), k+int(normal.z), renderConfig) == true {
+						continue
+					}
+
+					faceCenter := AddVectors(siteCenter, ScaleVector(normal, 0.5))
+
+					//facing away from the camera
+					toCamera := ScaleVector(camera.forward, -1.0)
+					if camera.perspective == true {
+						toCamera = SubtractVectors(camera.eye, faceCenter)
+					}
+					if DotProduct(normal, toCamera) <= 0 {
+						continue
+					}
+
+					//Lambert shading
+					shade := renderConfig.Ambient + (1-renderConfig.Ambient)*math.Max(0, DotProduct(normal, light))
+					faceColor := color.RGBA{uint8(float64(baseColor.R) * shade), uint8(float64(baseColor.G) * shade), uint8(float64(baseColor.B) * shade), 255}
+
+					u := ScaleVector(spans[f][0], 0.5)
+					v := ScaleVector(spans[f][1], 0.5)
+					corners := []Vector3{
+						SubtractVectors(SubtractVectors(faceCenter, u), v),
+						SubtractVectors(AddVectors(faceCenter, u), v),
+						AddVectors(AddVectors(faceCenter, u), v),
+						AddVectors(SubtractVectors(faceCenter, u), v),
+					}
+
+					projected := make([]Vector3, 4)
+					for c := range corners {
+						sx, sy, depth := ProjectPoint(camera, corners[c])
+						projected[c] = Vector3{sx, sy, depth}
+					}
+
+					FillTriangle(img, depthBuffer, projected[0], projected[1], projected[2], faceColor)
+					FillTriangle(img, depthBuffer, projected[0], projected[2], projected[3], faceColor)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+//FillTriangle fills the triangle with corners a, b, c (pixel x, pixel y, depth) where it is nearer than the depth buffer.
+func FillTriangle(img *image.RGBA, depthBuffer []float64, a, b, c Vector3, col color.RGBA) {
+
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+
+	area := (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+	if area == 0 {
+		return
+	}
+
+	minX := int(math.Max(0, math.Floor(math.Min(a.x, math.Min(b.x, c.x)))))
+	maxX := int(math.Min(float64(width-1), math.Ceil(math.Max(a.x, math.Max(b.x, c.x)))))
+	minY := int(math.Max(0, math.Floor(math.Min(a.y, math.Min(b.y, c.y)))))
+	maxY := int(math.Min(float64(height-1), math.Ceil(math.Max(a.y, math.Max(b.y, c.y)))))
+
+	for py := minY; py <= maxY; py++ {
+		for px := minX; px <= maxX; px++ {
+
+			//barycentric coordinates of the pixel center
+			x := float64(px) + 0.5
+			y := float64(py) + 0.5
+
+			wa := ((b.x-x)*(c.y-y) - (b.y-y)*(c.x-x)) / area
+			wb := ((c.x-x)*(a.y-y) - (c.y-y)*(a.x-x)) / area
+			wc := 1 - wa - wb
+
+			if wa < 0 || wb < 0 || wc < 0 {
+				continue
+			}
+
+			depth := wa*a.z + wb*b.z + wc*c.z
+			if depth < depthBuffer[py*width+px] {
+				depthBuffer[py*width+px] = depth
+				img.SetRGBA(px, py, col)
+			}
+		}
+	}
+}
+
+//DrawMatrices3D is the 3D version of DrawMatrices, rendering every matrix with renderConfig.
+func DrawMatrices3D(matrices []Matrix, renderConfig RenderConfig) []image.Image {
+
+	imageList := make([]image.Image, len(matrices))
+
+	for i := range matrices {
+		fmt.Println("Rendering " + strconv.Itoa(i) + "th matrix")
+		imageList[i] = RenderMatrix3D(matrices[i], renderConfig, renderConfig.Azimuth)
+	}
+
+	return imageList
+}
+
+//RenderRotation3D renders a full turn of the camera around a matrix in RotationFrames frames.
+func RenderRotation3D(matrix Matrix, renderConfig RenderConfig) []image.Image {
+
+	imageList := make([]image.Image, renderConfig.RotationFrames)
+
+	for i := range imageList {
+		azimuth := renderConfig.Azimuth + 360.0*float64(i)/float64(renderConfig.RotationFrames)
+		imageList[i] = RenderMatrix3D(matrix, renderConfig, azimuth)
+	}
+
+	return imageList
+}
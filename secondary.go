@@ -0,0 +1,168 @@
+package main
+
+//SecondaryConfig holds the settings of secondary-site simulations. When enabled, each successful extravasation spawns a
+//simulation of its own, seeded with the arriving cells and run alongside the primary tumour.
+type SecondaryConfig struct {
+
+	//Enabled turns secondary-site simulations on
+	Enabled bool `json:"enabled"`
+
+	//Size is the number of rows and columns of each secondary lattice
+	Size int `json:"size"`
+
+	//MaxSites caps the number of secondary simulations. Later arrivals are still counted but not simulated.
+	MaxSites int `json:"maxSites"`
+
+	//Organs holds the settings of the secondary sites in each organ, keyed by organ name. Organs not listed behave like the primary site.
+	Organs map[string]OrganSiteConfig `json:"organs"`
+}
+
+//OrganSiteConfig holds the coupling constants and microenvironment of secondary sites in one organ.
+//Settings left out are taken from the primary site.
+type OrganSiteConfig struct {
+	Kcc *float64 `json:"Kcc"`
+	Knn *float64 `json:"Knn"`
+	Knc *float64 `json:"Knc"`
+
+	ECM       *ECMConfig       `json:"ecm"`
+	Chemicals []ChemicalConfig `json:"chemicals"`
+	Taxis     []TaxisConfig    `json:"taxis"`
+}
+
+//SecondarySite is a running simulation of a metastatic tumour.
+type SecondarySite struct {
+
+	//organ the cells arrived in and the generation of the primary simulation they arrived at
+	organ string
+	start int
+
+	//coupling constants and settings of the site
+	Kcc, Knn, Knc float64
+	config        Config
+
+	//current lattice of the site
+	matrix Matrix2D
+
+	//tumour burden of the site, burden[g] being at generation start+g of the primary simulation
+	burden []int
+}
+
+//DefaultSecondaryConfig returns disabled secondary sites of 101x101 sites, at most 10 of them.
+func DefaultSecondaryConfig() SecondaryConfig {
+
+	var secondaryConfig SecondaryConfig
+
+	secondaryConfig.Enabled = false
+	secondaryConfig.Size = 101
+	secondaryConfig.MaxSites = 10
+
+	return secondaryConfig
+}
+
+//SpawnSecondarySite2D starts the simulation of a secondary site for an event in which cells survived and reached an organ.
+//Kcc, Knn, Knc and config are those of the primary site, overridden by the settings of the organ.
+func SpawnSecondarySite2D(event MetastasisEvent, Kcc, Knn, Knc float64, config Config) SecondarySite {
+
+	var site SecondarySite
+
+	site.organ = event.organ
+	site.start = event.generation
+
+	site.Kcc = Kcc
+	site.Knn = Knn
+	site.Knc = Knc
+
+	site.config = config
+	site.config.Seeds = nil
+
+	organConfig := config.Metastasis.Secondary.Organs[event.organ]
+
+	if organConfig.Kcc != nil {
+		site.Kcc = *organConfig.Kcc
+	}
+	if organConfig.Knn != nil {
+		site.Knn = *organConfig.Knn
+	}
+	if organConfig.Knc != nil {
+		site.Knc = *organConfig.Knc
+	}
+	if organConfig.ECM != nil {
+		site.config.ECM = *organConfig.ECM
+	}
+	if organConfig.Chemicals != nil {
+		site.config.Chemicals = organConfig.Chemicals
+		site.config.Taxis = organConfig.Taxis
+	}
+
+	size := config.Metastasis.Secondary.Size
+
+	site.matrix = Initialize2DMatrix(size, size)
+	site.matrix = SeedArrivingCells2D(site.matrix, event.clusterSize, event.clone)
+	site.matrix = SeedMicroenvironment2D(site.matrix, site.config)
+
+	if site.config.Cycle.Enabled == true {
+		site.matrix = SeedCellCycle2D(site.matrix, site.config.Cycle)
+	}
+
+	site.burden = []int{GetTumourBurden2D(site.matrix)}
+
+	return site
+}
+
+//SeedArrivingCells2D places numCells cancerous cells of the given clone as a compact cluster at the center of the matrix,
+//filling the sites closest to the center first.
+func SeedArrivingCells2D(matrix Matrix2D, numCells int, clone int) Matrix2D {
+
+	centerCell := GetCentralCell2D(matrix)
+	center := centerCell.location
+
+	//breadth-first over the lattice from the center
+	queue := []OrderedPair{center}
+	visited := map[OrderedPair]bool{center: true}
+
+	for placed := 0; placed < numCells && len(queue) > 0; placed++ {
+
+		site := queue[0]
+		queue = queue[1:]
+
+		matrix[site.x][site.y].state = "C"
+		matrix[site.x][site.y].clone = clone
+
+		nextSites := []OrderedPair{{site.x - 1, site.y}, {site.x + 1, site.y}, {site.x, site.y - 1}, {site.x, site.y + 1}}
+		for _, next := range nextSites {
+			if visited[next] == false && InField2D(next.x, next.y, GetNumRows2D(matrix), GetNumCols2D(matrix)) == true {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return matrix
+}
+
+//UpdateSecondarySites2D advances every secondary site by one generation and records its burden.
+func UpdateSecondarySites2D(sites []SecondarySite) []SecondarySite {
+
+	for s := range sites {
+		sites[s].matrix = Update2DMatrix(sites[s].matrix, sites[s].Kcc, sites[s].Knn, sites[s].Knc, sites[s].config)
+		sites[s].burden = append(sites[s].burden, GetTumourBurden2D(sites[s].matrix))
+	}
+
+	return sites
+}
+
+//GetTumourBurden2D returns the number of living cancer cells (proliferative and quiescent) in a matrix.
+func GetTumourBurden2D(matrix Matrix2D) int {
+
+	burden := 0
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			if matrix[i][j].state == "C" || matrix[i][j].state == "Q" {
+				burden++
+			}
+		}
+	}
+
+	return burden
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+)
+
+//SliceConfig holds the settings of the 2D views of 3D runs: orthogonal slices, slice sweeps and projections.
+//They are drawn as DrawMatrix2D does, with the palette.
+//The axes are "axial" (a plane of constant z, rows x and columns y), "coronal" (constant y, rows z from the top, columns x)
+//and "sagittal" (constant x, rows z from the top, columns y).
+type SliceConfig struct {
+
+	//Enabled turns the slice views on
+	Enabled bool `json:"enabled"`
+
+	//CellWidth is the size of a site in pixels
+	CellWidth int `json:"cellWidth"`
+
+	//Views are the slices drawn at every generation, each as an animation "slice_<axis>_<index>"
+	Views []SliceView `json:"views"`
+
+	//Sweeps are the axes along which the last generation is swept, one slice per frame ("sweep_<axis>")
+	Sweeps []string `json:"sweeps"`
+
+	//Projections of the last generation along each axis of ProjectionAxes, for each state of ProjectionStates,
+	//written as PNGs to "projections3D": "max" marks the columns holding the state, "mean" shades them by its fraction
+	Projections      []string `json:"projections"`
+	ProjectionAxes   []string `json:"projectionAxes"`
+	ProjectionStates []string `json:"projectionStates"`
+}
+
+//SliceView is one slice: an axis and the index of the plane along it. An index of -1 is the center of the lattice.
+type SliceView struct {
+	Axis  string `json:"axis"`
+	Index int    `json:"index"`
+}
+
+//DefaultSliceConfig returns disabled slice views of the three central planes, and max and mean projections of each tumour state.
+func DefaultSliceConfig() SliceConfig {
+
+	var sliceConfig SliceConfig
+
+	sliceConfig.Enabled = false
+	sliceConfig.CellWidth = 3
+	sliceConfig.Views = []SliceView{{"axial", -1}, {"coronal", -1}, {"sagittal", -1}}
+	sliceConfig.Sweeps = []string{"axial"}
+	sliceConfig.Projections = []string{"max", "mean"}
+	sliceConfig.ProjectionAxes = []string{"axial"}
+	sliceConfig.ProjectionStates = []string{"C", "Q", "N", "wN"}
+
+	return sliceConfig
+}
+
+//GetAxisLength returns the number of planes of a matrix along an axis.
+func GetAxisLength(matrix Matrix, axis string) int {
+
+	if axis == "axial" {
+		return GetNumAisles(matrix)
+	} else if axis == "coronal" {
+		return GetNumCols(matrix)
+	} else if axis == "sagittal" {
+		return GetNumRows(matrix)
+	}
+
+	panic("Slice axis has to be axial, coronal or sagittal")
+}
+
+//GetSliceSite returns the site of a matrix at row r and column c of the plane index along axis.
+func GetSliceSite(matrix Matrix, axis string, index, r, c int) Cell {
+
+	numAisles := GetNumAisles(matrix)
+
+	if axis == "axial" {
+		return matrix[r][c][index]
+	} else if axis == "coronal" {
+		return matrix[c][index][numAisles-1-r]
+	}
+	return matrix[index][c][numAisles-1-r]
+}
+
+//GetSliceShape returns the number of rows and columns of the planes along axis.
+func GetSliceShape(matrix Matrix, axis string) (int, int) {
+
+	if axis == "axial" {
+		return GetNumRows(matrix), GetNumCols(matrix)
+	} else if axis == "coronal" {
+		return GetNumAisles(matrix), GetNumRows(matrix)
+	} else if axis == "sagittal" {
+		return GetNumAisles(matrix), GetNumCols(matrix)
+	}
+
+	panic("Slice axis has to be axial, coronal or sagittal")
+}
+
+//GetSlice3D returns the plane index along axis of a 3D matrix as a Matrix2D. An index of -1 is the central plane.
+func GetSlice3D(matrix Matrix, axis string, index int) Matrix2D {
+
+	if index == -1 {
+		index = GetAxisLength(matrix, axis) / 2
+	}
+
+	numRows, numCols := GetSliceShape(matrix, axis)
+
+	slice := Initialize2DMatrix(numRows, numCols)
+
+	for r := range slice {
+		for c := range slice[r] {
+			site := GetSliceSite(matrix, axis, index, r, c)
+			slice[r][c].state = site.state
+			slice[r][c].clone = site.clone
+		}
+	}
+
+	return slice
+}
+
+//DrawSlices3D draws the same slice of every matrix.
+func DrawSlices3D(matrices []Matrix, view SliceView, cellWidth int, paletteConfig PaletteConfig) []image.Image {
+
+	imageList := make([]image.Image, len(matrices))
+
+	for i := range matrices {
+		slice := GetSlice3D(matrices[i], view.Axis, view.Index)
+		imageList[i] = DrawMatrix2D(slice, cellWidth, GetNumRows2D(slice), GetNumCols2D(slice), paletteConfig)
+	}
+
+	return imageList
+}
+
+//DrawSweep3D draws every slice of a matrix along axis, in order.
+func DrawSweep3D(matrix Matrix, axis string, cellWidth int, paletteConfig PaletteConfig) []image.Image {
+
+	imageList := make([]image.Image, GetAxisLength(matrix, axis))
+
+	for index := range imageList {
+		slice := GetSlice3D(matrix, axis, index)
+		imageList[index] = DrawMatrix2D(slice, cellWidth, GetNumRows2D(slice), GetNumCols2D(slice), paletteConfig)
+	}
+
+	return imageList
+}
+
+//ProjectState3D projects a state of a matrix along axis. "max" gives 1 for the columns holding the state and 0 elsewhere,
+//"mean" the fraction of the column in the state, rescaled so that the fullest column is 1.
+func ProjectState3D(matrix Matrix, axis, state, mode string) [][]float64 {
+
+	numRows, numCols := GetSliceShape(matrix, axis)
+	length := GetAxisLength(matrix, axis)
+
+	projection := make([][]float64, numRows)
+	highest := 0.0
+
+	for r := range projection {
+		projection[r] = make([]float64, numCols)
+
+		for c := range projection[r] {
+			count := 0
+			for index := 0; index < length; index++ {
+				if GetSliceSite(matrix, axis, index, r, c).state == state {
+					count++
+				}
+			}
+
+			if mode == "max" {
+				if count > 0 {
+					projection[r][c] = 1.0
+				}
+			} else if mode == "mean" {
+				projection[r][c] = float64(count) / float64(length)
+			} else {
+				panic("Projection has to be max or mean")
+			}
+
+			if projection[r][c] > highest {
+				highest = projection[r][c]
+			}
+		}
+	}
+
+	if highest > 0 {
+		for r := range projection {
+			for c := range projection[r] {
+				projection[r][c] /= highest
+			}
+		}
+	}
+
+	return projection
+}
+
+//DrawProjection2D draws a projection of a state, shading from white (0) to the 2D color of the state in the palette (1).
+func DrawProjection2D(projection [][]float64, state string, cellWidth int, paletteConfig PaletteConfig) image.Image {
+
+	height := len(projection) * cellWidth
+	width := len(projection[0]) * cellWidth
+	c := CreateNewCanvas(width, height)
+
+	stateColor := color.RGBAModel.Convert(GetPaletteStateColor2D(paletteConfig, state)).(color.RGBA)
+
+	for i := range projection {
+		for j := range projection[i] {
+			value := projection[i][j]
+
+			r := uint8(255 - value*(255-float64(stateColor.R)))
+			g := uint8(255 - value*(255-float64(stateColor.G)))
+			b := uint8(255 - value*(255-float64(stateColor.B)))
+
+			c.SetFillColor(MakeColor(r, g, b))
+			x := j * cellWidth
+			y := i * cellWidth
+			c.ClearRect(x, y, x+cellWidth, y+cellWidth)
+			c.Fill()
+		}
+	}
+
+	return c.img
+}
+
+//OutputSlices3D writes the slice views, sweeps and projections of sliceConfig for a 3D run. Animations are written as in options.
+//The overlays, if enabled, are drawn into the slice views, with the populations of the whole lattice. The first error met is returned.
+func OutputSlices3D(timepoints []Matrix, sliceConfig SliceConfig, overlayConfig OverlayConfig, paletteConfig PaletteConfig, options Options) error {
+
+	last := timepoints[len(timepoints)-1]
+
+	var populations [][]int
+	if overlayConfig.Enabled == true && len(sliceConfig.Views) > 0 {
+		populations = GetPopulations3D(timepoints, overlayConfig)
+	}
+
+	for _, view := range sliceConfig.Views {
+		fmt.Println("Drawing " + view.Axis + " slice " + strconv.Itoa(view.Index))
+		imglist := DrawSlices3D(timepoints, view, sliceConfig.CellWidth, paletteConfig)
+
+		if overlayConfig.Enabled == true {
+			states := append(append([]string{}, overlayConfig.LegendStates...), overlayConfig.ChartStates...)
+			imglist = OverlayFrames(imglist, populations, GetStateColors2D(states, paletteConfig), float64(sliceConfig.CellWidth), overlayConfig)
+		}
+
+		err := WriteAnimation(imglist, "slice_"+view.Axis+"_"+strconv.Itoa(view.Index), options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, axis := range sliceConfig.Sweeps {
+		fmt.Println("Drawing " + axis + " sweep")
+		err := WriteAnimation(DrawSweep3D(last, axis, sliceConfig.CellWidth, paletteConfig), "sweep_"+axis, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(sliceConfig.Projections) == 0 {
+		return nil
+	}
+
+	outputFolder := GetNewFolderDir("projections3D")
+	err := MakeDirIfNotExist(outputFolder)
+	if err != nil {
+		return err
+	}
+	RefreshDirectoryOf(outputFolder, ".png")
+
+	for _, mode := range sliceConfig.Projections {
+		for _, axis := range sliceConfig.ProjectionAxes {
+			for _, state := range sliceConfig.ProjectionStates {
+				projection := ProjectState3D(last, axis, state, mode)
+				img := DrawProjection2D(projection, state, sliceConfig.CellWidth, paletteConfig)
+				err := SavePNG(img, outputFolder+"/"+mode+"_"+axis+"_"+state+".png")
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+//SavePNG writes an image to a PNG file, returning the first error met.
+func SavePNG(img image.Image, filename string) error {
+
+	pngFile, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(pngFile, img)
+	if errClose := pngFile.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + filename + ": " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+)
+
+//SnapshotMagic starts every snapshot file, and SnapshotVersion is the version of the format written.
+const SnapshotMagic = "LGCASNAP"
+const SnapshotVersion = 1
+
+//CheckpointConfig holds the settings of the snapshots written during runs, to resume them later with "resume".
+type CheckpointConfig struct {
+
+	//Every is the number of generations between snapshots; 0 writes none
+	Every int `json:"every"`
+}
+
+//DefaultCheckpointConfig returns no checkpoints.
+func DefaultCheckpointConfig() CheckpointConfig {
+
+	var checkpointConfig CheckpointConfig
+
+	checkpointConfig.Every = 0
+
+	return checkpointConfig
+}
+
+//Snapshot is everything needed to resume a run of the model at a generation: the lattice, the coupling constants,
+//the config and the state of the random number generator. Runs with metastasis keep more state and cannot be resumed.
+//
+//The file holds a header and a payload, each followed by its CRC-32. All numbers are little endian.
+//The header is SnapshotMagic, the version (uint16), the dimension (uint8), the generation (uint32), the numbers of rows,
+//columns and aisles (uint32), Kcc, Knn and Knc (float64), the seed (int64), the generator state (4 uint64) and the config
+//as JSON behind its length (uint32). The payload is zlib-compressed behind its compressed length (uint64) and holds the
+//fields of the sites as columns, in the order of the sites row by row: strings run-length encoded against a table of
+//their distinct values, integers as int32 and decimals as float64.
+type Snapshot struct {
+	dimension  int
+	generation int
+
+	Kcc, Knn, Knc float64
+
+	seed        int64
+	randomState [4]uint64
+
+	config Config
+
+	matrix2D Matrix2D
+	matrix3D Matrix
+}
+
+//SnapshotEncoder writes the columns of a snapshot payload.
+type SnapshotEncoder struct {
+	buffer bytes.Buffer
+}
+
+//SnapshotDecoder reads the columns of a snapshot payload. The first error stops all further reading and is kept in err.
+type SnapshotDecoder struct {
+	reader *bytes.Reader
+	err    error
+}
+
+//WriteStrings writes a column of strings as a table of the distinct values and runs of equal values.
+func (e *SnapshotEncoder) WriteStrings(values []string) {
+
+	table := make([]string, 0)
+	indices := make(map[string]int)
+	for _, value := range values {
+		if _, ok := indices[value]; ok == false {
+			indices[value] = len(table)
+			table = append(table, value)
+		}
+	}
+
+	binary.Write(&e.buffer, binary.LittleEndian, uint32(len(table)))
+	for _, value := range table {
+		binary.Write(&e.buffer, binary.LittleEndian, uint32(len(value)))
+		e.buffer.WriteString(value)
+	}
+
+	//runs of an index and a length
+	runs := make([]uint32, 0)
+	for v := 0; v < len(values); {
+		length := 1
+		for v+length < len(values) && values[v+length] == values[v] {
+			length++
+		}
+		runs = append(runs, uint32(indices[values[v]]), uint32(length))
+		v += length
+	}
+
+	binary.Write(&e.buffer, binary.LittleEndian, uint32(len(runs)/2))
+	binary.Write(&e.buffer, binary.LittleEndian, runs)
+}
+
+//WriteInts writes a column of integers.
+func (e *SnapshotEncoder) WriteInts(values []int) {
+
+	column := make([]int32, len(values))
+	for v := range values {
+		column[v] = int32(values[v])
+	}
+
+	binary.Write(&e.buffer, binary.LittleEndian, column)
+}
+
+//WriteFloats writes a column of decimals, bit for bit.
+func (e *SnapshotEncoder) WriteFloats(values []float64) {
+	binary.Write(&e.buffer, binary.LittleEndian, values)
+}
+
+//Read fills data from the payload, unless an earlier read failed.
+func (d *SnapshotDecoder) Read(data interface{}) {
+
+	if d.err != nil {
+		return
+	}
+
+	d.err = binary.Read(d.reader, binary.LittleEndian, data)
+}
+
+//ReadStrings reads a column of n strings written by WriteStrings.
+func (d *SnapshotDecoder) ReadStrings(n int) []string {
+
+	var tableLength uint32
+	d.Read(&tableLength)
+
+	table := make([]string, 0)
+	for t := 0; t < int(tableLength) && d.err == nil; t++ {
+		var length uint32
+		d.Read(&length)
+		if d.err == nil && int(length) > d.reader.Len() {
+			d.err = errors.New("string longer than the payload")
+		}
+		if d.err != nil {
+			break
+		}
+		value := make([]byte, length)
+		d.Read(value)
+		table = append(table, string(value))
+	}
+
+	var numRuns uint32
+	d.Read(&numRuns)
+	if d.err == nil && int(numRuns)*8 > d.reader.Len() {
+		d.err = errors.New("more runs than the payload holds")
+	}
+	if d.err != nil {
+		return make([]string, n)
+	}
+
+	runs := make([]uint32, 2*numRuns)
+	d.Read(runs)
+
+	values := make([]string, 0, n)
+	for r := 0; r+1 < len(runs) && d.err == nil; r += 2 {
+		if int(runs[r]) >= len(table) || len(values)+int(runs[r+1]) > n {
+			d.err = errors.New("run out of range")
+			break
+		}
+		for l := 0; l < int(runs[r+1]); l++ {
+			values = append(values, table[runs[r]])
+		}
+	}
+
+	if d.err == nil && len(values) != n {
+		d.err = errors.New("runs do not cover every site")
+	}
+	if d.err != nil {
+		return make([]string, n)
+	}
+
+	return values
+}
+
+//ReadInts reads a column of n integers.
+func (d *SnapshotDecoder) ReadInts(n int) []int {
+
+	column := make([]int32, n)
+	d.Read(column)
+
+	values := make([]int, n)
+	for v := range column {
+		values[v] = int(column[v])
+	}
+
+	return values
+}
+
+//ReadFloats reads a column of n decimals.
+func (d *SnapshotDecoder) ReadFloats(n int) []float64 {
+
+	values := make([]float64, n)
+	d.Read(values)
+
+	return values
+}
+
+//EncodeMatrix2D writes the sites of a 2D matrix to the payload, field by field.
+func EncodeMatrix2D(e *SnapshotEncoder, matrix Matrix2D) {
+
+	var states, phases []string
+	var locationX, locationY, velocityX, velocityY, ages, phaseAges, clones, numChemicals []int
+	var pNecrosis, pProliferation, pQuiescent, ecm, pressure, chemicals []float64
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			cell := matrix[i][j]
+
+			states = append(states, cell.state)
+			phases = append(phases, cell.phase)
+			locationX = append(locationX, cell.location.x)
+			locationY = append(locationY, cell.location.y)
+			velocityX = append(velocityX, cell.velocityDirection.x)
+			velocityY = append(velocityY, cell.velocityDirection.y)
+			ages = append(ages, cell.age)
+			phaseAges = append(phaseAges, cell.phaseAge)
+			clones = append(clones, cell.clone)
+			pNecrosis = append(pNecrosis, cell.pNecrosis)
+			pProliferation = append(pProliferation, cell.pProliferation)
+			pQuiescent = append(pQuiescent, cell.pQuiescent)
+			ecm = append(ecm, cell.ecm)
+			pressure = append(pressure, cell.pressure)
+
+			//-1 keeps apart sites without chemicals and sites with an empty list
+			if cell.chemicals == nil {
+				numChemicals = append(numChemicals, -1)
+			} else {
+				numChemicals = append(numChemicals, len(cell.chemicals))
+			}
+			chemicals = append(chemicals, cell.chemicals...)
+		}
+	}
+
+	e.WriteStrings(states)
+	e.WriteStrings(phases)
+	e.WriteInts(locationX)
+	e.WriteInts(locationY)
+	e.WriteInts(velocityX)
+	e.WriteInts(velocityY)
+	e.WriteInts(ages)
+	e.WriteInts(phaseAges)
+	e.WriteInts(clones)
+	e.WriteFloats(pNecrosis)
+	e.WriteFloats(pProliferation)
+	e.WriteFloats(pQuiescent)
+	e.WriteFloats(ecm)
+	e.WriteFloats(pressure)
+	e.WriteInts(numChemicals)
+	e.WriteInts([]int{len(chemicals)})
+	e.WriteFloats(chemicals)
+}
+
+//DecodeMatrix2D reads the sites of a numRows by numCols matrix written by EncodeMatrix2D.
+func DecodeMatrix2D(d *SnapshotDecoder, numRows, numCols int) Matrix2D {
+
+	n := numRows * numCols
+
+	states := d.ReadStrings(n)
+	phases := d.ReadStrings(n)
+	locationX := d.ReadInts(n)
+	locationY := d.ReadInts(n)
+	velocityX := d.ReadInts(n)
+	velocityY := d.ReadInts(n)
+	ages := d.ReadInts(n)
+	phaseAges := d.ReadInts(n)
+	clones := d.ReadInts(n)
+	pNecrosis := d.ReadFloats(n)
+	pProliferation := d.ReadFloats(n)
+	pQuiescent := d.ReadFloats(n)
+	ecm := d.ReadFloats(n)
+	pressure := d.ReadFloats(n)
+	numChemicals := d.ReadInts(n)
+
+	total := d.ReadInts(1)[0]
+	if d.err == nil && (total < 0 || total*8 > d.reader.Len()) {
+		d.err = errors.New("more chemical values than the payload holds")
+	}
+	if d.err != nil {
+		return nil
+	}
+	chemicals := d.ReadFloats(total)
+
+	matrix := Initialize2DMatrix(numRows, numCols)
+
+	s := 0
+	c := 0
+	for i := range matrix {
+		for j := range matrix[i] {
+			cell := &matrix[i][j]
+
+			cell.state = states[s]
+			cell.phase = phases[s]
+			cell.location = OrderedPair{locationX[s], locationY[s]}
+			cell.velocityDirection = OrderedPair{velocityX[s], velocityY[s]}
+			cell.age = ages[s]
+			cell.phaseAge = phaseAges[s]
+			cell.clone = clones[s]
+			cell.pNecrosis = pNecrosis[s]
+			cell.pProliferation = pProliferation[s]
+			cell.pQuiescent = pQuiescent[s]
+			cell.ecm = ecm[s]
+			cell.pressure = pressure[s]
+
+			if numChemicals[s] >= 0 {
+				if c+numChemicals[s] > len(chemicals) {
+					d.err = errors.New("chemical values do not match the sites")
+					return nil
+				}
+				cell.chemicals = append([]float64{}, chemicals[c:c+numChemicals[s]]...)
+				c += numChemicals[s]
+			}
+
+			s++
+		}
+	}
+
+	return matrix
+}
+
+//EncodeMatrix3D writes the sites of a 3D matrix to the payload, field by field.
+func EncodeMatrix3D(e *SnapshotEncoder, matrix Matrix) {
+
+	var states []string
+	var locationX, locationY, locationZ, velocityX, velocityY, velocityZ, clones []int
+	var pNecrosis, pProliferation, pQuiescent []float64
+
+	for i := range matrix {
+		for j := range matrix[i] {
+			for k := range matrix[i][j] {
+				cell := matrix[i][j][k]
+
+				states = append(states, cell.state)
+				locationX = append(locationX, cell.location.x)
+				locationY = append(locationY, cell.location.y)
+				locationZ = append(locationZ, cell.location.z)
+				velocityX = append(velocityX, cell.velocityDirection.x)
+				velocityY = append(velocityY, cell.velocityDirection.y)
+				velocityZ = append(velocityZ, cell.velocityDirection.z)
+				clones = append(clones, cell.clone)
+				pNecrosis = append(pNecrosis, cell.pNecrosis)
+				pProliferation = append(pProliferation, cell.pProliferation)
+				pQuiescent = append(pQuiescent, cell.pQuiescent)
+			}
+		}
+	}
+
+	e.WriteStrings(states)
+	e.WriteInts(locationX)
+	e.WriteInts(locationY)
+	e.WriteInts(locationZ)
+	e.WriteInts(velocityX)
+	e.WriteInts(velocityY)
+	e.WriteInts(velocityZ)
+	e.WriteInts(clones)
+	e.WriteFloats(pNecrosis)
+	e.WriteFloats(pProliferation)
+	e.WriteFloats(pQuiescent)
+}
+
+//DecodeMatrix3D reads the sites of a matrix written by EncodeMatrix3D.
+func DecodeMatrix3D(d *SnapshotDecoder, numRows, numCols, numAisles int) Matrix {
+
+	n := numRows * numCols * numAisles
+
+	states := d.ReadStrings(n)
+	locationX := d.ReadInts(n)
+	locationY := d.ReadInts(n)
+	locationZ := d.ReadInts(n)
+	velocityX := d.ReadInts(n)
+	velocityY := d.ReadInts(n)
+	velocityZ := d.ReadInts(n)
+	clones := d.ReadInts(n)
+	pNecrosis := d.ReadFloats(n)
+	pProliferation := d.ReadFloats(n)
+	pQuiescent := d.ReadFloats(n)
+
+	if d.err != nil {
+		return nil
+	}
+
+	matrix := Initialize3DMatrix(numRows, numCols, numAisles)
+
+	s := 0
+	for i := range matrix {
+		for j := range matrix[i] {
+			for k := range matrix[i][j] {
+				cell := &matrix[i][j][k]
+
+				cell.state = states[s]
+				cell.location = OrderedTrio{locationX[s], locationY[s], locationZ[s]}
+				cell.velocityDirection = OrderedTrio{velocityX[s], velocityY[s], velocityZ[s]}
+				cell.clone = clones[s]
+				cell.pNecrosis = pNecrosis[s]
+				cell.pProliferation = pProliferation[s]
+				cell.pQuiescent = pQuiescent[s]
+
+				s++
+			}
+		}
+	}
+
+	return matrix
+}
+
+//WriteSnapshot writes a snapshot to filename, returning the first error met.
+func WriteSnapshot(snapshot Snapshot, filename string) error {
+
+	configData, err := json.Marshal(snapshot.config)
+	if err != nil {
+		return errors.New("problem when writing the config to a snapshot: " + err.Error())
+	}
+
+	numRows, numCols, numAisles := 0, 0, 1
+
+	var payload SnapshotEncoder
+	if snapshot.dimension == 2 {
+		numRows, numCols = GetNumRows2D(snapshot.matrix2D), GetNumCols2D(snapshot.matrix2D)
+		EncodeMatrix2D(&payload, snapshot.matrix2D)
+	} else {
+		numRows, numCols, numAisles = GetNumRows(snapshot.matrix3D), GetNumCols(snapshot.matrix3D), GetNumAisles(snapshot.matrix3D)
+		EncodeMatrix3D(&payload, snapshot.matrix3D)
+	}
+
+	var header bytes.Buffer
+	header.WriteString(SnapshotMagic)
+	binary.Write(&header, binary.LittleEndian, uint16(SnapshotVersion))
+	binary.Write(&header, binary.LittleEndian, uint8(snapshot.dimension))
+	binary.Write(&header, binary.LittleEndian, uint32(snapshot.generation))
+	binary.Write(&header, binary.LittleEndian, [3]uint32{uint32(numRows), uint32(numCols), uint32(numAisles)})
+	binary.Write(&header, binary.LittleEndian, [3]float64{snapshot.Kcc, snapshot.Knn, snapshot.Knc})
+	binary.Write(&header, binary.LittleEndian, snapshot.seed)
+	binary.Write(&header, binary.LittleEndian, snapshot.randomState)
+	binary.Write(&header, binary.LittleEndian, uint32(len(configData)))
+	header.Write(configData)
+
+	var compressed bytes.Buffer
+	compressor := zlib.NewWriter(&compressed)
+	compressor.Write(payload.buffer.Bytes())
+	compressor.Close()
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	writer.Write(header.Bytes())
+	binary.Write(writer, binary.LittleEndian, crc32.ChecksumIEEE(header.Bytes()))
+	binary.Write(writer, binary.LittleEndian, uint64(compressed.Len()))
+	writer.Write(compressed.Bytes())
+	binary.Write(writer, binary.LittleEndian, crc32.ChecksumIEEE(compressed.Bytes()))
+
+	return CloseOutputFile(file, writer)
+}
+
+//ReadSnapshot reads a snapshot written by WriteSnapshot, stopping the program if the file is damaged or of another version.
+func ReadSnapshot(filename string) Snapshot {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	snapshot, err := DecodeSnapshot(data)
+	if err != nil {
+		log.Fatal("Problem when reading snapshot " + filename + ": " + err.Error())
+	}
+
+	return snapshot
+}
+
+//DecodeSnapshot reads a snapshot from the bytes of its file.
+func DecodeSnapshot(data []byte) (Snapshot, error) {
+
+	var snapshot Snapshot
+
+	reader := bytes.NewReader(data)
+
+	magic := make([]byte, len(SnapshotMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != SnapshotMagic {
+		return snapshot, errors.New("not a snapshot")
+	}
+
+	var version uint16
+	var dimension uint8
+	var generation uint32
+	var size [3]uint32
+	var constants [3]float64
+	var configLength uint32
+
+	header := &SnapshotDecoder{reader: reader}
+	header.Read(&version)
+	if header.err == nil && version != SnapshotVersion {
+		return snapshot, errors.New("snapshot version " + strconv.Itoa(int(version)) + " is not supported, expected " + strconv.Itoa(SnapshotVersion))
+	}
+	header.Read(&dimension)
+	header.Read(&generation)
+	header.Read(&size)
+	header.Read(&constants)
+	header.Read(&snapshot.seed)
+	header.Read(&snapshot.randomState)
+	header.Read(&configLength)
+	if header.err == nil && int(configLength) > reader.Len() {
+		return snapshot, errors.New("truncated header")
+	}
+	configData := make([]byte, configLength)
+	header.Read(configData)
+
+	headerLength := len(data) - reader.Len()
+
+	var headerChecksum uint32
+	header.Read(&headerChecksum)
+	if header.err != nil {
+		return snapshot, errors.New("truncated header")
+	}
+	if crc32.ChecksumIEEE(data[:headerLength]) != headerChecksum {
+		return snapshot, errors.New("header checksum does not match")
+	}
+
+	var compressedLength uint64
+	header.Read(&compressedLength)
+	if header.err != nil || compressedLength+4 > uint64(reader.Len()) {
+		return snapshot, errors.New("truncated payload")
+	}
+	compressed := make([]byte, compressedLength)
+	header.Read(compressed)
+
+	var payloadChecksum uint32
+	header.Read(&payloadChecksum)
+	if header.err != nil {
+		return snapshot, errors.New("truncated payload")
+	}
+	if crc32.ChecksumIEEE(compressed) != payloadChecksum {
+		return snapshot, errors.New("payload checksum does not match")
+	}
+
+	decompressor, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return snapshot, err
+	}
+	payload, err := ioutil.ReadAll(decompressor)
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.dimension = int(dimension)
+	snapshot.generation = int(generation)
+	snapshot.Kcc, snapshot.Knn, snapshot.Knc = constants[0], constants[1], constants[2]
+	snapshot.config = ParseConfig(configData, "of the snapshot")
+
+	decoder := &SnapshotDecoder{reader: bytes.NewReader(payload)}
+
+	if snapshot.dimension == 2 {
+		snapshot.matrix2D = DecodeMatrix2D(decoder, int(size[0]), int(size[1]))
+	} else if snapshot.dimension == 3 {
+		snapshot.matrix3D = DecodeMatrix3D(decoder, int(size[0]), int(size[1]), int(size[2]))
+	} else {
+		return snapshot, errors.New("dimension " + strconv.Itoa(snapshot.dimension) + " is not 2 or 3")
+	}
+
+	if decoder.err != nil {
+		return snapshot, errors.New("damaged payload: " + decoder.err.Error())
+	}
+
+	return snapshot, nil
+}
+
+//WriteCheckpoint writes a snapshot of a 2D (matrix3D nil) or 3D (matrix2D nil) run at a generation to "checkpoints",
+//if the config asks for one at that generation.
+func WriteCheckpoint(matrix2D Matrix2D, matrix3D Matrix, generation int, Kcc, Knn, Knc float64, config Config) error {
+
+	if config.Checkpoint.Every <= 0 || generation%config.Checkpoint.Every != 0 {
+		return nil
+	}
+
+	snapshot := Snapshot{generation: generation, Kcc: Kcc, Knn: Knn, Knc: Knc, config: config}
+	snapshot.seed = RandomSeed
+	snapshot.randomState = RandomState.state
+
+	if matrix3D == nil {
+		snapshot.dimension = 2
+		snapshot.matrix2D = matrix2D
+	} else {
+		snapshot.dimension = 3
+		snapshot.matrix3D = matrix3D
+	}
+
+	outputFolder := GetNewFolderDir("checkpoints")
+	err := MakeDirIfNotExist(outputFolder)
+	if err != nil {
+		return err
+	}
+
+	filename := outputFolder + "/snapshot_" + strconv.Itoa(generation) + ".bin"
+	fmt.Println("Writing checkpoint " + filename)
+	return WriteSnapshot(snapshot, filename)
+}
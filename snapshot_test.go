@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//SnapshotTestConfig turns on the settings whose fields are kept in the sites of a snapshot.
+const SnapshotTestConfig = `{"ecm":{"enabled":true,"pattern":"fibres","degradation":0.1,"resistance":0.5,"haptotaxis":0.5},
+ "chemicals":[{"name":"oxygen","initial":1,"diffusion":0.2,"decay":0.01,"uptake":{"C":0.05}}],
+ "cycle":{"enabled":true},
+ "mechanics":{"enabled":true}}`
+
+//WriteTestSnapshot writes snapshot to a temporary file and returns the bytes of the file.
+func WriteTestSnapshot(t *testing.T, snapshot Snapshot) []byte {
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "snapshot.bin")
+
+	err = WriteSnapshot(snapshot, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+//CheckSnapshotHeader fails t if the header fields of read differ from those of written.
+func CheckSnapshotHeader(t *testing.T, written, read Snapshot) {
+
+	if read.dimension != written.dimension || read.generation != written.generation {
+		t.Fatalf("read dimension %d generation %d, wrote %d and %d", read.dimension, read.generation, written.dimension, written.generation)
+	}
+	if read.Kcc != written.Kcc || read.Knn != written.Knn || read.Knc != written.Knc {
+		t.Fatalf("read coupling constants %g %g %g, wrote %g %g %g", read.Kcc, read.Knn, read.Knc, written.Kcc, written.Knn, written.Knc)
+	}
+	if read.seed != written.seed || read.randomState != written.randomState {
+		t.Fatal("the random numbers read differ from those written")
+	}
+
+	writtenConfig, _ := json.Marshal(written.config)
+	readConfig, _ := json.Marshal(read.config)
+	if string(readConfig) != string(writtenConfig) {
+		t.Fatalf("read config %s, wrote %s", readConfig, writtenConfig)
+	}
+}
+
+//GetTestSnapshot2D returns a snapshot of a small 2D run a few generations in, with a site without chemicals and one
+//with an empty list of them.
+func GetTestSnapshot2D() Snapshot {
+
+	SeedRandom(7)
+	config := ParseConfig([]byte(SnapshotTestConfig), "of the test")
+
+	matrix := InitialMatrix2D(21, 21, config)
+	for g := 0; g < 3; g++ {
+		matrix = Update2DMatrix(matrix, 3, 3, 1, config)
+	}
+	matrix[0][0].chemicals = nil
+	matrix[0][1].chemicals = []float64{}
+
+	return Snapshot{dimension: 2, generation: 3, Kcc: 3, Knn: 3, Knc: 1, seed: RandomSeed, randomState: RandomState.state, config: config, matrix2D: matrix}
+}
+
+//TestSnapshotRoundTrip2D checks that a 2D snapshot is read back as it was written, site for site.
+func TestSnapshotRoundTrip2D(t *testing.T) {
+
+	snapshot := GetTestSnapshot2D()
+
+	read, err := DecodeSnapshot(WriteTestSnapshot(t, snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CheckSnapshotHeader(t, snapshot, read)
+	if reflect.DeepEqual(read.matrix2D, snapshot.matrix2D) == false {
+		t.Fatal("the sites read differ from those written")
+	}
+}
+
+//TestSnapshotRoundTrip3D checks that a 3D snapshot is read back as it was written, site for site.
+func TestSnapshotRoundTrip3D(t *testing.T) {
+
+	SeedRandom(7)
+	config := ReadConfig("")
+
+	matrix := SeedMatrix3D(Initialize3DMatrix(11, 11, 11), config)
+	for g := 0; g < 2; g++ {
+		matrix = UpdateMatrix(matrix, 3, 3, 1)
+	}
+
+	snapshot := Snapshot{dimension: 3, generation: 2, Kcc: 3, Knn: 3, Knc: 1, seed: RandomSeed, randomState: RandomState.state, config: config, matrix3D: matrix}
+
+	read, err := DecodeSnapshot(WriteTestSnapshot(t, snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CheckSnapshotHeader(t, snapshot, read)
+	if reflect.DeepEqual(read.matrix3D, snapshot.matrix3D) == false {
+		t.Fatal("the sites read differ from those written")
+	}
+}
+
+//TestSnapshotDamaged checks that damaged and truncated snapshots are refused with the matching error.
+func TestSnapshotDamaged(t *testing.T) {
+
+	data := WriteTestSnapshot(t, GetTestSnapshot2D())
+
+	//a byte of Kcc, in the header, and the last byte of the compressed payload, before its checksum
+	kccOffset := len(SnapshotMagic) + 2 + 1 + 4 + 12
+
+	tests := []struct {
+		name  string
+		data  []byte
+		error string
+	}{
+		{"not a snapshot", []byte("PNG and other files"), "not a snapshot"},
+		{"damaged header", FlipByte(data, kccOffset), "header checksum"},
+		{"damaged payload", FlipByte(data, len(data)-5), "payload checksum"},
+		{"truncated header", data[:kccOffset], "truncated header"},
+		{"truncated payload", data[:len(data)-2], "truncated payload"},
+	}
+
+	for _, test := range tests {
+		_, err := DecodeSnapshot(test.data)
+		if err == nil {
+			t.Errorf("%s: read without error", test.name)
+		} else if strings.Contains(err.Error(), test.error) == false {
+			t.Errorf("%s: error %q, expected one about %q", test.name, err.Error(), test.error)
+		}
+	}
+}
+
+//FlipByte returns a copy of data with the bits of the byte at offset inverted.
+func FlipByte(data []byte, offset int) []byte {
+
+	damaged := append([]byte{}, data...)
+	damaged[offset] ^= 0xFF
+
+	return damaged
+}
+
+//ReadTestCheckpoint returns the checkpoint written at a generation to the run directory dir.
+func ReadTestCheckpoint(t *testing.T, dir string, generation int) Snapshot {
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "checkpoints", "snapshot_"+strconv.Itoa(generation)+".bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snapshot
+}
+
+//TestResumeBitExact2D checks that a 2D run resumed from a checkpoint ends on the same sites as the run going straight
+//through, i.e. that no random number is drawn between writing the checkpoint and going on from it.
+func TestResumeBitExact2D(t *testing.T) {
+
+	dir, restore := UseTestOutputDir(t)
+	defer restore()
+
+	config := ParseConfig([]byte(strings.Replace(SnapshotTestConfig, "{", `{"checkpoint":{"every":3},`, 1)), "of the test")
+
+	SeedRandom(11)
+	straight, err := Generate2DMatrices(8, 21, 21, 3, 3, 1, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := ReadTestCheckpoint(t, dir, 3)
+
+	//drawing other numbers first, as a new process would
+	SeedRandom(12)
+	RestoreRandom(snapshot.seed, snapshot.randomState)
+
+	resumed, err := ContinueMatrices2D(snapshot.matrix2D, snapshot.generation, 5, snapshot.Kcc, snapshot.Knn, snapshot.Knc, snapshot.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.DeepEqual(resumed[5], straight[8]) == false {
+		t.Fatal("the resumed run differs from the straight one at generation 8")
+	}
+}
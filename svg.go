@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+)
+
+//SVGConfig holds the settings of the vector drawings of 2D runs. Sites of the same color are merged into polygons, one path
+//per color, so the drawings stay small and sharp at any size. They are written to the folder "svg" as growth_<generation>.svg.
+type SVGConfig struct {
+
+	//Enabled turns the SVG drawings on
+	Enabled bool `json:"enabled"`
+
+	//Generations drawn; -1 is the last
+	Generations []int `json:"generations"`
+
+	//Mode is "fill" (the sites, colored by the palette), "contour" (the outlines of Contours only) or "both"
+	Mode string `json:"mode"`
+
+	//Scale is the size of a site in the width and height of the drawing; the drawing itself scales without loss
+	Scale float64 `json:"scale"`
+
+	//Legend of the state colors (and of the contours) below the lattice
+	Legend       bool     `json:"legend"`
+	LegendStates []string `json:"legendStates"`
+
+	//Contours outline regions of states
+	Contours []ContourConfig `json:"contours"`
+}
+
+//ContourConfig is an outline of the region of some states. The region is first closed with a square of Smoothing sites,
+//which fills the gaps between nearby cells, and outlines around less than MinArea sites are left out.
+type ContourConfig struct {
+	Name      string   `json:"name"`
+	States    []string `json:"states"`
+	Color     string   `json:"color"`
+	Width     float64  `json:"width"`
+	Smoothing int      `json:"smoothing"`
+	MinArea   float64  `json:"minArea"`
+}
+
+//SVGLegendEntry is an entry of the legend of a vector drawing: a filled swatch of a state, or an outlined one of a contour.
+type SVGLegendEntry struct {
+	name, color string
+	outline     bool
+}
+
+//DefaultSVGConfig returns disabled drawings of the last generation with a legend, and contours of the proliferative rim and the necrotic core.
+func DefaultSVGConfig() SVGConfig {
+
+	var svgConfig SVGConfig
+
+	svgConfig.Enabled = false
+	svgConfig.Generations = []int{-1}
+	svgConfig.Mode = "fill"
+	svgConfig.Scale = 4
+	svgConfig.Legend = true
+	svgConfig.LegendStates = []string{"C", "Q", "N", "wN"}
+	svgConfig.Contours = []ContourConfig{
+		{Name: "proliferative rim", States: []string{"C"}, Color: "#0000FF", Width: 1, Smoothing: 2, MinArea: 20},
+		{Name: "necrotic core", States: []string{"N", "wN"}, Color: "#FF0000", Width: 1, Smoothing: 2, MinArea: 20},
+	}
+
+	return svgConfig
+}
+
+//GetBoundaryLoops returns the outlines of the sites labelled label, as closed loops of lattice corners (x the column, y the row).
+//Each loop runs clockwise on screen around the sites and counterclockwise around holes, so they fill with either fill rule.
+func GetBoundaryLoops(labels [][]string, label string) [][]Point2D {
+
+	numRows := len(labels)
+	numCols := len(labels[0])
+
+	//corners are numbered row by row
+	corner := func(x, y int) int { return y*(numCols+1) + x }
+
+	isLabel := func(i, j int) bool {
+		return i >= 0 && i < numRows && j >= 0 && j < numCols && labels[i][j] == label
+	}
+
+	//edges between a site with the label and one without, leaving each corner
+	next := make(map[int][]int)
+
+	for i := range labels {
+		for j := range labels[i] {
+			if labels[i][j] != label {
+				continue
+			}
+			if isLabel(i-1, j) == false {
+				next[corner(j, i)] = append(next[corner(j, i)], corner(j+1, i))
+			}
+			if isLabel(i, j+1) == false {
+				next[corner(j+1, i)] = append(next[corner(j+1, i)], corner(j+1, i+1))
+			}
+			if isLabel(i+1, j) == false {
+				next[corner(j+1, i+1)] = append(next[corner(j+1, i+1)], corner(j, i+1))
+			}
+			if isLabel(i, j-1) == false {
+				next[corner(j, i+1)] = append(next[corner(j, i+1)], corner(j, i))
+			}
+		}
+	}
+
+	//starting corners in a fixed order, so that the same lattice always gives the same drawing
+	starts := make([]int, 0, len(next))
+	for start := range next {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	loops := make([][]Point2D, 0)
+
+	for _, start := range starts {
+		for len(next[start]) > 0 {
+
+			loop := make([]Point2D, 0)
+			current := start
+
+			for {
+				point := Point2D{float64(current % (numCols + 1)), float64(current / (numCols + 1))}
+				loop = AppendCorner(loop, point)
+
+				edges := next[current]
+				if len(edges) == 0 {
+					break
+				}
+				next[current] = edges[1:]
+				current = edges[0]
+
+				if current == start && len(next[start]) == 0 {
+					break
+				}
+			}
+
+			//the corner where the loop closes may be on a straight side
+			if len(loop) > 2 && IsCollinear(loop[len(loop)-1], loop[0], loop[1]) == true {
+				loop = loop[1:]
+			}
+
+			loops = append(loops, loop)
+		}
+	}
+
+	return loops
+}
+
+//AppendCorner adds a corner to a loop, dropping the previous corner if it lies on a straight line between its neighbours.
+func AppendCorner(loop []Point2D, point Point2D) []Point2D {
+
+	if len(loop) >= 2 && IsCollinear(loop[len(loop)-2], loop[len(loop)-1], point) == true {
+		loop[len(loop)-1] = point
+		return loop
+	}
+
+	return append(loop, point)
+}
+
+//IsCollinear returns true if b lies on the straight line through a and c.
+func IsCollinear(a, b, c Point2D) bool {
+	return (b.x-a.x)*(c.y-a.y) == (b.y-a.y)*(c.x-a.x)
+}
+
+//GetLoopArea returns the area inside a loop, by the shoelace formula.
+func GetLoopArea(loop []Point2D) float64 {
+
+	area := 0.0
+
+	for p := range loop {
+		q := (p + 1) % len(loop)
+		area += loop[p].x*loop[q].y - loop[q].x*loop[p].y
+	}
+
+	return math.Abs(area) / 2
+}
+
+//GetPathData returns the loops as the data of an SVG path.
+func GetPathData(loops [][]Point2D) string {
+
+	var data []byte
+
+	for _, loop := range loops {
+		for p, point := range loop {
+			if p == 0 {
+				data = append(data, 'M')
+			} else {
+				data = append(data, 'L')
+			}
+			data = strconv.AppendFloat(data, point.x, 'f', -1, 64)
+			data = append(data, ' ')
+			data = strconv.AppendFloat(data, point.y, 'f', -1, 64)
+		}
+		data = append(data, 'Z')
+	}
+
+	return string(data)
+}
+
+//GetColorLabels2D labels the sites in the field of a matrix with their colors in the palette, and the sites outside with "".
+func GetColorLabels2D(matrix Matrix2D, paletteConfig PaletteConfig) [][]string {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	labels := make([][]string, numRows)
+
+	//colors are formatted once each
+	hexes := make(map[[3]uint8]string)
+
+	for i := range matrix {
+		labels[i] = make([]string, numCols)
+		for j := range matrix[i] {
+			if InField2D(i, j, numRows, numCols) == false {
+				continue
+			}
+
+			r, g, b, _ := GetSiteColor2D(matrix[i][j], paletteConfig).RGBA()
+			key := [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+
+			hex, ok := hexes[key]
+			if ok == false {
+				hex = fmt.Sprintf("#%02X%02X%02X", key[0], key[1], key[2])
+				hexes[key] = hex
+			}
+			labels[i][j] = hex
+		}
+	}
+
+	return labels
+}
+
+//GetStateMask2D returns true at the sites of a matrix in one of states.
+func GetStateMask2D(matrix Matrix2D, states []string) [][]bool {
+
+	mask := make([][]bool, len(matrix))
+
+	for i := range matrix {
+		mask[i] = make([]bool, len(matrix[i]))
+		for j := range matrix[i] {
+			for _, state := range states {
+				if matrix[i][j].state == state {
+					mask[i][j] = true
+				}
+			}
+		}
+	}
+
+	return mask
+}
+
+//CloseMask dilates then erodes a mask with a square of 2*radius+1 sites, filling gaps narrower than the square.
+func CloseMask(mask [][]bool, radius int) [][]bool {
+
+	if radius <= 0 {
+		return mask
+	}
+
+	return ApplySquareFilter(ApplySquareFilter(mask, radius, true), radius, false)
+}
+
+//ApplySquareFilter dilates (any site of the square is set) or erodes (every site of the square is set) a mask.
+//Sites beyond the edges count as unset when dilating and as set when eroding.
+func ApplySquareFilter(mask [][]bool, radius int, dilate bool) [][]bool {
+
+	filtered := make([][]bool, len(mask))
+
+	for i := range mask {
+		filtered[i] = make([]bool, len(mask[i]))
+		for j := range mask[i] {
+			found := !dilate
+			for di := -radius; di <= radius && found == !dilate; di++ {
+				for dj := -radius; dj <= radius; dj++ {
+					a, b := i+di, j+dj
+					if a < 0 || a >= len(mask) || b < 0 || b >= len(mask[a]) {
+						continue
+					}
+					if mask[a][b] == dilate {
+						found = dilate
+						break
+					}
+				}
+			}
+			filtered[i][j] = found
+		}
+	}
+
+	return filtered
+}
+
+//GetContourLoops returns the outline of a contour on a matrix.
+func GetContourLoops(matrix Matrix2D, contour ContourConfig) [][]Point2D {
+
+	mask := CloseMask(GetStateMask2D(matrix, contour.States), contour.Smoothing)
+
+	labels := make([][]string, len(mask))
+	for i := range mask {
+		labels[i] = make([]string, len(mask[i]))
+		for j := range mask[i] {
+			if mask[i][j] == true {
+				labels[i][j] = "in"
+			}
+		}
+	}
+
+	loops := make([][]Point2D, 0)
+	for _, loop := range GetBoundaryLoops(labels, "in") {
+		if GetLoopArea(loop) >= contour.MinArea {
+			loops = append(loops, loop)
+		}
+	}
+
+	return loops
+}
+
+//WriteSVG2D writes a vector drawing of a matrix to filename.
+//The most common color of the field is drawn as one rectangle under the polygons of the other colors.
+func WriteSVG2D(matrix Matrix2D, filename string, svgConfig SVGConfig, paletteConfig PaletteConfig) error {
+
+	numRows := GetNumRows2D(matrix)
+	numCols := GetNumCols2D(matrix)
+
+	//legend entries: the states in fill modes, and the contours in contour modes
+	legend := make([]SVGLegendEntry, 0)
+	if svgConfig.Legend == true {
+		if svgConfig.Mode != "contour" {
+			stateColors := GetStateHexColors2D(paletteConfig)
+			for _, state := range svgConfig.LegendStates {
+				legend = append(legend, SVGLegendEntry{state, stateColors[state], false})
+			}
+		}
+		if svgConfig.Mode != "fill" {
+			for _, contour := range svgConfig.Contours {
+				legend = append(legend, SVGLegendEntry{contour.Name, contour.Color, true})
+			}
+		}
+	}
+
+	legendHeight := 0.0
+	if len(legend) > 0 {
+		legendHeight = 10
+	}
+
+	height := float64(numRows) + legendHeight
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintf(writer, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%g\" height=\"%g\" viewBox=\"0 0 %d %g\">\n",
+		float64(numCols)*svgConfig.Scale, height*svgConfig.Scale, numCols, height)
+	fmt.Fprintf(writer, "<rect width=\"%d\" height=\"%g\" fill=\"#FFFFFF\"/>\n", numCols, height)
+
+	if svgConfig.Mode != "contour" {
+		labels := GetColorLabels2D(matrix, paletteConfig)
+
+		//colors in order of how many sites they have
+		counts := make(map[string]int)
+		for i := range labels {
+			for j := range labels[i] {
+				if labels[i][j] != "" {
+					counts[labels[i][j]]++
+				}
+			}
+		}
+		colors := make([]string, 0, len(counts))
+		for col := range counts {
+			colors = append(colors, col)
+		}
+		sort.Slice(colors, func(a, b int) bool {
+			if counts[colors[a]] != counts[colors[b]] {
+				return counts[colors[a]] > counts[colors[b]]
+			}
+			return colors[a] < colors[b]
+		})
+
+		if len(colors) > 0 {
+			//the field spans the sites InField2D accepts
+			fmt.Fprintf(writer, "<rect x=\"5\" y=\"5\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", numCols-9, numRows-9, colors[0])
+
+			fmt.Fprintln(writer, "<g shape-rendering=\"crispEdges\" fill-rule=\"evenodd\">")
+			for _, col := range colors[1:] {
+				fmt.Fprintf(writer, "<path fill=\"%s\" d=\"%s\"/>\n", col, GetPathData(GetBoundaryLoops(labels, col)))
+			}
+			fmt.Fprintln(writer, "</g>")
+		}
+	}
+
+	if svgConfig.Mode != "fill" {
+		fmt.Fprintln(writer, "<g fill=\"none\" stroke-linejoin=\"round\">")
+		for _, contour := range svgConfig.Contours {
+			fmt.Fprintf(writer, "<path stroke=\"%s\" stroke-width=\"%g\" d=\"%s\"/>\n", contour.Color, contour.Width, GetPathData(GetContourLoops(matrix, contour)))
+		}
+		fmt.Fprintln(writer, "</g>")
+	}
+
+	if len(legend) > 0 {
+		fmt.Fprintf(writer, "<g font-family=\"sans-serif\" font-size=\"5\" transform=\"translate(2 %d)\">\n", numRows+2)
+		x := 0.0
+		for _, entry := range legend {
+			if entry.outline == true {
+				fmt.Fprintf(writer, "<rect x=\"%g\" y=\"0.5\" width=\"4\" height=\"4\" fill=\"none\" stroke=\"%s\" stroke-width=\"0.8\"/>\n", x, entry.color)
+			} else {
+				fmt.Fprintf(writer, "<rect x=\"%g\" y=\"0.5\" width=\"4\" height=\"4\" fill=\"%s\" stroke=\"#000000\" stroke-width=\"0.3\"/>\n", x, entry.color)
+			}
+			fmt.Fprintf(writer, "<text x=\"%g\" y=\"4.3\">%s</text>\n", x+5.5, html.EscapeString(entry.name))
+
+			//an estimate of the width of the name, as the fonts of viewers differ
+			x += 5.5 + 3*float64(len(entry.name)) + 4
+		}
+		fmt.Fprintln(writer, "</g>")
+	}
+
+	fmt.Fprintln(writer, "</svg>")
+
+	return CloseOutputFile(file, writer)
+}
+
+//OutputSVG2D writes the vector drawings of the generations of svgConfig to the folder "svg".
+//firstGeneration is the generation of timepoints[0], above 0 for runs resumed from a snapshot.
+func OutputSVG2D(timepoints []Matrix2D, firstGeneration int, svgConfig SVGConfig, paletteConfig PaletteConfig) error {
+
+	if svgConfig.Mode != "fill" && svgConfig.Mode != "contour" && svgConfig.Mode != "both" {
+		panic("SVG mode has to be fill, contour or both")
+	}
+
+	outputFolder := GetNewFolderDir("svg")
+	err := MakeDirIfNotExist(outputFolder)
+	if err != nil {
+		return err
+	}
+	RefreshDirectoryOf(outputFolder, ".svg")
+
+	for _, m := range svgConfig.Generations {
+		if m == -1 {
+			m = len(timepoints) - 1
+		}
+		if m < 0 || m >= len(timepoints) {
+			fmt.Println("Skipping SVG of generation " + strconv.Itoa(m) + ", which was not run")
+			continue
+		}
+
+		g := firstGeneration + m
+
+		fmt.Println("Drawing SVG of generation " + strconv.Itoa(g))
+		err = WriteSVG2D(timepoints[m], outputFolder+"/growth_"+strconv.Itoa(g)+".svg", svgConfig, paletteConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+//TidyConfig holds the settings of the tidy export of a run: one long table with a row per site and generation, written to the
+//folder "tidy" as each generation is run. sites.csv (or sites.csv.gz) holds the table, and with Columnar each column is
+//also written to tidy/columns as a gzipped array of little-endian numbers. sites.json describes the columns, the
+//dictionaries of the string columns (stored as codes in the columnar files), the generations exported and the run.
+//In Python, for example, a column is numpy.frombuffer(gzip.open("tidy/columns/clone.bin.gz").read(), "<i4").
+type TidyConfig struct {
+
+	//Enabled turns the export on
+	Enabled bool `json:"enabled"`
+
+	//Sites exported: "cells" (every site but healthy tissue) or "all"
+	Sites string `json:"sites"`
+
+	//Every is the number of generations between exported ones
+	Every int `json:"every"`
+
+	//Gzip compresses the table
+	Gzip bool `json:"gzip"`
+
+	//Columnar also writes the columns as arrays
+	Columnar bool `json:"columnar"`
+}
+
+//TidyMetadata describes a tidy export, in sites.json.
+type TidyMetadata struct {
+	Dimension   int              `json:"dimension"`
+	Sites       string           `json:"sites"`
+	Table       string           `json:"table"`
+	Rows        int              `json:"rows"`
+	Generations []int            `json:"generations"`
+	Columns     []TidyColumnInfo `json:"columns"`
+	Kcc         float64          `json:"Kcc"`
+	Knn         float64          `json:"Knn"`
+	Knc         float64          `json:"Knc"`
+	Seed        int64            `json:"seed"`
+	Config      Config           `json:"config"`
+}
+
+//TidyColumnInfo describes a column of a tidy export: its type in the table ("int", "float" or "string"), and its file,
+//type and dictionary in the columnar export. String columns are stored as uint8 codes into the dictionary.
+type TidyColumnInfo struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	File       string   `json:"file,omitempty"`
+	FileType   string   `json:"fileType,omitempty"`
+	Dictionary []string `json:"dictionary,omitempty"`
+}
+
+//TidyColumn holds the values of a column for the rows of one generation, in ints, floats or strings as given by its type.
+type TidyColumn struct {
+	name, kind string
+	ints       []int
+	floats     []float64
+	strings    []string
+}
+
+//DefaultTidyConfig returns a disabled export of the cells of every generation, as a plain table.
+func DefaultTidyConfig() TidyConfig {
+
+	var tidyConfig TidyConfig
+
+	tidyConfig.Enabled = false
+	tidyConfig.Sites = "cells"
+	tidyConfig.Every = 1
+	tidyConfig.Gzip = false
+	tidyConfig.Columnar = false
+
+	return tidyConfig
+}
+
+//CheckTidyConfig panics if the export is enabled with fewer than one generation between exported ones, or with sites
+//other than "cells" or "all".
+func CheckTidyConfig(tidyConfig TidyConfig) {
+
+	if tidyConfig.Enabled == false {
+		return
+	}
+	if tidyConfig.Every < 1 {
+		panic("Tidy every has to be at least 1")
+	}
+	if tidyConfig.Sites != "cells" && tidyConfig.Sites != "all" {
+		panic("Tidy sites has to be cells or all, not " + tidyConfig.Sites)
+	}
+}
+
+//GetTidyColumns2D returns the columns of the rows of generation g of a 2D run: the generation, the row x and column y of
+//the site, its state, clone, age, cycle phase and time in the phase, and the fields at the site (ECM, pressure and chemicals).
+func GetTidyColumns2D(matrix Matrix2D, g int, config Config) []TidyColumn {
+
+	columns := []TidyColumn{
+		{name: "generation", kind: "int"}, {name: "x", kind: "int"}, {name: "y", kind: "int"},
+		{name: "state", kind: "string"}, {name: "clone", kind: "int"}, {name: "age", kind: "int"},
+		{name: "phase", kind: "string"}, {name: "phaseAge", kind: "int"},
+		{name: "ecm", kind: "float"}, {name: "pressure", kind: "float"},
+	}
+	for _, chemical := range config.Chemicals {
+		columns = append(columns, TidyColumn{name: chemical.Name, kind: "float"})
+	}
+
+	for x := range matrix {
+		for y := range matrix[x] {
+			cell := matrix[x][y]
+			if cell.state == "h" && config.Tidy.Sites != "all" {
+				continue
+			}
+
+			columns[0].ints = append(columns[0].ints, g)
+			columns[1].ints = append(columns[1].ints, x)
+			columns[2].ints = append(columns[2].ints, y)
+			columns[3].strings = append(columns[3].strings, cell.state)
+			columns[4].ints = append(columns[4].ints, cell.clone)
+			columns[5].ints = append(columns[5].ints, cell.age)
+			columns[6].strings = append(columns[6].strings, cell.phase)
+			columns[7].ints = append(columns[7].ints, cell.phaseAge)
+			columns[8].floats = append(columns[8].floats, cell.ecm)
+			columns[9].floats = append(columns[9].floats, cell.pressure)
+
+			for c := range config.Chemicals {
+				value := 0.0
+				if c < len(cell.chemicals) {
+					value = cell.chemicals[c]
+				}
+				columns[10+c].floats = append(columns[10+c].floats, value)
+			}
+		}
+	}
+
+	return columns
+}
+
+//GetTidyColumns3D returns the columns of the rows of generation g of a 3D run: the generation, the row x, column y and
+//aisle z of the site, and its state and clone.
+func GetTidyColumns3D(matrix Matrix, g int, config Config) []TidyColumn {
+
+	columns := []TidyColumn{
+		{name: "generation", kind: "int"}, {name: "x", kind: "int"}, {name: "y", kind: "int"}, {name: "z", kind: "int"},
+		{name: "state", kind: "string"}, {name: "clone", kind: "int"},
+	}
+
+	for x := range matrix {
+		for y := range matrix[x] {
+			for z := range matrix[x][y] {
+				cell := matrix[x][y][z]
+				if cell.state == "h" && config.Tidy.Sites != "all" {
+					continue
+				}
+
+				columns[0].ints = append(columns[0].ints, g)
+				columns[1].ints = append(columns[1].ints, x)
+				columns[2].ints = append(columns[2].ints, y)
+				columns[3].ints = append(columns[3].ints, z)
+				columns[4].strings = append(columns[4].strings, cell.state)
+				columns[5].ints = append(columns[5].ints, cell.clone)
+			}
+		}
+	}
+
+	return columns
+}
+
+//GetTidyValue returns row r of a column as text.
+func GetTidyValue(column TidyColumn, r int) string {
+
+	if column.kind == "int" {
+		return strconv.Itoa(column.ints[r])
+	} else if column.kind == "float" {
+		return strconv.FormatFloat(column.floats[r], 'g', -1, 64)
+	}
+
+	return column.strings[r]
+}
+
+//GetTidyLength returns the number of rows of a column.
+func GetTidyLength(column TidyColumn) int {
+	return len(column.ints) + len(column.floats) + len(column.strings)
+}
+
+//OpenTidyFile opens a file of a tidy export to append to it, creating it if it does not exist.
+//The writer returned compresses what is written with gzip if compress is true; closing it closes the file.
+func OpenTidyFile(filename string, compress bool) (io.WriteCloser, error) {
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	RegisterOutputFile(filename)
+
+	if compress == false {
+		return file, nil
+	}
+
+	//each generation appends a gzip member, which readers of gzip files read on as one stream
+	return &TidyGzipFile{gzip.NewWriter(file), file}, nil
+}
+
+//TidyGzipFile is a gzip stream appended to a file.
+type TidyGzipFile struct {
+	writer *gzip.Writer
+	file   *os.File
+}
+
+//Write compresses p into the file.
+func (f *TidyGzipFile) Write(p []byte) (int, error) {
+	return f.writer.Write(p)
+}
+
+//Close ends the gzip stream and closes the file.
+func (f *TidyGzipFile) Close() error {
+
+	err := f.writer.Close()
+	if errFile := f.file.Close(); err == nil {
+		err = errFile
+	}
+
+	return err
+}
+
+//AppendTidyTable appends the rows of columns to the table, starting with the names of the columns if header is true.
+//The first error met is returned.
+func AppendTidyTable(columns []TidyColumn, filename string, header, compress bool) error {
+
+	file, err := OpenTidyFile(filename, compress)
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewWriter(file)
+	writer := csv.NewWriter(buffered)
+
+	if header == true {
+		names := make([]string, len(columns))
+		for c := range columns {
+			names[c] = columns[c].name
+		}
+		writer.Write(names)
+	}
+
+	row := make([]string, len(columns))
+	for r := 0; r < GetTidyLength(columns[0]); r++ {
+		for c := range columns {
+			row[c] = GetTidyValue(columns[c], r)
+		}
+		writer.Write(row)
+	}
+
+	//the csv writer and the buffer keep their first errors
+	writer.Flush()
+	err = writer.Error()
+	if errFlush := buffered.Flush(); err == nil {
+		err = errFlush
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return errors.New("problem when writing " + filename + ": " + err.Error())
+	}
+
+	return nil
+}
+
+//AppendTidyColumns appends columns to their files in folder, adding the new strings to the dictionaries of metadata.
+//The first error met is returned.
+func AppendTidyColumns(columns []TidyColumn, folder string, metadata *TidyMetadata) error {
+
+	for c, column := range columns {
+		info := &metadata.Columns[c]
+
+		file, err := OpenTidyFile(folder+"/"+info.File, true)
+		if err != nil {
+			return err
+		}
+
+		if column.kind == "int" {
+			values := make([]int32, len(column.ints))
+			for v := range column.ints {
+				values[v] = int32(column.ints[v])
+			}
+			err = binary.Write(file, binary.LittleEndian, values)
+		} else if column.kind == "float" {
+			err = binary.Write(file, binary.LittleEndian, column.floats)
+		} else {
+			codes := make([]uint8, len(column.strings))
+			for v, value := range column.strings {
+				code := -1
+				for d := range info.Dictionary {
+					if info.Dictionary[d] == value {
+						code = d
+					}
+				}
+				if code == -1 {
+					if len(info.Dictionary) == 256 {
+						file.Close()
+						return errors.New("tidy column " + column.name + " has more than 256 values")
+					}
+					code = len(info.Dictionary)
+					info.Dictionary = append(info.Dictionary, value)
+				}
+				codes[v] = uint8(code)
+			}
+			_, err = file.Write(codes)
+		}
+
+		if errClose := file.Close(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return errors.New("problem when writing " + folder + "/" + info.File + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+//NewTidyMetadata returns the description of a new tidy export of a run with columns.
+func NewTidyMetadata(columns []TidyColumn, dimension int, Kcc, Knn, Knc float64, config Config) TidyMetadata {
+
+	metadata := TidyMetadata{Dimension: dimension, Sites: config.Tidy.Sites, Generations: []int{}, Kcc: Kcc, Knn: Knn, Knc: Knc, Seed: RandomSeed, Config: config}
+
+	metadata.Table = "sites.csv"
+	if config.Tidy.Gzip == true {
+		metadata.Table = "sites.csv.gz"
+	}
+
+	fileTypes := map[string]string{"int": "int32", "float": "float64", "string": "uint8"}
+
+	for _, column := range columns {
+		info := TidyColumnInfo{Name: column.name, Type: column.kind}
+		if config.Tidy.Columnar == true {
+			info.File = "columns/" + column.name + ".bin.gz"
+			info.FileType = fileTypes[column.kind]
+			if column.kind == "string" {
+				info.Dictionary = []string{}
+			}
+		}
+		metadata.Columns = append(metadata.Columns, info)
+	}
+
+	return metadata
+}
+
+//ReadTidyMetadata reads the description of a tidy export.
+func ReadTidyMetadata(filename string) (TidyMetadata, error) {
+
+	var metadata TidyMetadata
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return metadata, errors.New("problem when reading " + filename + ": " + err.Error())
+	}
+
+	return metadata, nil
+}
+
+//WriteTidyMetadata writes the description of a tidy export.
+func WriteTidyMetadata(metadata TidyMetadata, filename string) error {
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return errors.New("problem when writing " + filename + ": " + err.Error())
+	}
+
+	return WriteOutputFile(filename, data)
+}
+
+//ExportGeneration adds generation g of a 2D (matrix3D nil) or 3D (matrix2D nil) run to the tidy export, if the config asks
+//for it. The export is started afresh at firstGeneration, the first generation of the run. The first error met is returned.
+//The tidy config is taken to be checked by CheckTidyConfig when it was read.
+func ExportGeneration(matrix2D Matrix2D, matrix3D Matrix, g, firstGeneration int, Kcc, Knn, Knc float64, config Config) error {
+
+	tidyConfig := config.Tidy
+
+	if tidyConfig.Enabled == false {
+		return nil
+	}
+	if (g-firstGeneration)%tidyConfig.Every != 0 {
+		return nil
+	}
+
+	var columns []TidyColumn
+	dimension := 2
+	if matrix3D == nil {
+		columns = GetTidyColumns2D(matrix2D, g, config)
+	} else {
+		dimension = 3
+		columns = GetTidyColumns3D(matrix3D, g, config)
+	}
+
+	outputFolder := GetNewFolderDir("tidy")
+
+	var metadata TidyMetadata
+	if g == firstGeneration {
+		err := MakeDirIfNotExist(outputFolder + "/columns")
+		if err != nil {
+			return err
+		}
+		RefreshDirectoryOf(outputFolder, ".csv")
+		RefreshDirectoryOf(outputFolder, ".json")
+		RefreshDirectoryOf(outputFolder+"/columns", ".bin")
+
+		metadata = NewTidyMetadata(columns, dimension, Kcc, Knn, Knc, config)
+	} else {
+		var err error
+		metadata, err = ReadTidyMetadata(outputFolder + "/sites.json")
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Exporting generation " + strconv.Itoa(g) + " to " + metadata.Table)
+
+	err := AppendTidyTable(columns, outputFolder+"/"+metadata.Table, g == firstGeneration, tidyConfig.Gzip)
+	if err != nil {
+		return err
+	}
+
+	if tidyConfig.Columnar == true {
+		err = AppendTidyColumns(columns, outputFolder, &metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	metadata.Rows += GetTidyLength(columns[0])
+	metadata.Generations = append(metadata.Generations, g)
+
+	return WriteTidyMetadata(metadata, outputFolder+"/sites.json")
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//TerminalView runs a simulation in the terminal, drawing the lattice with half-block characters in 24-bit ANSI colors,
+//two sites to a character, after every generation. 3D runs show their central axial slice.
+type TerminalView struct {
+	dimension string
+	matrix2D  Matrix2D
+	matrix3D  Matrix
+
+	generation, numGens int
+	Kcc, Knn, Knc       float64
+	paused              bool
+
+	config Config
+	writer *bufio.Writer
+
+	//settings of the terminal before it was switched to reading single keys, restored on quit
+	terminalState string
+
+	//size of the terminal, read when the view starts and whenever the terminal is resized
+	rows, cols int
+}
+
+//NewTerminalView returns a terminal view of a new 2D or 3D simulation of numGens generations, seeded as in config.
+func NewTerminalView(dimension string, numGens int, Kcc, Knn, Knc float64, config Config) *TerminalView {
+
+	view := &TerminalView{dimension: dimension, numGens: numGens, Kcc: Kcc, Knn: Knn, Knc: Knc, config: config}
+	view.writer = bufio.NewWriter(os.Stdout)
+
+	if dimension == "2D" {
+		view.matrix2D = InitialMatrix2D(201, 201, config)
+	} else if dimension == "3D" {
+		view.matrix3D = SeedMatrix3D(Initialize3DMatrix(100, 100, 100), config)
+	} else {
+		panic("Terminal view dimension has to be 2D or 3D")
+	}
+
+	return view
+}
+
+//Run shows the simulation, at most fps generations a second, until q is pressed.
+//p pauses and resumes, s runs one generation while paused.
+func (v *TerminalView) Run(fps int) {
+
+	v.StartTerminal()
+	defer v.StopTerminal()
+
+	//the terminal is restored if the program is interrupted
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		v.StopTerminal()
+		os.Exit(1)
+	}()
+
+	//SIGWINCH, which the syscall package does not define on every platform, is sent when the terminal is resized
+	resizes := make(chan os.Signal, 1)
+	signal.Notify(resizes, syscall.Signal(28))
+	defer signal.Stop(resizes)
+
+	v.rows, v.cols = GetTerminalSize()
+
+	keys := make(chan byte)
+	go ReadKeys(keys)
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+
+	v.Draw()
+
+	for {
+		select {
+		case key := <-keys:
+			if key == 'q' || key == 'Q' {
+				return
+			} else if key == 'p' || key == 'P' || key == ' ' {
+				v.paused = !v.paused
+			} else if key == 's' || key == 'S' {
+				v.paused = true
+				v.Step()
+			}
+			v.Draw()
+
+		case <-resizes:
+			v.rows, v.cols = GetTerminalSize()
+			fmt.Fprint(v.writer, "\x1b[2J")
+			v.Draw()
+
+		case <-ticker.C:
+			if v.paused == false && v.generation < v.numGens {
+				v.Step()
+				v.Draw()
+			}
+		}
+	}
+}
+
+//Step runs one generation, unless the run is finished.
+func (v *TerminalView) Step() {
+
+	if v.generation >= v.numGens {
+		return
+	}
+
+	if v.dimension == "2D" {
+		v.matrix2D = Update2DMatrix(v.matrix2D, v.Kcc, v.Knn, v.Knc, v.config)
+	} else {
+		v.matrix3D = UpdateMatrix(v.matrix3D, v.Kcc, v.Knn, v.Knc)
+	}
+
+	v.generation++
+}
+
+//ReadKeys sends every key pressed to keys.
+func ReadKeys(keys chan byte) {
+
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		key, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		keys <- key
+	}
+}
+
+//StartTerminal makes keys readable as they are pressed, without echo, and clears the screen and hides the cursor.
+//If the input is not a terminal, the view still runs, without keyboard controls.
+func (v *TerminalView) StartTerminal() {
+
+	state, err := RunStty("-g")
+	if err == nil {
+		v.terminalState = state
+		RunStty("cbreak", "-echo")
+	}
+
+	fmt.Fprint(v.writer, "\x1b[2J\x1b[?25l")
+	v.writer.Flush()
+}
+
+//StopTerminal restores the settings of the terminal and shows the cursor again.
+func (v *TerminalView) StopTerminal() {
+
+	if v.terminalState != "" {
+		RunStty(v.terminalState)
+	}
+
+	fmt.Fprint(v.writer, "\x1b[0m\x1b[?25h\n")
+	v.writer.Flush()
+}
+
+//RunStty runs stty on the terminal of the standard input, returning its output.
+func RunStty(args ...string) (string, error) {
+
+	command := exec.Command("stty", args...)
+	command.Stdin = os.Stdin
+
+	output, err := command.Output()
+
+	return strings.TrimSpace(string(output)), err
+}
+
+//GetTerminalSize returns the number of rows and columns of the terminal, or 24 by 80 if it cannot be read.
+func GetTerminalSize() (int, int) {
+
+	output, err := RunStty("size")
+	if err == nil {
+		fields := strings.Fields(output)
+		if len(fields) == 2 {
+			rows, errRows := strconv.Atoi(fields[0])
+			cols, errCols := strconv.Atoi(fields[1])
+			if errRows == nil && errCols == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+
+	return 24, 80
+}
+
+//Draw redraws the lattice, downsampled to fit the terminal above the two status lines, and the status lines.
+func (v *TerminalView) Draw() {
+
+	var matrix Matrix2D
+	var counts []int
+
+	if v.dimension == "2D" {
+		matrix = v.matrix2D
+		counts = CountStates2D(v.matrix2D, LiveStates)
+	} else {
+		matrix = GetSlice3D(v.matrix3D, "axial", -1)
+		counts = CountStates3D(v.matrix3D, LiveStates)
+	}
+
+	//each character holds two sites, one above the other
+	factor := 1
+	for (GetNumCols2D(matrix)+factor-1)/factor > v.cols || (GetNumRows2D(matrix)+2*factor-1)/(2*factor) > v.rows-3 {
+		factor++
+	}
+	small := DownsampleMatrix2D(matrix, factor)
+
+	fmt.Fprint(v.writer, "\x1b[H")
+
+	for i := 0; i < len(small); i += 2 {
+		for j := range small[i] {
+			//the last row of an odd number of rows is drawn on the background of the terminal
+			background := "\x1b[49m"
+			if i+1 < len(small) {
+				background = GetANSIBackground(GetSiteColor2D(small[i+1][j], v.config.Palette))
+			}
+			fmt.Fprint(v.writer, GetANSIForeground(GetSiteColor2D(small[i][j], v.config.Palette))+background+"▀")
+		}
+		fmt.Fprint(v.writer, "\x1b[0m\x1b[K\n")
+	}
+
+	status := "running"
+	if v.generation >= v.numGens {
+		status = "finished"
+	} else if v.paused == true {
+		status = "paused"
+	}
+
+	line := fmt.Sprintf("Generation %d/%d (%s)", v.generation, v.numGens, status)
+	for i, state := range LiveStates {
+		line += fmt.Sprintf("  %s %d", state, counts[i])
+	}
+	if factor > 1 {
+		line += fmt.Sprintf("  [1:%d]", factor)
+	}
+
+	fmt.Fprint(v.writer, line+"\x1b[K\n")
+	fmt.Fprint(v.writer, "p pause/resume  s step  q quit\x1b[K\x1b[J")
+
+	v.writer.Flush()
+}
+
+//DownsampleMatrix2D shrinks a matrix by factor, each block of factor by factor sites becoming one: a site of the most common
+//state in the block, counting healthy tissue only if the block holds nothing else, so that small groups of cells stay visible.
+func DownsampleMatrix2D(matrix Matrix2D, factor int) Matrix2D {
+
+	if factor <= 1 {
+		return matrix
+	}
+
+	numRows := (GetNumRows2D(matrix) + factor - 1) / factor
+	numCols := (GetNumCols2D(matrix) + factor - 1) / factor
+
+	small := make(Matrix2D, numRows)
+
+	for r := range small {
+		small[r] = make([]Cell2D, numCols)
+
+		for c := range small[r] {
+			counts := make(map[string]int)
+			first := make(map[string]Cell2D)
+
+			for i := r * factor; i < (r+1)*factor && i < len(matrix); i++ {
+				for j := c * factor; j < (c+1)*factor && j < len(matrix[i]); j++ {
+					state := matrix[i][j].state
+					if counts[state] == 0 {
+						first[state] = matrix[i][j]
+					}
+					counts[state]++
+				}
+			}
+
+			//states in a fixed order, so that ties always go the same way
+			states := make([]string, 0, len(counts))
+			for state := range counts {
+				states = append(states, state)
+			}
+			sort.Strings(states)
+
+			best := "h"
+			for _, state := range states {
+				if state != "h" && (best == "h" || counts[state] > counts[best]) {
+					best = state
+				}
+			}
+
+			small[r][c] = first[best]
+		}
+	}
+
+	return small
+}
+
+//GetANSIForeground returns the escape code setting the text color of a terminal to col.
+func GetANSIForeground(col color.Color) string {
+	rgba := color.RGBAModel.Convert(col).(color.RGBA)
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", rgba.R, rgba.G, rgba.B)
+}
+
+//GetANSIBackground returns the escape code setting the background color of a terminal to col.
+func GetANSIBackground(col color.Color) string {
+	rgba := color.RGBAModel.Convert(col).(color.RGBA)
+	return fmt.Sprintf("\x1b[48;2;%d;%d;%dm", rgba.R, rgba.G, rgba.B)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//VTKConfig holds the settings of the export of 3D runs as VTK image data, for ParaView and VisIt. Each site is a cell of
+//the image, with the fields of Fields as cell data. The files are written to the folder "vtk3D" as growth_<generation>.vti
+//(XML, zlib-compressed) or growth_<generation>.vtk (legacy), with growth.pvd indexing the .vti files as a time series.
+type VTKConfig struct {
+
+	//Enabled turns the export on
+	Enabled bool `json:"enabled"`
+
+	//Formats written: "vti" and "legacy"
+	Formats []string `json:"formats"`
+
+	//Every is the number of generations between exported ones; the last generation is always exported
+	Every int `json:"every"`
+
+	//Fields of the cells, from VTKFields. The state is written as a code, the index of the state in VTKStates.
+	Fields []string `json:"fields"`
+
+	//Spacing is the size of a site in the units of the export, 1 for lattice units
+	Spacing float64 `json:"spacing"`
+}
+
+//VTKStates are the states of the 3D model, in the order of their codes in the state field.
+var VTKStates = []string{"h", "C", "Q", "N", "wN"}
+
+//VTKFields are the fields of the sites that can be exported, and VTKTypes and VTKLegacyTypes their types in the XML and legacy files.
+var VTKFields = []string{"state", "clone", "pProliferation", "pQuiescent", "pNecrosis"}
+var VTKTypes = map[string]string{"state": "UInt8", "clone": "Int32", "pProliferation": "Float32", "pQuiescent": "Float32", "pNecrosis": "Float32"}
+var VTKLegacyTypes = map[string]string{"UInt8": "unsigned_char", "Int32": "int", "Float32": "float"}
+
+//VTKBlockSize is the size of the blocks compressed separately in the .vti files.
+const VTKBlockSize = 32768
+
+//DefaultVTKConfig returns a disabled export of every generation in .vti files, with every field, in lattice units.
+func DefaultVTKConfig() VTKConfig {
+
+	var vtkConfig VTKConfig
+
+	vtkConfig.Enabled = false
+	vtkConfig.Formats = []string{"vti"}
+	vtkConfig.Every = 1
+	vtkConfig.Fields = append([]string{}, VTKFields...)
+	vtkConfig.Spacing = 1
+
+	return vtkConfig
+}
+
+//CheckVTKConfig stops the program if the export settings cannot be written.
+func CheckVTKConfig(vtkConfig VTKConfig) {
+
+	for _, format := range vtkConfig.Formats {
+		if format != "vti" && format != "legacy" {
+			panic("VTK formats have to be vti or legacy")
+		}
+	}
+
+	for _, field := range vtkConfig.Fields {
+		if _, ok := VTKTypes[field]; ok == false {
+			panic("VTK field " + field + " is not one of " + strings.Join(VTKFields, ", "))
+		}
+	}
+
+	if vtkConfig.Every < 1 || vtkConfig.Spacing <= 0 {
+		panic("VTK every has to be at least 1 and spacing above 0")
+	}
+}
+
+//GetVTKStateCode returns the code of a state in the state field, its index in VTKStates. Seeds of other states are refused
+//by SeedInitialConditions3D, so every site has a code.
+func GetVTKStateCode(state string) int {
+
+	for code, name := range VTKStates {
+		if state == name {
+			return code
+		}
+	}
+
+	panic("State " + state + " has no VTK code")
+}
+
+//GetVTKFieldValues returns the values of a field at every site of a matrix, in the order of the cells of VTK image data:
+//x (the row) varying fastest, then y (the column), then z (the aisle).
+func GetVTKFieldValues(matrix Matrix, field string) []float64 {
+
+	numRows, numCols, numAisles := GetNumRows(matrix), GetNumCols(matrix), GetNumAisles(matrix)
+
+	values := make([]float64, 0, numRows*numCols*numAisles)
+
+	for k := 0; k < numAisles; k++ {
+		for j := 0; j < numCols; j++ {
+			for i := 0; i < numRows; i++ {
+				cell := matrix[i][j][k]
+
+				switch field {
+				case "state":
+					values = append(values, float64(GetVTKStateCode(cell.state)))
+				case "clone":
+					values = append(values, float64(cell.clone))
+				case "pProliferation":
+					values = append(values, cell.pProliferation)
+				case "pQuiescent":
+					values = append(values, cell.pQuiescent)
+				case "pNecrosis":
+					values = append(values, cell.pNecrosis)
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+//EncodeVTKValues returns the bytes of values stored as vtkType ("UInt8", "Int32" or "Float32") in the given byte order.
+func EncodeVTKValues(values []float64, vtkType string, order binary.ByteOrder) []byte {
+
+	var buffer bytes.Buffer
+
+	switch vtkType {
+	case "UInt8":
+		for _, value := range values {
+			buffer.WriteByte(uint8(value))
+		}
+	case "Int32":
+		column := make([]int32, len(values))
+		for v := range values {
+			column[v] = int32(values[v])
+		}
+		binary.Write(&buffer, order, column)
+	case "Float32":
+		column := make([]float32, len(values))
+		for v := range values {
+			column[v] = float32(values[v])
+		}
+		binary.Write(&buffer, order, column)
+	}
+
+	return buffer.Bytes()
+}
+
+//CompressVTKData returns data as written in a binary DataArray of a compressed .vti file: the header of the blocks
+//(their number, the uncompressed size of a block and of the last block, and the compressed size of each) and the
+//compressed blocks, each encoded in base64.
+func CompressVTKData(data []byte) string {
+
+	numBlocks := (len(data) + VTKBlockSize - 1) / VTKBlockSize
+	lastBlockSize := len(data) - (numBlocks-1)*VTKBlockSize
+	if numBlocks == 0 {
+		lastBlockSize = 0
+	}
+
+	header := []uint32{uint32(numBlocks), VTKBlockSize, uint32(lastBlockSize)}
+
+	var compressed bytes.Buffer
+
+	for b := 0; b < numBlocks; b++ {
+		end := (b + 1) * VTKBlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		var block bytes.Buffer
+		compressor := zlib.NewWriter(&block)
+		compressor.Write(data[b*VTKBlockSize : end])
+		compressor.Close()
+
+		header = append(header, uint32(block.Len()))
+		compressed.Write(block.Bytes())
+	}
+
+	var headerBytes bytes.Buffer
+	binary.Write(&headerBytes, binary.LittleEndian, header)
+
+	return base64.StdEncoding.EncodeToString(headerBytes.Bytes()) + base64.StdEncoding.EncodeToString(compressed.Bytes())
+}
+
+//GetVTKStateNote returns a note of the state codes, written into every file.
+func GetVTKStateNote() string {
+
+	codes := make([]string, len(VTKStates))
+	for code, state := range VTKStates {
+		codes[code] = strconv.Itoa(code) + " " + state
+	}
+
+	return "state codes " + strings.Join(codes, ", ")
+}
+
+//WriteVTI writes a matrix of generation g as VTK XML image data.
+func WriteVTI(matrix Matrix, g int, filename string, vtkConfig VTKConfig) error {
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	extent := fmt.Sprintf("0 %d 0 %d 0 %d", GetNumRows(matrix), GetNumCols(matrix), GetNumAisles(matrix))
+	spacing := strconv.FormatFloat(vtkConfig.Spacing, 'g', -1, 64)
+
+	fmt.Fprintln(writer, `<?xml version="1.0"?>`)
+	fmt.Fprintln(writer, "<!-- generation "+strconv.Itoa(g)+", "+GetVTKStateNote()+" -->")
+	fmt.Fprintln(writer, `<VTKFile type="ImageData" version="1.0" byte_order="LittleEndian" header_type="UInt32" compressor="vtkZLibDataCompressor">`)
+	fmt.Fprintln(writer, `  <ImageData WholeExtent="`+extent+`" Origin="0 0 0" Spacing="`+spacing+" "+spacing+" "+spacing+`">`)
+	fmt.Fprintln(writer, `    <Piece Extent="`+extent+`">`)
+
+	if len(vtkConfig.Fields) > 0 {
+		fmt.Fprintln(writer, `      <CellData Scalars="`+vtkConfig.Fields[0]+`">`)
+		for _, field := range vtkConfig.Fields {
+			data := EncodeVTKValues(GetVTKFieldValues(matrix, field), VTKTypes[field], binary.LittleEndian)
+			fmt.Fprintln(writer, `        <DataArray type="`+VTKTypes[field]+`" Name="`+field+`" format="binary">`)
+			fmt.Fprintln(writer, "          "+CompressVTKData(data))
+			fmt.Fprintln(writer, `        </DataArray>`)
+		}
+		fmt.Fprintln(writer, `      </CellData>`)
+	}
+
+	fmt.Fprintln(writer, `    </Piece>`)
+	fmt.Fprintln(writer, `  </ImageData>`)
+	fmt.Fprintln(writer, `</VTKFile>`)
+
+	return CloseOutputFile(file, writer)
+}
+
+//WriteLegacyVTK writes a matrix of generation g as legacy VTK structured points, in big-endian binary.
+func WriteLegacyVTK(matrix Matrix, g int, filename string, vtkConfig VTKConfig) error {
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	numRows, numCols, numAisles := GetNumRows(matrix), GetNumCols(matrix), GetNumAisles(matrix)
+	spacing := strconv.FormatFloat(vtkConfig.Spacing, 'g', -1, 64)
+
+	fmt.Fprintln(writer, "# vtk DataFile Version 3.0")
+	fmt.Fprintln(writer, "generation "+strconv.Itoa(g)+", "+GetVTKStateNote())
+	fmt.Fprintln(writer, "BINARY")
+	fmt.Fprintln(writer, "DATASET STRUCTURED_POINTS")
+	fmt.Fprintf(writer, "DIMENSIONS %d %d %d\n", numRows+1, numCols+1, numAisles+1)
+	fmt.Fprintln(writer, "ORIGIN 0 0 0")
+	fmt.Fprintln(writer, "SPACING "+spacing+" "+spacing+" "+spacing)
+	fmt.Fprintf(writer, "CELL_DATA %d\n", numRows*numCols*numAisles)
+
+	for _, field := range vtkConfig.Fields {
+		fmt.Fprintln(writer, "SCALARS "+field+" "+VTKLegacyTypes[VTKTypes[field]]+" 1")
+		fmt.Fprintln(writer, "LOOKUP_TABLE default")
+		writer.Write(EncodeVTKValues(GetVTKFieldValues(matrix, field), VTKTypes[field], binary.BigEndian))
+		fmt.Fprintln(writer)
+	}
+
+	return CloseOutputFile(file, writer)
+}
+
+//WritePVD writes a ParaView collection of the .vti files of generations, to open them as one time series.
+func WritePVD(generations []int, filename string) error {
+
+	file, err := CreateOutputFile(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintln(writer, `<?xml version="1.0"?>`)
+	fmt.Fprintln(writer, `<VTKFile type="Collection" version="0.1" byte_order="LittleEndian">`)
+	fmt.Fprintln(writer, `  <Collection>`)
+	for _, g := range generations {
+		fmt.Fprintln(writer, `    <DataSet timestep="`+strconv.Itoa(g)+`" group="" part="0" file="growth_`+strconv.Itoa(g)+`.vti"/>`)
+	}
+	fmt.Fprintln(writer, `  </Collection>`)
+	fmt.Fprintln(writer, `</VTKFile>`)
+
+	return CloseOutputFile(file, writer)
+}
+
+//OutputVTK3D exports every vtkConfig.Every-th generation of a 3D run, and the last, to the folder "vtk3D".
+//firstGeneration is the generation of timepoints[0], above 0 for runs resumed from a snapshot.
+func OutputVTK3D(timepoints []Matrix, firstGeneration int, vtkConfig VTKConfig) error {
+
+	CheckVTKConfig(vtkConfig)
+
+	outputFolder := GetNewFolderDir("vtk3D")
+	err := MakeDirIfNotExist(outputFolder)
+	if err != nil {
+		return err
+	}
+	RefreshDirectoryOf(outputFolder, ".vti")
+	RefreshDirectoryOf(outputFolder, ".vtk")
+	RefreshDirectoryOf(outputFolder, ".pvd")
+
+	generations := make([]int, 0)
+
+	for m := range timepoints {
+		if m%vtkConfig.Every != 0 && m != len(timepoints)-1 {
+			continue
+		}
+
+		g := firstGeneration + m
+		generations = append(generations, g)
+
+		fmt.Println("Exporting VTK of generation " + strconv.Itoa(g))
+
+		for _, format := range vtkConfig.Formats {
+			if format == "vti" {
+				err = WriteVTI(timepoints[m], g, outputFolder+"/growth_"+strconv.Itoa(g)+".vti", vtkConfig)
+			} else {
+				err = WriteLegacyVTK(timepoints[m], g, outputFolder+"/growth_"+strconv.Itoa(g)+".vtk", vtkConfig)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, format := range vtkConfig.Formats {
+		if format == "vti" {
+			err = WritePVD(generations, outputFolder+"/growth.pvd")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}